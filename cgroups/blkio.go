@@ -16,221 +16,309 @@
 
 package cgroups
 
-// import (
-// 	"bufio"
-// 	"fmt"
-// 	"io/ioutil"
-// 	"os"
-// 	"path/filepath"
-// 	"strconv"
-// 	"strings"
-
-// 	v1 "github.com/containerd/cgroups/stats/v1"
-// )
-
-// // NewBlkio returns a Blkio controller given the root folder of cgroups.
-// // It may optionally accept other configuration options, such as ProcRoot(path)
-// func NewBlkio(root string, options ...func(controller *blkioController)) *blkioController {
-// 	ctrl := &blkioController{
-// 		root:     filepath.Join(root, string(Blkio)),
-// 		procRoot: "/proc",
-// 	}
-// 	for _, opt := range options {
-// 		opt(ctrl)
-// 	}
-// 	return ctrl
-// }
-
-// // ProcRoot overrides the default location of the "/proc" filesystem
-// func ProcRoot(path string) func(controller *blkioController) {
-// 	return func(c *blkioController) {
-// 		c.procRoot = path
-// 	}
-// }
-
-// type blkioController struct {
-// 	root     string
-// 	procRoot string
-// }
-
-// func (b *blkioController) Name() Name {
-// 	return Blkio
-// }
-
-// func (b *blkioController) Path(path string) string {
-// 	return filepath.Join(b.root, path)
-// }
-
-// func (b *blkioController) Create(path string, resources *Resources) error {
-// 	if err := os.MkdirAll(b.Path(path), defaultDirPerm); err != nil {
-// 		return err
-// 	}
-// 	if resources.BlockIO == nil {
-// 		return nil
-// 	}
-// 	for _, t := range createBlkioSettings(resources.BlockIO) {
-// 		if t.value != nil {
-// 			if err := ioutil.WriteFile(
-// 				filepath.Join(b.Path(path), fmt.Sprintf("blkio.%s", t.name)),
-// 				t.format(t.value),
-// 				defaultFilePerm,
-// 			); err != nil {
-// 				return err
-// 			}
-// 		}
-// 	}
-// 	return nil
-// }
-
-// func (b *blkioController) Update(path string, resources *Resources) error {
-// 	return b.Create(path, resources)
-// }
-
-// func (b *blkioController) Stat(path string, stats *Stats) error {
-// 	stats.Blkio = BlkIOStat{}
-// 	settings := []blkioStatSettings{
-// 		{
-// 			name:  "throttle.io_serviced",
-// 			entry: &stats.Blkio.IoServicedRecursive,
-// 		},
-// 		{
-// 			name:  "throttle.io_service_bytes",
-// 			entry: &stats.Blkio.IoServiceBytesRecursive,
-// 		},
-// 	}
-// 	// Try to read CFQ stats available on all CFQ enabled kernels first
-// 	if _, err := os.Lstat(filepath.Join(b.Path(path), fmt.Sprintf("blkio.io_serviced_recursive"))); err == nil {
-// 		settings = []blkioStatSettings{}
-// 		settings = append(settings,
-// 			blkioStatSettings{
-// 				name:  "sectors_recursive",
-// 				entry: &stats.Blkio.SectorsRecursive,
-// 			},
-// 			blkioStatSettings{
-// 				name:  "io_service_bytes_recursive",
-// 				entry: &stats.Blkio.IoServiceBytesRecursive,
-// 			},
-// 			blkioStatSettings{
-// 				name:  "io_serviced_recursive",
-// 				entry: &stats.Blkio.IoServicedRecursive,
-// 			},
-// 			blkioStatSettings{
-// 				name:  "io_queued_recursive",
-// 				entry: &stats.Blkio.IoQueuedRecursive,
-// 			},
-// 			blkioStatSettings{
-// 				name:  "io_service_time_recursive",
-// 				entry: &stats.Blkio.IoServiceTimeRecursive,
-// 			},
-// 			blkioStatSettings{
-// 				name:  "io_wait_time_recursive",
-// 				entry: &stats.Blkio.IoWaitTimeRecursive,
-// 			},
-// 			blkioStatSettings{
-// 				name:  "io_merged_recursive",
-// 				entry: &stats.Blkio.IoMergedRecursive,
-// 			},
-// 			blkioStatSettings{
-// 				name:  "time_recursive",
-// 				entry: &stats.Blkio.IoTimeRecursive,
-// 			},
-// 		)
-// 	}
-// 	for _, t := range settings {
-// 		if err := b.readEntry(devices, path, t.name, t.entry); err != nil {
-// 			return err
-// 		}
-// 	}
-// 	return nil
-// }
-
-// func (b *blkioController) readEntry(devices map[deviceKey]string, path, name string, entry *[]*v1.BlkIOEntry) error {
-// 	f, err := os.Open(filepath.Join(b.Path(path), fmt.Sprintf("blkio.%s", name)))
-// 	if err != nil {
-// 		return err
-// 	}
-// 	defer f.Close()
-// 	sc := bufio.NewScanner(f)
-// 	for sc.Scan() {
-// 		if err := sc.Err(); err != nil {
-// 			return err
-// 		}
-// 		// format: dev type amount
-// 		fields := strings.FieldsFunc(sc.Text(), splitBlkIOStatLine)
-// 		if len(fields) < 3 {
-// 			if len(fields) == 2 && fields[0] == "Total" {
-// 				// skip total line
-// 				continue
-// 			} else {
-// 				return fmt.Errorf("Invalid line found while parsing %s: %s", path, sc.Text())
-// 			}
-// 		}
-// 		major, err := strconv.ParseUint(fields[0], 10, 64)
-// 		if err != nil {
-// 			return err
-// 		}
-// 		minor, err := strconv.ParseUint(fields[1], 10, 64)
-// 		if err != nil {
-// 			return err
-// 		}
-// 		op := ""
-// 		valueField := 2
-// 		if len(fields) == 4 {
-// 			op = fields[2]
-// 			valueField = 3
-// 		}
-// 		v, err := strconv.ParseUint(fields[valueField], 10, 64)
-// 		if err != nil {
-// 			return err
-// 		}
-// 		*entry = append(*entry, &v1.BlkIOEntry{
-// 			Device: devices[deviceKey{major, minor}],
-// 			Major:  major,
-// 			Minor:  minor,
-// 			Op:     op,
-// 			Value:  v,
-// 		})
-// 	}
-// 	return nil
-// }
-
-// func createBlkioSettings(blkio *BlockIOResource) []blkioSettings {
-// 	settings := []blkioSettings{}
-
-// 	if blkio.Weight != nil {
-// 		settings = append(settings,
-// 			blkioSettings{
-// 				name:   "weight",
-// 				value:  blkio.Weight,
-// 				format: uintf,
-// 			})
-// 	}
-// 	if blkio.LeafWeight != nil {
-// 		settings = append(settings,
-// 			blkioSettings{
-// 				name:   "leaf_weight",
-// 				value:  blkio.LeafWeight,
-// 				format: uintf,
-// 			})
-// 	}
-// 	return settings
-// }
-
-// type blkioSettings struct {
-// 	name   string
-// 	value  interface{}
-// 	format func(v interface{}) []byte
-// }
-
-// type blkioStatSettings struct {
-// 	name  string
-// 	entry *[]*BlkIOEntry
-// }
-
-// func uintf(v interface{}) []byte {
-// 	return []byte(strconv.FormatUint(uint64(*v.(*uint16)), 10))
-// }
-
-// func splitBlkIOStatLine(r rune) bool {
-// 	return r == ' ' || r == ':'
-// }
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// NewBlkio returns a Blkio controller given the root folder of cgroups.
+// It may optionally accept other configuration options, such as ProcRoot(path)
+func NewBlkio(root string, options ...func(controller *blkioController)) *blkioController {
+	ctrl := &blkioController{
+		root:     filepath.Join(root, string(Blkio)),
+		procRoot: "/proc",
+	}
+	for _, opt := range options {
+		opt(ctrl)
+	}
+	return ctrl
+}
+
+// ProcRoot overrides the default location of the "/proc" filesystem
+func ProcRoot(path string) func(controller *blkioController) {
+	return func(c *blkioController) {
+		c.procRoot = path
+	}
+}
+
+type blkioController struct {
+	root     string
+	procRoot string
+}
+
+func (b *blkioController) Name() Name {
+	return Blkio
+}
+
+func (b *blkioController) Path(path string) string {
+	return filepath.Join(b.root, path)
+}
+
+func (b *blkioController) Create(path string, resources *Resources) error {
+	if err := os.MkdirAll(b.Path(path), defaultDirPerm); err != nil {
+		return err
+	}
+	if resources.BlockIO == nil {
+		return nil
+	}
+	for _, t := range createBlkioSettings(resources.BlockIO) {
+		if err := ioutil.WriteFile(
+			filepath.Join(b.Path(path), fmt.Sprintf("blkio.%s", t.name)),
+			[]byte(t.value),
+			defaultFilePerm,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *blkioController) Update(path string, resources *Resources) error {
+	return b.Create(path, resources)
+}
+
+func (b *blkioController) Stat(path string, stats *Stats) error {
+	stats.Blkio = &BlkIOStat{}
+	settings := []blkioStatSettings{
+		{
+			name:  "throttle.io_serviced_recursive",
+			entry: &stats.Blkio.IoServicedRecursive,
+		},
+		{
+			name:  "throttle.io_service_bytes_recursive",
+			entry: &stats.Blkio.IoServiceBytesRecursive,
+		},
+	}
+	// Try to read CFQ stats available on all CFQ enabled kernels first
+	if _, err := os.Lstat(filepath.Join(b.Path(path), "blkio.io_serviced_recursive")); err == nil {
+		settings = []blkioStatSettings{
+			{
+				name:  "sectors_recursive",
+				entry: &stats.Blkio.SectorsRecursive,
+			},
+			{
+				name:  "io_service_bytes_recursive",
+				entry: &stats.Blkio.IoServiceBytesRecursive,
+			},
+			{
+				name:  "io_serviced_recursive",
+				entry: &stats.Blkio.IoServicedRecursive,
+			},
+			{
+				name:  "io_queued_recursive",
+				entry: &stats.Blkio.IoQueuedRecursive,
+			},
+			{
+				name:  "io_service_time_recursive",
+				entry: &stats.Blkio.IoServiceTimeRecursive,
+			},
+			{
+				name:  "io_wait_time_recursive",
+				entry: &stats.Blkio.IoWaitTimeRecursive,
+			},
+			{
+				name:  "io_merged_recursive",
+				entry: &stats.Blkio.IoMergedRecursive,
+			},
+			{
+				name:  "time_recursive",
+				entry: &stats.Blkio.IoTimeRecursive,
+			},
+		}
+	}
+	f, err := os.Open(filepath.Join(b.procRoot, "partitions"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	devices, err := getDevices(f)
+	if err != nil {
+		return err
+	}
+	for _, t := range settings {
+		if err := b.readEntry(devices, path, t.name, t.entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *blkioController) readEntry(devices map[deviceKey]string, path, name string, entry *[]*BlkIOEntry) error {
+	f, err := os.Open(filepath.Join(b.Path(path), fmt.Sprintf("blkio.%s", name)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if err := sc.Err(); err != nil {
+			return err
+		}
+		// format: dev type amount
+		fields := strings.FieldsFunc(sc.Text(), splitBlkIOStatLine)
+		if len(fields) < 3 {
+			if len(fields) == 2 && fields[0] == "Total" {
+				// skip total line
+				continue
+			} else {
+				return fmt.Errorf("Invalid line found while parsing %s: %s", path, sc.Text())
+			}
+		}
+		major, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return err
+		}
+		minor, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		op := ""
+		valueField := 2
+		if len(fields) == 4 {
+			op = fields[2]
+			valueField = 3
+		}
+		v, err := strconv.ParseUint(fields[valueField], 10, 64)
+		if err != nil {
+			return err
+		}
+		*entry = append(*entry, &BlkIOEntry{
+			Device: devices[deviceKey{major, minor}],
+			Major:  major,
+			Minor:  minor,
+			Op:     op,
+			Value:  v,
+		})
+	}
+	return nil
+}
+
+// createBlkioSettings returns the files to write, a device setting is
+// written on its own as the kernel only accepts one device per write
+func createBlkioSettings(blkio *BlockIOResource) []blkioSettings {
+	settings := []blkioSettings{}
+
+	if blkio.Weight != 0 {
+		settings = append(settings,
+			blkioSettings{
+				name:  "weight",
+				value: strconv.FormatUint(blkio.Weight, 10),
+			})
+	}
+	if blkio.LeafWeight != 0 {
+		settings = append(settings,
+			blkioSettings{
+				name:  "leaf_weight",
+				value: strconv.FormatUint(blkio.LeafWeight, 10),
+			})
+	}
+	for _, wd := range blkio.WeightDevice {
+		if wd.Weight != 0 {
+			settings = append(settings,
+				blkioSettings{
+					name:  "weight_device",
+					value: fmt.Sprintf("%d:%d %d", wd.Major, wd.Minor, wd.Weight),
+				})
+		}
+		if wd.LeafWeight != 0 {
+			settings = append(settings,
+				blkioSettings{
+					name:  "leaf_weight_device",
+					value: fmt.Sprintf("%d:%d %d", wd.Major, wd.Minor, wd.LeafWeight),
+				})
+		}
+	}
+	for _, t := range []struct {
+		name string
+		list []ThrottleDevice
+	}{
+		{
+			name: "throttle.read_bps_device",
+			list: blkio.ThrottleReadBpsDevice,
+		},
+		{
+			name: "throttle.write_bps_device",
+			list: blkio.ThrottleWriteBpsDevice,
+		},
+		{
+			name: "throttle.read_iops_device",
+			list: blkio.ThrottleReadIOPSDevice,
+		},
+		{
+			name: "throttle.write_iops_device",
+			list: blkio.ThrottleWriteIOPSDevice,
+		},
+	} {
+		for _, td := range t.list {
+			settings = append(settings,
+				blkioSettings{
+					name:  t.name,
+					value: fmt.Sprintf("%d:%d %d", td.Major, td.Minor, td.Rate),
+				})
+		}
+	}
+	return settings
+}
+
+type blkioSettings struct {
+	name  string
+	value string
+}
+
+type blkioStatSettings struct {
+	name  string
+	entry *[]*BlkIOEntry
+}
+
+func splitBlkIOStatLine(r rune) bool {
+	return r == ' ' || r == ':'
+}
+
+type deviceKey struct {
+	major, minor uint64
+}
+
+// getDevices makes a best effort attempt to read all the devices of
+// /proc/partitions into a map keyed by major and minor number. Since devices
+// may be mapped multiple times, we err on taking the first occurrence.
+//
+//	major minor  #blocks  name
+//
+//	   8        0  488386584 sda
+func getDevices(r io.Reader) (map[deviceKey]string, error) {
+	var (
+		s       = bufio.NewScanner(r)
+		devices = make(map[deviceKey]string)
+	)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		// skip the header and the blank line following it
+		if len(fields) < 4 || fields[0] == "major" {
+			continue
+		}
+		major, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		minor, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		key := deviceKey{
+			major: major,
+			minor: minor,
+		}
+		if _, ok := devices[key]; ok {
+			continue
+		}
+		devices[key] = filepath.Join("/dev", fields[3])
+	}
+	return devices, s.Err()
+}
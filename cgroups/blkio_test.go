@@ -16,89 +16,133 @@
 
 package cgroups
 
-// import (
-// 	"os"
-// 	"strings"
-// 	"testing"
-
-// 	v1 "github.com/containerd/cgroups/stats/v1"
-// )
-
-// const data = `   7       0 loop0 0 0 0 0 0 0 0 0 0 0 0
-//    7       1 loop1 0 0 0 0 0 0 0 0 0 0 0
-//    7       2 loop2 0 0 0 0 0 0 0 0 0 0 0
-//    7       3 loop3 0 0 0 0 0 0 0 0 0 0 0
-//    7       4 loop4 0 0 0 0 0 0 0 0 0 0 0
-//    7       5 loop5 0 0 0 0 0 0 0 0 0 0 0
-//    7       6 loop6 0 0 0 0 0 0 0 0 0 0 0
-//    7       7 loop7 0 0 0 0 0 0 0 0 0 0 0
-//    8       0 sda 1892042 187697 63489222 1246284 1389086 2887005 134903104 11390608 1 1068060 12692228
-//    8       1 sda1 1762875 37086 61241570 1200512 1270037 2444415 131214808 11152764 1 882624 12409308
-//    8       2 sda2 2 0 4 0 0 0 0 0 0 0 0
-//    8       5 sda5 129102 150611 2244440 45716 18447 442590 3688296 67268 0 62584 112984`
-
-// func TestGetDevices(t *testing.T) {
-// 	r := strings.NewReader(data)
-// 	devices, err := getDevices(r)
-// 	if err != nil {
-// 		t.Fatal(err)
-// 	}
-// 	name, ok := devices[deviceKey{8, 0}]
-// 	if !ok {
-// 		t.Fatal("no device found for 8,0")
-// 	}
-// 	const expected = "/dev/sda"
-// 	if name != expected {
-// 		t.Fatalf("expected device name %q but received %q", expected, name)
-// 	}
-// }
-
-// func TestNewBlkio(t *testing.T) {
-// 	const root = "/test/folder"
-// 	const expected = "/test/folder/blkio"
-// 	const expectedProc = "/proc"
-
-// 	ctrl := NewBlkio(root)
-// 	if ctrl.root != expected {
-// 		t.Fatalf("expected cgroups root %q but received %q", expected, ctrl.root)
-// 	}
-// 	if ctrl.procRoot != expectedProc {
-// 		t.Fatalf("expected proc FS root %q but received %q", expectedProc, ctrl.procRoot)
-// 	}
-// }
-
-// func TestBlkioStat(t *testing.T) {
-// 	_, err := os.Stat("/sys/fs/cgroup/blkio")
-// 	if os.IsNotExist(err) {
-// 		t.Skip("failed to find /sys/fs/cgroup/blkio")
-// 	}
-
-// 	ctrl := NewBlkio("/sys/fs/cgroup")
-
-// 	var metrics v1.Metrics
-// 	err = ctrl.Stat("", &metrics)
-// 	if err != nil {
-// 		t.Fatalf("failed to call Stat: %v", err)
-// 	}
-
-// 	if len(metrics.Blkio.IoServicedRecursive) == 0 {
-// 		t.Fatalf("IoServicedRecursive must not be empty")
-// 	}
-// 	if len(metrics.Blkio.IoServiceBytesRecursive) == 0 {
-// 		t.Fatalf("IoServiceBytesRecursive must not be empty")
-// 	}
-// }
-
-// func TestNewBlkio_Proc(t *testing.T) {
-// 	const root = "/test/folder"
-// 	const expected = "/test/folder/blkio"
-// 	const expectedProc = "/test/proc"
-
-// 	ctrl := NewBlkio(root, ProcRoot(expectedProc))
-// 	if ctrl.root != expected {
-// 		t.Fatalf("expected cgroups root %q but received %q", expected, ctrl.root)
-// 	}
-// 	if ctrl.procRoot != expectedProc {
-// 		t.Fatalf("expected proc FS root %q but received %q", expectedProc, ctrl.procRoot)
-// 	}
-// }
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const data = `major minor  #blocks  name
+
+   7        0     102400 loop0
+   7        1     102400 loop1
+   8        0  488386584 sda
+   8        1  487358464 sda1
+   8        2          1 sda2
+   8        5    1024000 sda5`
+
+func TestGetDevices(t *testing.T) {
+	r := strings.NewReader(data)
+	devices, err := getDevices(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, ok := devices[deviceKey{8, 0}]
+	if !ok {
+		t.Fatal("no device found for 8,0")
+	}
+	const expected = "/dev/sda"
+	if name != expected {
+		t.Fatalf("expected device name %q but received %q", expected, name)
+	}
+}
+
+func TestNewBlkio(t *testing.T) {
+	const root = "/test/folder"
+	const expected = "/test/folder/blkio"
+	const expectedProc = "/proc"
+
+	ctrl := NewBlkio(root)
+	if ctrl.root != expected {
+		t.Fatalf("expected cgroups root %q but received %q", expected, ctrl.root)
+	}
+	if ctrl.procRoot != expectedProc {
+		t.Fatalf("expected proc FS root %q but received %q", expectedProc, ctrl.procRoot)
+	}
+}
+
+func TestBlkioStat(t *testing.T) {
+	mock, err := newMock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.delete()
+	if err := ioutil.WriteFile(filepath.Join(mock.root, "partitions"), []byte(data), defaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+	ctrl := NewBlkio(mock.root, ProcRoot(mock.root))
+	if err := ctrl.Create("test", &Resources{}); err != nil {
+		t.Fatal(err)
+	}
+	for file, value := range map[string]string{
+		"blkio.throttle.io_serviced_recursive":      "8:0 Read 3\n8:0 Write 1\n8:0 Total 4\nTotal 4\n",
+		"blkio.throttle.io_service_bytes_recursive": "8:0 Read 12288\n8:0 Write 4096\n8:0 Total 16384\nTotal 16384\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(mock.root, "blkio", "test", file), []byte(value), defaultFilePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stats Stats
+	if err := ctrl.Stat("test", &stats); err != nil {
+		t.Fatalf("failed to call Stat: %v", err)
+	}
+	if len(stats.Blkio.IoServicedRecursive) != 3 {
+		t.Fatalf("expected 3 IoServicedRecursive entries but received %d", len(stats.Blkio.IoServicedRecursive))
+	}
+	entry := stats.Blkio.IoServiceBytesRecursive[0]
+	if entry.Device != "/dev/sda" || entry.Op != "Read" || entry.Value != 12288 {
+		t.Fatalf("unexpected IoServiceBytesRecursive entry %+v", entry)
+	}
+}
+
+func TestBlkioCreate(t *testing.T) {
+	mock, err := newMock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.delete()
+	ctrl := NewBlkio(mock.root)
+	if err := ctrl.Create("test", &Resources{
+		BlockIO: &BlockIOResource{
+			Weight:                500,
+			WeightDevice:          []WeightDevice{{Major: 8, Minor: 0, Weight: 100, LeafWeight: 200}},
+			ThrottleReadBpsDevice: []ThrottleDevice{{Major: 8, Minor: 0, Rate: 1048576}},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for file, expected := range map[string]string{
+		"blkio.weight":                   "500",
+		"blkio.weight_device":            "8:0 100",
+		"blkio.leaf_weight_device":       "8:0 200",
+		"blkio.throttle.read_bps_device": "8:0 1048576",
+	} {
+		value, err := ioutil.ReadFile(filepath.Join(mock.root, "blkio", "test", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(value) != expected {
+			t.Fatalf("expected %q in %s but received %q", expected, file, value)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(mock.root, "blkio", "test", "blkio.leaf_weight")); !os.IsNotExist(err) {
+		t.Fatal("expected an unset leaf weight to be left alone")
+	}
+}
+
+func TestNewBlkio_Proc(t *testing.T) {
+	const root = "/test/folder"
+	const expected = "/test/folder/blkio"
+	const expectedProc = "/test/proc"
+
+	ctrl := NewBlkio(root, ProcRoot(expectedProc))
+	if ctrl.root != expected {
+		t.Fatalf("expected cgroups root %q but received %q", expected, ctrl.root)
+	}
+	if ctrl.procRoot != expectedProc {
+		t.Fatalf("expected proc FS root %q but received %q", expectedProc, ctrl.procRoot)
+	}
+}
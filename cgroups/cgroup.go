@@ -1,43 +1,67 @@
 package cgroups
 
 import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 )
 
 // Cgroup handles interactions with the individual groups to perform
 // actions on them as them main interface to this cgroup package
 type Cgroup interface {
-	// // New creates a new cgroup under the calling cgroup
-	// New(string, *Resources) (Cgroup, error)
-	// // Add adds a process to the cgroup (cgroup.procs)
-	// Add(Process) error
-	// // AddTask adds a process to the cgroup (tasks)
-	// AddTask(Process) error
-	// // Delete removes the cgroup as a whole
-	// Delete() error
-	// // MoveTo moves all the processes under the calling cgroup to the provided one
-	// // subsystems are moved one at a time
-	// MoveTo(Cgroup) error
-	// // Stat returns the stats for all subsystems in the cgroup
-	// Stat(...ErrorHandler) (*Stats, error)
+	// New creates a new cgroup under the calling cgroup
+	New(string, *Resources) (Cgroup, error)
+	// Add adds a process to the cgroup (cgroup.procs)
+	Add(Process) error
+	// AddTask adds a process to the cgroup (tasks)
+	AddTask(Process) error
+	// Paths returns the absolute path of the cgroup for every active subsystem
+	Paths() map[Name]string
+	// Delete removes the cgroup as a whole
+	Delete() error
+	// MoveTo moves all the processes under the calling cgroup to the provided one
+	// subsystems are moved one at a time
+	MoveTo(Cgroup) error
+	// Stat returns the stats for all subsystems in the cgroup
+	Stat(...ErrorHandler) (*Stats, error)
+	// Update updates all the subsystems with the new resource definition
+	Update(*Resources) error
+	// Processes returns all the processes in a select subsystem for the cgroup
+	Processes(Name, bool) ([]Process, error)
+	// Freeze freezes or pauses all processes inside the cgroup
+	Freeze() error
+	// Thaw thaw or resumes all processes inside the cgroup
+	Thaw() error
+	// State returns the cgroups current state
+	State() State
+	// OOMEvents returns a channel that receives the oom events of the
+	// cgroup, it is closed once ctx is done or the cgroup is gone
+	OOMEvents(ctx context.Context) (<-chan struct{}, error)
+	// RegisterPSITrigger calls the function every time the pressure
+	// trigger fires, until the returned closer is closed
+	RegisterPSITrigger(PSITrigger, func()) (io.Closer, error)
 }
 
 // cgroup hold a cgroup manager
 type cgroup struct {
 	path       string
 	subsystems []Subsystem
-	mu         sync.Mutex
-	err        error
+	// unifiedRoot is the mountpoint of the cgroup v2 hierarchy when some
+	// of the subsystems are its controllers, they all share one directory.
+	unifiedRoot string
+	mu          sync.Mutex
+	err         error
 }
 
 // NewCgroup return a cgroup
 func NewCgroup(path string, resources *Resources) (Cgroup, error) {
-	root, err := getMountPoint()
-	if err != nil {
-		return nil, err
-	}
-	subsystems, err := defaults(root)
+	subsystems, unifiedRoot, err := hierarchy()
 	if err != nil {
 		return nil, err
 	}
@@ -48,16 +72,410 @@ func NewCgroup(path string, resources *Resources) (Cgroup, error) {
 			enabled = append(enabled, s)
 		}
 	}
+	if unifiedRoot != "" {
+		if err := enableControllers(unifiedRoot, path, enabled); err != nil {
+			return nil, err
+		}
+	}
 	var active []Subsystem
 	for _, s := range enabled {
 		// check if subsystem exists
 		if err := initializeSubsystem(s, path, resources); err != nil {
+			// do not leave a partially created cgroup behind
+			(&cgroup{path: path, subsystems: append(active, s)}).Delete()
 			return nil, err
 		}
 		active = append(active, s)
 	}
 	return &cgroup{
-		path:       path,
-		subsystems: active,
+		path:        path,
+		subsystems:  active,
+		unifiedRoot: unifiedRoot,
 	}, nil
 }
+
+// Load loads an existing cgroup with the given path, subsystems that the
+// cgroup does not exist in are skipped
+func Load(path string) (Cgroup, error) {
+	subsystems, unifiedRoot, err := hierarchy()
+	if err != nil {
+		return nil, err
+	}
+	var active []Subsystem
+	for _, s := range pathers(subsystems) {
+		if _, err := os.Lstat(s.Path(path)); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		active = append(active, s)
+	}
+	if len(active) == 0 {
+		return nil, ErrCgroupDeleted
+	}
+	return &cgroup{
+		path:        path,
+		subsystems:  active,
+		unifiedRoot: unifiedRoot,
+	}, nil
+}
+
+// New returns a new sub cgroup
+func (c *cgroup) New(name string, resources *Resources) (Cgroup, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	path := filepath.Join(c.path, name)
+	if c.unifiedRoot != "" {
+		if err := enableControllers(c.unifiedRoot, path, c.subsystems); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range c.subsystems {
+		if err := initializeSubsystem(s, path, resources); err != nil {
+			return nil, err
+		}
+	}
+	return &cgroup{
+		path:        path,
+		subsystems:  c.subsystems,
+		unifiedRoot: c.unifiedRoot,
+	}, nil
+}
+
+// Paths returns the absolute path of the cgroup for every active subsystem
+func (c *cgroup) Paths() map[Name]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	paths := make(map[Name]string)
+	for _, s := range pathers(c.subsystems) {
+		paths[s.Name()] = s.Path(c.path)
+	}
+	return paths
+}
+
+// Add moves the provided process into the new cgroup
+func (c *cgroup) Add(process Process) error {
+	if process.Pid <= 0 {
+		return ErrInvalidPid
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return c.add(process, cgroupProcs)
+}
+
+// AddTask moves the provided tasks (threads) into the new cgroup, a
+// controller of the unified hierarchy requires a threaded cgroup
+func (c *cgroup) AddTask(process Process) error {
+	if process.Pid <= 0 {
+		return ErrInvalidPid
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return c.add(process, cgroupTasks)
+}
+
+func (c *cgroup) add(process Process, pType string) error {
+	for _, s := range pathers(c.subsystems) {
+		file := pType
+		// the unified hierarchy has no tasks file
+		if pType == cgroupTasks && inUnified(s, c.unifiedRoot) {
+			file = cgroupThreads
+		}
+		if err := retryingWriteFile(
+			filepath.Join(s.Path(c.path), file),
+			[]byte(strconv.Itoa(process.Pid)),
+			defaultFilePerm,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete will remove the control group from each of the subsystems registered
+func (c *cgroup) Delete() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	var errs []string
+	for _, s := range c.subsystems {
+		if d, ok := s.(deleter); ok {
+			if err := d.Delete(c.path); err != nil {
+				errs = append(errs, string(s.Name()))
+			}
+			continue
+		}
+		if p, ok := s.(pather); ok {
+			path := p.Path(c.path)
+			if err := remove(path); err != nil {
+				errs = append(errs, path)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("cgroups: unable to remove paths %s", strings.Join(errs, ", "))
+	}
+	c.err = ErrCgroupDeleted
+	return nil
+}
+
+// Stat returns the current metrics for the cgroup
+func (c *cgroup) Stat(handlers ...ErrorHandler) (*Stats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	if len(handlers) == 0 {
+		handlers = append(handlers, errPassthrough)
+	}
+	var (
+		stats = &Stats{
+			CPU: &CPUStat{
+				Throttling: &ThrottlingStat{},
+				Usage:      &CPUUsage{},
+			},
+		}
+		wg   = &sync.WaitGroup{}
+		errs = make(chan error, len(c.subsystems))
+	)
+	for _, s := range c.subsystems {
+		if ss, ok := s.(stater); ok {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := ss.Stat(c.path, stats); err != nil {
+					for _, eh := range handlers {
+						if herr := eh(err); herr != nil {
+							errs <- herr
+						}
+					}
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// Update updates the cgroup with the new resource values provided, it stops
+// at the first subsystem that cannot be updated
+func (c *cgroup) Update(resources *Resources) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	for _, s := range c.subsystems {
+		if u, ok := s.(updater); ok {
+			if err := u.Update(c.path, resources); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// MoveTo does a recursive move subsystem by subsystem of all the processes
+// inside the group
+func (c *cgroup) MoveTo(destination Cgroup) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	for _, s := range pathers(c.subsystems) {
+		processes, err := c.processes(s.Name(), true)
+		if err != nil {
+			// if the control group does not exist within a subsystem, then proceed to the next subsystem
+			if IgnoreNotExist(err) == nil {
+				continue
+			}
+			return err
+		}
+		for _, p := range processes {
+			if err := destination.Add(p); err != nil {
+				if strings.Contains(err.Error(), "no such process") {
+					continue
+				}
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Processes returns the processes running inside the cgroup along
+// with the subsystem used, pid, and path
+func (c *cgroup) Processes(subsystem Name, recursive bool) ([]Process, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.processes(subsystem, recursive)
+}
+
+func (c *cgroup) processes(subsystem Name, recursive bool) ([]Process, error) {
+	s, ok := c.getSubsystem(subsystem).(pather)
+	if !ok {
+		return nil, fmt.Errorf("cgroups: %s subsystem is not active", subsystem)
+	}
+	root := s.Path(c.path)
+	if _, err := os.Lstat(root); err != nil {
+		return nil, err
+	}
+	var processes []Process
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if !recursive && p != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		dir, name := filepath.Split(p)
+		if name != cgroupProcs {
+			return nil
+		}
+		procs, err := readPids(dir, subsystem)
+		if err != nil {
+			return err
+		}
+		processes = append(processes, procs...)
+		return nil
+	})
+	return processes, err
+}
+
+// Freeze freezes the entire cgroup and all the processes inside it
+func (c *cgroup) Freeze() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	s, ok := c.getSubsystem(Freezer).(freezer)
+	if !ok {
+		return ErrFreezerNotSupported
+	}
+	return s.Freeze(c.path)
+}
+
+// Thaw thaws out the cgroup and all the processes inside it
+func (c *cgroup) Thaw() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	s, ok := c.getSubsystem(Freezer).(freezer)
+	if !ok {
+		return ErrFreezerNotSupported
+	}
+	return s.Thaw(c.path)
+}
+
+// State returns the state of the cgroup and its processes
+func (c *cgroup) State() State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == ErrCgroupDeleted {
+		return Deleted
+	}
+	s, ok := c.getSubsystem(Freezer).(freezer)
+	if !ok {
+		return Thawed
+	}
+	state, err := s.State(c.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Deleted
+		}
+		return Unknown
+	}
+	return state
+}
+
+// OOMEvents returns a channel that receives the oom events of the cgroup
+// until ctx is done
+func (c *cgroup) OOMEvents(ctx context.Context) (<-chan struct{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	s, ok := c.getSubsystem(Memory).(oomNotifier)
+	if !ok {
+		return nil, ErrMemoryNotSupported
+	}
+	return s.OOMEvents(ctx, c.path)
+}
+
+// RegisterPSITrigger calls fn every time the pressure trigger fires, the
+// pressure files are only part of the cgroups of the unified hierarchy
+func (c *cgroup) RegisterPSITrigger(t PSITrigger, fn func()) (io.Closer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	if c.unifiedRoot == "" {
+		return nil, ErrPSINotSupported
+	}
+	return registerPSITrigger(filepath.Join(c.unifiedRoot, c.path), t, fn)
+}
+
+func (c *cgroup) getSubsystem(n Name) Subsystem {
+	for _, s := range c.subsystems {
+		if s.Name() == n {
+			return s
+		}
+	}
+	return nil
+}
+
+// readPids reads the pids listed in the cgroup.procs file of the directory
+func readPids(path string, subsystem Name) ([]Process, error) {
+	f, err := os.Open(filepath.Join(path, cgroupProcs))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var (
+		out []Process
+		s   = bufio.NewScanner(f)
+	)
+	for s.Scan() {
+		if t := s.Text(); t != "" {
+			pid, err := strconv.Atoi(t)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, Process{
+				Pid:       pid,
+				Subsystem: subsystem,
+				Path:      path,
+			})
+		}
+	}
+	return out, s.Err()
+}
@@ -0,0 +1,128 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func newMockCgroup(t *testing.T) (*mockCgroup, Cgroup) {
+	mock, err := newMock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mock, &cgroup{
+		path:       "/",
+		subsystems: mock.subsystems,
+	}
+}
+
+func TestNew(t *testing.T) {
+	mock, root := newMockCgroup(t)
+	defer mock.delete()
+	child, err := root.New("test", &Resources{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, path := range child.Paths() {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if filepath.Base(path) != "test" {
+			t.Fatalf("expected %s path to end in test, got %s", name, path)
+		}
+	}
+}
+
+func TestAddTask(t *testing.T) {
+	mock, root := newMockCgroup(t)
+	defer mock.delete()
+	child, err := root.New("test", &Resources{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := child.AddTask(Process{Pid: 1234}); err != nil {
+		t.Fatal(err)
+	}
+	for name, path := range child.Paths() {
+		data, err := ioutil.ReadFile(filepath.Join(path, cgroupTasks))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "1234" {
+			t.Fatalf("expected tid 1234 in %s but received %q", name, data)
+		}
+	}
+	if err := child.AddTask(Process{}); err != ErrInvalidPid {
+		t.Fatalf("expected %v but received %v", ErrInvalidPid, err)
+	}
+}
+
+func TestMoveTo(t *testing.T) {
+	mock, root := newMockCgroup(t)
+	defer mock.delete()
+	src, err := root.New("src", &Resources{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := root.New("dst", &Resources{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Add(Process{Pid: 1234}); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.MoveTo(dst); err != nil {
+		t.Fatal(err)
+	}
+	procs, err := dst.Processes(Pids, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(procs) != 1 || procs[0].Pid != 1234 {
+		t.Fatalf("expected pid 1234 to be moved but received %v", procs)
+	}
+}
+
+func TestStat(t *testing.T) {
+	mock, root := newMockCgroup(t)
+	defer mock.delete()
+	child, err := root.New("test", &Resources{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := child.Stat(); err == nil {
+		t.Fatal("expected an error for the missing stat files")
+	}
+	pids := filepath.Join(mock.root, "pids", "test")
+	for file, value := range map[string]int{"pids.current": 5, "pids.max": 10} {
+		if err := ioutil.WriteFile(filepath.Join(pids, file), []byte(strconv.Itoa(value)), defaultFilePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats, err := child.Stat(IgnoreNotExist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Pids == nil || stats.Pids.Current != 5 || stats.Pids.Limit != 10 {
+		t.Fatalf("expected pids stats 5/10 but received %+v", stats.Pids)
+	}
+}
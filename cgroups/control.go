@@ -16,3 +16,13 @@ const (
 // to a read cgroup filesystem and do not exist prior when running in the tests.
 // this is set to a non 0 value in the test code
 var defaultFilePerm = os.FileMode(0)
+
+// Process is a process running inside a cgroup
+type Process struct {
+	// Subsystem is the name of the subsystem that the process is in
+	Subsystem Name
+	// Pid is the process id of the process
+	Pid int
+	// Path is the full path of the subsystem and location that the process is in
+	Path string
+}
@@ -7,8 +7,6 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
-
-	"github.com/sirupsen/logrus"
 )
 
 func NewCpu(root string) *cpuController {
@@ -114,10 +112,6 @@ func (c *cpuController) Stat(path string, stats *Stats) error {
 		if err != nil {
 			return err
 		}
-		logrus.WithFields(logrus.Fields{
-			"key": key,
-			"v":   v,
-		}).Info("cpu stat: key:, v:")
 		switch key {
 		case "nr_periods":
 			stats.CPU.Throttling.Periods = v
@@ -129,3 +123,85 @@ func (c *cpuController) Stat(path string, stats *Stats) error {
 	}
 	return nil
 }
+
+// NewCpuV2 returns the cpu controller of the unified hierarchy mounted at
+// root.
+func NewCpuV2(root string) *cpuV2Controller {
+	return &cpuV2Controller{
+		root: root,
+	}
+}
+
+type cpuV2Controller struct {
+	root string
+}
+
+func (c *cpuV2Controller) Name() Name {
+	return Cpu
+}
+
+func (c *cpuV2Controller) Path(path string) string {
+	return filepath.Join(c.root, path)
+}
+
+// Create maps the shares onto cpu.weight and the cfs quota and period onto
+// cpu.max, the unified hierarchy has no realtime settings.
+func (c *cpuV2Controller) Create(path string, resources *Resources) error {
+	if err := os.MkdirAll(c.Path(path), defaultDirPerm); err != nil {
+		return err
+	}
+	cpu := resources.CPU
+	if cpu == nil {
+		return nil
+	}
+	if cpu.RealtimePeriod != nil || cpu.RealtimeRuntime != nil {
+		return ErrRealtimeNotSupported
+	}
+	if cpu.Shares != nil {
+		if err := ioutil.WriteFile(
+			filepath.Join(c.Path(path), "cpu.weight"),
+			[]byte(strconv.FormatUint(convertCPUShares(*cpu.Shares), 10)),
+			defaultFilePerm,
+		); err != nil {
+			return err
+		}
+	}
+	if cpu.Quota != nil || cpu.Period != nil {
+		quota := "max"
+		if cpu.Quota != nil && *cpu.Quota > 0 {
+			quota = strconv.FormatInt(*cpu.Quota, 10)
+		}
+		if cpu.Period != nil {
+			quota += " " + strconv.FormatUint(*cpu.Period, 10)
+		}
+		if err := ioutil.WriteFile(
+			filepath.Join(c.Path(path), "cpu.max"),
+			[]byte(quota),
+			defaultFilePerm,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *cpuV2Controller) Update(path string, resources *Resources) error {
+	return c.Create(path, resources)
+}
+
+// Stat reads cpu.stat, which reports times in microseconds where v1 uses
+// nanoseconds.
+func (c *cpuV2Controller) Stat(path string, stats *Stats) error {
+	raw, err := readKVFile(filepath.Join(c.Path(path), "cpu.stat"))
+	if err != nil {
+		return err
+	}
+	stats.CPU.Usage.Total = raw["usage_usec"] * 1000
+	stats.CPU.Usage.User = raw["user_usec"] * 1000
+	stats.CPU.Usage.Kernel = raw["system_usec"] * 1000
+	stats.CPU.Throttling.Periods = raw["nr_periods"]
+	stats.CPU.Throttling.ThrottledPeriods = raw["nr_throttled"]
+	stats.CPU.Throttling.ThrottledTime = raw["throttled_usec"] * 1000
+	stats.CPU.PSI, err = readPSI(c.Path(path), "cpu.pressure")
+	return err
+}
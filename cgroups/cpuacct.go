@@ -17,12 +17,13 @@
 package cgroups
 
 import (
+	"bufio"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
-
 )
 
 const nanosecondsInSecond = 1000000000
@@ -64,9 +65,47 @@ func (c *cpuacctController) Stat(path string, stats *Stats) error {
 	stats.CPU.Usage.User = user
 	stats.CPU.Usage.Kernel = kernel
 	stats.CPU.Usage.PerCPU = percpu
+	// cpuacct.usage_all is missing before linux 4.15.
+	if stats.Cpuacct, err = c.percpuUserKernel(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
 	return nil
 }
 
+// percpuUserKernel reads the time spent in user and kernel mode on every cpu
+// in nanoseconds from cpuacct.usage_all:
+//
+//	cpu user system
+//	0 344989287794 65204667474
+func (c *cpuacctController) percpuUserKernel(path string) (*CpuacctStat, error) {
+	f, err := os.Open(filepath.Join(c.Path(path), "cpuacct.usage_all"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var (
+		stat = &CpuacctStat{}
+		sc   = bufio.NewScanner(f)
+	)
+	// skip the header
+	sc.Scan()
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid cpuacct.usage_all line %q", sc.Text())
+		}
+		var values [2]uint64
+		for i, v := range fields[1:] {
+			if values[i], err = strconv.ParseUint(v, 10, 64); err != nil {
+				return nil, err
+			}
+		}
+		stat.PerCPUUser = append(stat.PerCPUUser, values[0])
+		stat.PerCPUKernel = append(stat.PerCPUKernel, values[1])
+	}
+	return stat, sc.Err()
+}
+
 func (c *cpuacctController) percpuUsage(path string) ([]uint64, error) {
 	var usage []uint64
 	data, err := ioutil.ReadFile(filepath.Join(c.Path(path), "cpuacct.usage_percpu"))
@@ -0,0 +1,34 @@
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCpuacctPercpuUserKernel(t *testing.T) {
+	mock, err := newMock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.delete()
+	cpuacct := NewCpuacct(mock.root)
+	if err := os.MkdirAll(cpuacct.Path("test"), defaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(
+		filepath.Join(cpuacct.Path("test"), "cpuacct.usage_all"),
+		[]byte("cpu user system\n0 300 100\n1 200 50\n"),
+		defaultFilePerm,
+	); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := cpuacct.percpuUserKernel("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stat.PerCPUUser) != 2 || stat.PerCPUUser[1] != 200 || stat.PerCPUKernel[0] != 100 || stat.PerCPUKernel[1] != 50 {
+		t.Fatalf("unexpected per cpu usage %+v", stat)
+	}
+}
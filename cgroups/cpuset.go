@@ -22,7 +22,6 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
-
 )
 
 func NewCputset(root string) *cpusetController {
@@ -85,6 +84,34 @@ func (c *cpusetController) Update(path string, resources *Resources) error {
 	return c.Create(path, resources)
 }
 
+func (c *cpusetController) Stat(path string, stats *Stats) error {
+	stat := &CpusetStat{}
+	for _, t := range []struct {
+		name  string
+		value *string
+	}{
+		{name: "cpus", value: &stat.Cpus},
+		{name: "mems", value: &stat.Mems},
+		{name: "effective_cpus", value: &stat.EffectiveCpus},
+		{name: "effective_mems", value: &stat.EffectiveMems},
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(c.Path(path), "cpuset."+t.name))
+		if err != nil {
+			return err
+		}
+		*t.value = string(bytes.TrimSpace(data))
+	}
+	// the pressure is only computed with cpuset.memory_pressure_enabled set
+	// in the root cgroup, it reads 0 otherwise.
+	pressure, err := readUint(filepath.Join(c.Path(path), "cpuset.memory_pressure"))
+	if err != nil {
+		return err
+	}
+	stat.MemoryPressure = pressure
+	stats.Cpuset = stat
+	return nil
+}
+
 func (c *cpusetController) getValues(path string) (cpus []byte, mems []byte, err error) {
 	if cpus, err = ioutil.ReadFile(filepath.Join(path, "cpuset.cpus")); err != nil && !os.IsNotExist(err) {
 		return
@@ -156,3 +183,74 @@ func (c *cpusetController) copyIfNeeded(current, parent string) error {
 func isEmpty(b []byte) bool {
 	return len(bytes.Trim(b, "\n")) == 0
 }
+
+// NewCpusetV2 returns the cpuset controller of the unified hierarchy mounted
+// at root. An empty cpuset.cpus or cpuset.mems inherits from the parent, so
+// nothing has to be copied down like in v1.
+func NewCpusetV2(root string) *cpusetV2Controller {
+	return &cpusetV2Controller{
+		root: root,
+	}
+}
+
+type cpusetV2Controller struct {
+	root string
+}
+
+func (c *cpusetV2Controller) Name() Name {
+	return Cpuset
+}
+
+func (c *cpusetV2Controller) Path(path string) string {
+	return filepath.Join(c.root, path)
+}
+
+func (c *cpusetV2Controller) Create(path string, resources *Resources) error {
+	if err := os.MkdirAll(c.Path(path), defaultDirPerm); err != nil {
+		return err
+	}
+	if resources.CPU != nil {
+		for name, value := range map[string]string{
+			"cpus": resources.CPU.Cpus,
+			"mems": resources.CPU.Mems,
+		} {
+			if value != "" {
+				if err := ioutil.WriteFile(
+					filepath.Join(c.Path(path), fmt.Sprintf("cpuset.%s", name)),
+					[]byte(value),
+					defaultFilePerm,
+				); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (c *cpusetV2Controller) Update(path string, resources *Resources) error {
+	return c.Create(path, resources)
+}
+
+// Stat reports the configured and effective cpus and mems, the unified
+// hierarchy has no memory pressure in the cpuset controller.
+func (c *cpusetV2Controller) Stat(path string, stats *Stats) error {
+	stat := &CpusetStat{}
+	for _, t := range []struct {
+		name  string
+		value *string
+	}{
+		{name: "cpus", value: &stat.Cpus},
+		{name: "mems", value: &stat.Mems},
+		{name: "cpus.effective", value: &stat.EffectiveCpus},
+		{name: "mems.effective", value: &stat.EffectiveMems},
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(c.Path(path), "cpuset."+t.name))
+		if err != nil {
+			return err
+		}
+		*t.value = string(bytes.TrimSpace(data))
+	}
+	stats.Cpuset = stat
+	return nil
+}
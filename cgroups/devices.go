@@ -0,0 +1,109 @@
+package cgroups
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// NewDevices returns the v1 devices controller given the root folder of
+// cgroups.
+func NewDevices(root string) *devicesController {
+	return &devicesController{
+		root: filepath.Join(root, string(Devices)),
+	}
+}
+
+type devicesController struct {
+	root string
+}
+
+func (d *devicesController) Name() Name {
+	return Devices
+}
+
+func (d *devicesController) Path(path string) string {
+	return filepath.Join(d.root, path)
+}
+
+// Create denies every device that is not allowed by the rules. The current
+// devices.list is diffed against the rules so that only the changes are
+// written, rewriting a rule that is in place already would briefly deny the
+// device to the running processes of an update.
+func (d *devicesController) Create(path string, resources *Resources) error {
+	if err := os.MkdirAll(d.Path(path), defaultDirPerm); err != nil {
+		return err
+	}
+	if resources.Devices == nil || resources.SkipDevices {
+		return nil
+	}
+	target, err := newDevicesEmulator(resources.Devices)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(filepath.Join(d.Path(path), "devices.list"))
+	if err != nil {
+		return err
+	}
+	current, err := parseDevicesList(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	for _, rule := range current.transition(target) {
+		file := "devices.deny"
+		if rule.Allow {
+			file = "devices.allow"
+		}
+		if err := retryingWriteFile(
+			filepath.Join(d.Path(path), file),
+			[]byte(rule.CgroupString()),
+			defaultFilePerm,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *devicesController) Update(path string, resources *Resources) error {
+	return d.Create(path, resources)
+}
+
+// NewDevicesV2 returns the devices controller of the unified hierarchy
+// mounted at root. The unified hierarchy has no devices files, the rules
+// are enforced by an eBPF program attached to the cgroup.
+func NewDevicesV2(root string) *devicesV2Controller {
+	return &devicesV2Controller{
+		root: root,
+	}
+}
+
+type devicesV2Controller struct {
+	root string
+}
+
+func (d *devicesV2Controller) Name() Name {
+	return Devices
+}
+
+func (d *devicesV2Controller) Path(path string) string {
+	return filepath.Join(d.root, path)
+}
+
+func (d *devicesV2Controller) Create(path string, resources *Resources) error {
+	if err := os.MkdirAll(d.Path(path), defaultDirPerm); err != nil {
+		return err
+	}
+	if resources.Devices == nil || resources.SkipDevices {
+		return nil
+	}
+	e, err := newDevicesEmulator(resources.Devices)
+	if err != nil {
+		return err
+	}
+	return attachDeviceFilter(d.Path(path), deviceFilter(e))
+}
+
+func (d *devicesV2Controller) Update(path string, resources *Resources) error {
+	return d.Create(path, resources)
+}
@@ -0,0 +1,224 @@
+package cgroups
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lipeining/godocker/configs"
+)
+
+// deviceMeta identifies the devices a rule applies to.
+type deviceMeta struct {
+	node  configs.DeviceType
+	major int64
+	minor int64
+}
+
+type deviceRules map[deviceMeta]configs.DevicePermissions
+
+// orderedEntries returns the rules sorted so that the same rules are always
+// written in the same order.
+func (r deviceRules) orderedEntries() []*configs.DeviceRule {
+	var out []*configs.DeviceRule
+	for meta, perms := range r {
+		out = append(out, &configs.DeviceRule{
+			Type:        meta.node,
+			Major:       meta.major,
+			Minor:       meta.minor,
+			Permissions: perms,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Major != b.Major {
+			return a.Major < b.Major
+		}
+		return a.Minor < b.Minor
+	})
+	return out
+}
+
+// devicesEmulator models the state the kernel keeps for the v1 devices
+// cgroup: a default policy and the exceptions to it. Writing to
+// devices.allow or devices.deny is applied to it the way the kernel does,
+// which lets us compute the rules that turn one state into another and build
+// the same policy for the unified hierarchy, which has no devices files.
+type devicesEmulator struct {
+	defaultAllow bool
+	rules        deviceRules
+}
+
+// isBlacklist reports whether every device not listed is allowed.
+func (e *devicesEmulator) isBlacklist() bool {
+	return e.defaultAllow
+}
+
+// isAllowAll reports whether the emulator allows every device.
+func (e *devicesEmulator) isAllowAll() bool {
+	return e.isBlacklist() && len(e.rules) == 0
+}
+
+// apply applies the rule as if it was written to devices.allow or
+// devices.deny.
+func (e *devicesEmulator) apply(rule configs.DeviceRule) error {
+	if !rule.Type.CanCgroup() {
+		return fmt.Errorf("cgroups: device type %q cannot be used in a cgroup rule", rule.Type)
+	}
+	if !rule.Permissions.IsValid() {
+		return fmt.Errorf("cgroups: invalid device permissions %q", rule.Permissions)
+	}
+	if e.rules == nil {
+		e.rules = make(deviceRules)
+	}
+	// A wildcard rule resets the cgroup to allow or deny everything,
+	// regardless of its numbers and permissions.
+	if rule.Type == configs.WildcardDevice {
+		e.defaultAllow = rule.Allow
+		e.rules = make(deviceRules)
+		return nil
+	}
+	meta := deviceMeta{
+		node:  rule.Type,
+		major: rule.Major,
+		minor: rule.Minor,
+	}
+	// A rule that agrees with the default policy removes the permissions
+	// from an exception, the kernel only matches an exception exactly.
+	if rule.Allow == e.defaultAllow {
+		perms := e.rules[meta].Difference(rule.Permissions)
+		if perms.IsEmpty() {
+			delete(e.rules, meta)
+		} else {
+			e.rules[meta] = perms
+		}
+		return nil
+	}
+	e.rules[meta] = e.rules[meta].Union(rule.Permissions)
+	return nil
+}
+
+// transition returns the rules that have to be written to turn the cgroup
+// described by e into target.
+func (e *devicesEmulator) transition(target *devicesEmulator) []*configs.DeviceRule {
+	var (
+		out      []*configs.DeviceRule
+		oldRules = e.rules
+	)
+	// devices.list does not show the exceptions of a blacklist, so we cannot
+	// know them and start over with a wildcard rule, as we have to when the
+	// default policy changes.
+	if e.isBlacklist() || e.defaultAllow != target.defaultAllow {
+		out = append(out, &configs.DeviceRule{
+			Type:        configs.WildcardDevice,
+			Major:       configs.Wildcard,
+			Minor:       configs.Wildcard,
+			Permissions: "rwm",
+			Allow:       target.defaultAllow,
+		})
+		oldRules = nil
+	}
+	// drop the permissions that the target does not have.
+	for _, rule := range oldRules.orderedEntries() {
+		meta := deviceMeta{rule.Type, rule.Major, rule.Minor}
+		if dropped := rule.Permissions.Difference(target.rules[meta]); !dropped.IsEmpty() {
+			rule.Permissions = dropped
+			rule.Allow = target.defaultAllow
+			out = append(out, rule)
+		}
+	}
+	// and add the ones it gained.
+	for _, rule := range target.rules.orderedEntries() {
+		meta := deviceMeta{rule.Type, rule.Major, rule.Minor}
+		if gained := rule.Permissions.Difference(oldRules[meta]); !gained.IsEmpty() {
+			rule.Permissions = gained
+			rule.Allow = !target.defaultAllow
+			out = append(out, rule)
+		}
+	}
+	return out
+}
+
+// newDevicesEmulator returns the state that results from applying the rules
+// to a cgroup that denies every device.
+func newDevicesEmulator(rules []*configs.DeviceRule) (*devicesEmulator, error) {
+	e := &devicesEmulator{
+		rules: make(deviceRules),
+	}
+	for _, rule := range rules {
+		if err := e.apply(*rule); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// parseDevicesList reads the state of a cgroup from its devices.list. The
+// kernel lists "a *:* rwm" for a cgroup that allows everything, otherwise
+// every line is an allowed exception.
+//
+//	c 1:3 rwm
+//	b *:* m
+func parseDevicesList(r io.Reader) (*devicesEmulator, error) {
+	var (
+		e  = &devicesEmulator{rules: make(deviceRules)}
+		sc = bufio.NewScanner(r)
+	)
+	for sc.Scan() {
+		rule, err := parseDeviceLine(sc.Text())
+		if err != nil {
+			return nil, err
+		}
+		if rule.Type == configs.WildcardDevice {
+			if len(e.rules) != 0 {
+				return nil, fmt.Errorf("cgroups: devices.list has a wildcard rule next to others")
+			}
+			e.defaultAllow = true
+			continue
+		}
+		if e.defaultAllow {
+			return nil, fmt.Errorf("cgroups: devices.list has rules next to a wildcard rule")
+		}
+		if err := e.apply(*rule); err != nil {
+			return nil, err
+		}
+	}
+	return e, sc.Err()
+}
+
+func parseDeviceLine(line string) (*configs.DeviceRule, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("cgroups: invalid devices.list entry %q", line)
+	}
+	numbers := strings.SplitN(fields[1], ":", 2)
+	if len(fields[0]) != 1 || len(numbers) != 2 {
+		return nil, fmt.Errorf("cgroups: invalid devices.list entry %q", line)
+	}
+	rule := &configs.DeviceRule{
+		Type:        configs.DeviceType(fields[0][0]),
+		Permissions: configs.DevicePermissions(fields[2]),
+		Allow:       true,
+	}
+	for i, n := range numbers {
+		v := int64(configs.Wildcard)
+		if n != "*" {
+			var err error
+			if v, err = strconv.ParseInt(n, 10, 64); err != nil {
+				return nil, fmt.Errorf("cgroups: invalid devices.list entry %q: %v", line, err)
+			}
+		}
+		if i == 0 {
+			rule.Major = v
+		} else {
+			rule.Minor = v
+		}
+	}
+	return rule, nil
+}
@@ -0,0 +1,307 @@
+package cgroups
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"unsafe"
+
+	"github.com/lipeining/godocker/configs"
+	"golang.org/x/sys/unix"
+)
+
+// bpfInsn is struct bpf_insn, its dst_reg and src_reg bitfields share regs,
+// in an order that depends on the byte order of the machine.
+type bpfInsn struct {
+	code uint8
+	regs uint8
+	off  int16
+	imm  int32
+}
+
+// The eBPF instructions the device filter is made of.
+const (
+	bpfLdxMemW = 0x61 // BPF_LDX | BPF_MEM | BPF_W
+	bpfAndK    = 0x54 // BPF_ALU | BPF_AND | BPF_K
+	bpfRshK    = 0x74 // BPF_ALU | BPF_RSH | BPF_K
+	bpfMovX    = 0xbc // BPF_ALU | BPF_MOV | BPF_X
+	bpfMov64K  = 0xb7 // BPF_ALU64 | BPF_MOV | BPF_K
+	bpfJeqK    = 0x15 // BPF_JMP | BPF_JEQ | BPF_K
+	bpfJneK    = 0x55 // BPF_JMP | BPF_JNE | BPF_K
+	bpfExit    = 0x95 // BPF_JMP | BPF_EXIT
+)
+
+// Values of struct bpf_cgroup_dev_ctx, access_type holds the access in its
+// upper and the device type in its lower 16 bits.
+const (
+	bpfDevcgDevBlock = 1
+	bpfDevcgDevChar  = 2
+
+	bpfDevcgAccMknod = 1
+	bpfDevcgAccRead  = 2
+	bpfDevcgAccWrite = 4
+)
+
+// littleEndian tells whether the bitfields of bpfInsn start at the low bits.
+var littleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+func insn(code, dst, src uint8, off int16, imm int32) bpfInsn {
+	regs := src<<4 | dst
+	if !littleEndian {
+		regs = dst<<4 | src
+	}
+	return bpfInsn{
+		code: code,
+		regs: regs,
+		off:  off,
+		imm:  imm,
+	}
+}
+
+func deviceAccess(perms configs.DevicePermissions) int32 {
+	var access int32
+	for _, p := range perms {
+		switch p {
+		case 'm':
+			access |= bpfDevcgAccMknod
+		case 'r':
+			access |= bpfDevcgAccRead
+		case 'w':
+			access |= bpfDevcgAccWrite
+		}
+	}
+	return access
+}
+
+// deviceFilter compiles the state of the emulator into a
+// BPF_PROG_TYPE_CGROUP_DEVICE program. Every exception becomes a block that
+// jumps to the next one unless the device matches, the program ends with the
+// default policy:
+//
+//	r2 = type, r3 = access, r4 = major, r5 = minor
+//	if r2 != type goto next
+//	if access is not allowed by the exception goto next
+//	if r4 != major goto next
+//	if r5 != minor goto next
+//	return !default
+//	next: ...
+//	return default
+func deviceFilter(e *devicesEmulator) []bpfInsn {
+	result := func(allow bool) []bpfInsn {
+		var v int32
+		if allow {
+			v = 1
+		}
+		return []bpfInsn{
+			insn(bpfMov64K, 0, 0, 0, v),
+			insn(bpfExit, 0, 0, 0, 0),
+		}
+	}
+	prog := []bpfInsn{
+		insn(bpfLdxMemW, 2, 1, 0, 0),
+		insn(bpfAndK, 2, 0, 0, 0xffff),
+		insn(bpfLdxMemW, 3, 1, 0, 0),
+		insn(bpfRshK, 3, 0, 0, 16),
+		insn(bpfLdxMemW, 4, 1, 4, 0),
+		insn(bpfLdxMemW, 5, 1, 8, 0),
+	}
+	for _, rule := range e.rules.orderedEntries() {
+		// the jumps are patched to skip to the end of the block.
+		var block []bpfInsn
+		switch rule.Type {
+		case configs.BlockDevice:
+			block = append(block, insn(bpfJneK, 2, 0, 0, bpfDevcgDevBlock))
+		case configs.CharDevice:
+			block = append(block, insn(bpfJneK, 2, 0, 0, bpfDevcgDevChar))
+		}
+		access := deviceAccess(rule.Permissions)
+		if e.defaultAllow {
+			// a denied exception matches if any of the access is denied.
+			block = append(block,
+				insn(bpfMovX, 1, 3, 0, 0),
+				insn(bpfAndK, 1, 0, 0, access),
+				insn(bpfJeqK, 1, 0, 0, 0),
+			)
+		} else if rwm := int32(bpfDevcgAccMknod | bpfDevcgAccRead | bpfDevcgAccWrite); access != rwm {
+			// an allowed exception matches if all of the access is allowed.
+			block = append(block,
+				insn(bpfMovX, 1, 3, 0, 0),
+				insn(bpfAndK, 1, 0, 0, ^access&rwm),
+				insn(bpfJneK, 1, 0, 0, 0),
+			)
+		}
+		if rule.Major != configs.Wildcard {
+			block = append(block, insn(bpfJneK, 4, 0, 0, int32(rule.Major)))
+		}
+		if rule.Minor != configs.Wildcard {
+			block = append(block, insn(bpfJneK, 5, 0, 0, int32(rule.Minor)))
+		}
+		block = append(block, result(!e.defaultAllow)...)
+		for i := range block {
+			if block[i].code == bpfJneK || block[i].code == bpfJeqK {
+				block[i].off = int16(len(block) - i - 1)
+			}
+		}
+		prog = append(prog, block...)
+	}
+	return append(prog, result(e.defaultAllow)...)
+}
+
+// union bpf_attr for BPF_PROG_LOAD
+type bpfProgLoadAttr struct {
+	progType    uint32
+	insnCnt     uint32
+	insns       uint64
+	license     uint64
+	logLevel    uint32
+	logSize     uint32
+	logBuf      uint64
+	kernVersion uint32
+	progFlags   uint32
+}
+
+// union bpf_attr for BPF_PROG_ATTACH and BPF_PROG_DETACH
+type bpfProgAttachAttr struct {
+	targetFd    uint32
+	attachBpfFd uint32
+	attachType  uint32
+	attachFlags uint32
+}
+
+// union bpf_attr for BPF_PROG_QUERY
+type bpfProgQueryAttr struct {
+	targetFd    uint32
+	attachType  uint32
+	queryFlags  uint32
+	attachFlags uint32
+	progIds     uint64
+	progCnt     uint32
+	_           uint32
+}
+
+// union bpf_attr for BPF_PROG_GET_FD_BY_ID
+type bpfGetFdByIDAttr struct {
+	id        uint32
+	nextID    uint32
+	openFlags uint32
+}
+
+func bpf(cmd int, attr unsafe.Pointer, size uintptr) (int, error) {
+	fd, _, errno := unix.Syscall(unix.SYS_BPF, uintptr(cmd), uintptr(attr), size)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// loadDeviceFilter loads the program into the kernel and returns its fd. The
+// verifier log is only asked for to explain a failure.
+func loadDeviceFilter(insns []bpfInsn) (int, error) {
+	license := []byte("Apache\x00")
+	attr := bpfProgLoadAttr{
+		progType: unix.BPF_PROG_TYPE_CGROUP_DEVICE,
+		insnCnt:  uint32(len(insns)),
+		insns:    uint64(uintptr(unsafe.Pointer(&insns[0]))),
+		license:  uint64(uintptr(unsafe.Pointer(&license[0]))),
+	}
+	fd, err := bpf(unix.BPF_PROG_LOAD, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	if err != nil {
+		log := make([]byte, 64*1024)
+		attr.logLevel = 1
+		attr.logSize = uint32(len(log))
+		attr.logBuf = uint64(uintptr(unsafe.Pointer(&log[0])))
+		if _, lerr := bpf(unix.BPF_PROG_LOAD, unsafe.Pointer(&attr), unsafe.Sizeof(attr)); lerr != nil {
+			err = fmt.Errorf("%v: %s", err, bytesToString(log))
+		}
+	}
+	runtime.KeepAlive(insns)
+	runtime.KeepAlive(license)
+	if err != nil {
+		return -1, fmt.Errorf("cgroups: loading device filter: %v", err)
+	}
+	return fd, nil
+}
+
+func bytesToString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+// attachDeviceFilter attaches the program to the cgroup at path and then
+// detaches the programs attached before it, so that there is no window in
+// which the cgroup is without a filter.
+func attachDeviceFilter(path string, insns []bpfInsn) error {
+	dir, err := os.OpenFile(path, unix.O_DIRECTORY|os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	old, flags, err := queryDeviceFilters(int(dir.Fd()))
+	if err != nil {
+		return err
+	}
+	fd, err := loadDeviceFilter(insns)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	attr := bpfProgAttachAttr{
+		targetFd:    uint32(dir.Fd()),
+		attachBpfFd: uint32(fd),
+		attachType:  unix.BPF_CGROUP_DEVICE,
+		attachFlags: unix.BPF_F_ALLOW_MULTI,
+	}
+	if len(old) > 0 && flags&unix.BPF_F_ALLOW_MULTI == 0 {
+		// a program attached without BPF_F_ALLOW_MULTI can only be
+		// replaced by one attached with the same flags, which detaches it.
+		attr.attachFlags = flags
+		old = nil
+	}
+	if _, err := bpf(unix.BPF_PROG_ATTACH, unsafe.Pointer(&attr), unsafe.Sizeof(attr)); err != nil {
+		if err == unix.EPERM {
+			return fmt.Errorf("cgroups: attaching device filter to %s: %v, a parent cgroup may have a device filter that does not allow overriding it", path, err)
+		}
+		return fmt.Errorf("cgroups: attaching device filter to %s: %v", path, err)
+	}
+	// BPF_PROG_DETACH refuses any flags.
+	attr.attachFlags = 0
+	for _, id := range old {
+		idAttr := bpfGetFdByIDAttr{id: id}
+		oldFd, err := bpf(unix.BPF_PROG_GET_FD_BY_ID, unsafe.Pointer(&idAttr), unsafe.Sizeof(idAttr))
+		if err != nil {
+			return fmt.Errorf("cgroups: getting device filter %d: %v", id, err)
+		}
+		attr.attachBpfFd = uint32(oldFd)
+		_, err = bpf(unix.BPF_PROG_DETACH, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+		unix.Close(oldFd)
+		if err != nil {
+			return fmt.Errorf("cgroups: detaching device filter %d from %s: %v", id, path, err)
+		}
+	}
+	return nil
+}
+
+// queryDeviceFilters returns the ids of the device programs attached to the
+// cgroup itself and the flags they were attached with.
+func queryDeviceFilters(dirFd int) ([]uint32, uint32, error) {
+	ids := make([]uint32, 64)
+	attr := bpfProgQueryAttr{
+		targetFd:   uint32(dirFd),
+		attachType: unix.BPF_CGROUP_DEVICE,
+		progIds:    uint64(uintptr(unsafe.Pointer(&ids[0]))),
+		progCnt:    uint32(len(ids)),
+	}
+	_, err := bpf(unix.BPF_PROG_QUERY, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	runtime.KeepAlive(ids)
+	if err != nil {
+		return nil, 0, fmt.Errorf("cgroups: querying device filters: %v", err)
+	}
+	return ids[:attr.progCnt], attr.attachFlags, nil
+}
@@ -0,0 +1,149 @@
+package cgroups
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lipeining/godocker/configs"
+)
+
+var testDeviceRules = []*configs.DeviceRule{
+	{Type: configs.WildcardDevice, Major: -1, Minor: -1, Permissions: "rwm", Allow: false},
+	{Type: configs.CharDevice, Major: -1, Minor: -1, Permissions: "m", Allow: true},
+	{Type: configs.CharDevice, Major: 1, Minor: 3, Permissions: "rwm", Allow: true},
+	{Type: configs.CharDevice, Major: 1, Minor: 5, Permissions: "rw", Allow: true},
+	{Type: configs.CharDevice, Major: 1, Minor: 5, Permissions: "w", Allow: false},
+}
+
+func TestDevicesEmulatorApply(t *testing.T) {
+	e, err := newDevicesEmulator(testDeviceRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.isBlacklist() {
+		t.Fatal("expected a whitelist after a deny all rule")
+	}
+	expected := deviceRules{
+		{configs.CharDevice, -1, -1}: "m",
+		{configs.CharDevice, 1, 3}:   "rwm",
+		{configs.CharDevice, 1, 5}:   "r",
+	}
+	if len(e.rules) != len(expected) {
+		t.Fatalf("expected rules %v but received %v", expected, e.rules)
+	}
+	for meta, perms := range expected {
+		if e.rules[meta] != perms {
+			t.Fatalf("expected rules %v but received %v", expected, e.rules)
+		}
+	}
+	if err := e.apply(configs.DeviceRule{Type: configs.FifoDevice, Permissions: "rwm"}); err == nil {
+		t.Fatal("expected an error for a fifo rule")
+	}
+}
+
+func TestDevicesEmulatorTransition(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		list     string
+		expected []string
+	}{
+		{
+			name: "allow all",
+			list: "a *:* rwm\n",
+			expected: []string{
+				"deny a *:* rwm",
+				"allow c *:* m",
+				"allow c 1:3 rwm",
+				"allow c 1:5 r",
+			},
+		},
+		{
+			name: "whitelist",
+			list: "c 1:3 rwm\nc 1:5 rwm\nc 1:7 rwm\n",
+			expected: []string{
+				"deny c 1:5 wm",
+				"deny c 1:7 rwm",
+				"allow c *:* m",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			current, err := parseDevicesList(strings.NewReader(tc.list))
+			if err != nil {
+				t.Fatal(err)
+			}
+			target, err := newDevicesEmulator(testDeviceRules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var rules []string
+			for _, rule := range current.transition(target) {
+				action := "deny"
+				if rule.Allow {
+					action = "allow"
+				}
+				rules = append(rules, action+" "+rule.CgroupString())
+			}
+			if strings.Join(rules, "\n") != strings.Join(tc.expected, "\n") {
+				t.Fatalf("expected rules\n%s\nbut received\n%s", strings.Join(tc.expected, "\n"), strings.Join(rules, "\n"))
+			}
+		})
+	}
+}
+
+func TestDevicesCreate(t *testing.T) {
+	mock, err := newMock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.delete()
+	devices := NewDevices(mock.root)
+	if err := devices.Create("test", &Resources{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(mock.root, "devices", "test", "devices.list"), []byte("a *:* rwm\n"), defaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := devices.Create("test", &Resources{Devices: testDeviceRules}); err != nil {
+		t.Fatal(err)
+	}
+	// the mock files keep the last write only.
+	for file, expected := range map[string]string{
+		"devices.deny":  "a *:* rwm",
+		"devices.allow": "c 1:5 r",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(mock.root, "devices", "test", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Fatalf("expected %q in %s but received %q", expected, file, data)
+		}
+	}
+}
+
+func TestDeviceFilter(t *testing.T) {
+	e, err := newDevicesEmulator(testDeviceRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog := deviceFilter(e)
+	// 6 for the prologue, c *:* m checks type and access, c 1:3 rwm type,
+	// major and minor, c 1:5 r all of them, each with 2 to return, and 2 for
+	// the default.
+	if expected := 6 + (1 + 3 + 2) + (3 + 2) + (1 + 3 + 2 + 2) + 2; len(prog) != expected {
+		t.Fatalf("expected %d instructions but received %d", expected, len(prog))
+	}
+	last := prog[len(prog)-2]
+	if last.code != bpfMov64K || last.imm != 0 {
+		t.Fatalf("expected the program to deny by default, got %+v", last)
+	}
+	// the jumps of the c 1:3 block go to the start of the next block.
+	for i, ins := range prog[12:17] {
+		if ins.code == bpfJneK && int(ins.off) != 4-i {
+			t.Fatalf("instruction %d jumps %d instead of %d", 12+i, ins.off, 4-i)
+		}
+	}
+}
@@ -29,6 +29,8 @@ var (
 	ErrMemoryNotSupported       = errors.New("cgroups: memory cgroup not supported on this system")
 	ErrCgroupDeleted            = errors.New("cgroups: cgroup deleted")
 	ErrNoCgroupMountDestination = errors.New("cgroups: cannot find cgroup mount destination")
+	ErrRealtimeNotSupported     = errors.New("cgroups: realtime scheduling is not supported on the unified hierarchy")
+	ErrPSINotSupported          = errors.New("cgroups: pressure stall information is only available on the unified hierarchy")
 )
 
 // ErrorHandler is a function that handles and acts on errors
@@ -0,0 +1,209 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cgroups
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// freezeTimeout bounds how long we wait for a cgroup to become frozen.
+const freezeTimeout = 5 * time.Second
+
+var errFreezeTimeout = errors.New("cgroups: timed out waiting for the cgroup to freeze")
+
+func NewFreezer(root string) *freezerController {
+	return &freezerController{
+		root: filepath.Join(root, string(Freezer)),
+	}
+}
+
+type freezerController struct {
+	root string
+}
+
+func (f *freezerController) Name() Name {
+	return Freezer
+}
+
+func (f *freezerController) Path(path string) string {
+	return filepath.Join(f.root, path)
+}
+
+// Freeze writes FROZEN until the kernel reports it. The kernel leaves the
+// cgroup in FREEZING while processes keep appearing in it, e.g. because of a
+// concurrent exec, so the write is retried and the cgroup briefly thawed now
+// and then to let the freeze catch up.
+func (f *freezerController) Freeze(path string) error {
+	deadline := time.Now().Add(freezeTimeout)
+	for i := 0; time.Now().Before(deadline); i++ {
+		if i%50 == 49 {
+			f.changeState(path, Thawed)
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err := f.changeState(path, Frozen); err != nil {
+			return err
+		}
+		state, err := f.State(path)
+		if err != nil {
+			return err
+		}
+		switch state {
+		case Frozen:
+			return nil
+		case Freezing:
+			time.Sleep(time.Millisecond)
+		default:
+			return fmt.Errorf("cgroups: unexpected freezer state %q while freezing", state)
+		}
+	}
+	// leaving the cgroup stuck in FREEZING is worse than not freezing it.
+	f.changeState(path, Thawed)
+	return errFreezeTimeout
+}
+
+func (f *freezerController) Thaw(path string) error {
+	if err := f.changeState(path, Thawed); err != nil {
+		return err
+	}
+	state, err := f.State(path)
+	if err != nil {
+		return err
+	}
+	if state != Thawed {
+		return fmt.Errorf("cgroups: unexpected freezer state %q while thawing", state)
+	}
+	return nil
+}
+
+func (f *freezerController) changeState(path string, state State) error {
+	return ioutil.WriteFile(
+		filepath.Join(f.root, path, "freezer.state"),
+		[]byte(strings.ToUpper(string(state))),
+		defaultFilePerm,
+	)
+}
+
+func (f *freezerController) State(path string) (State, error) {
+	current, err := ioutil.ReadFile(filepath.Join(f.root, path, "freezer.state"))
+	if err != nil {
+		return "", err
+	}
+	return State(strings.ToLower(strings.TrimSpace(string(current)))), nil
+}
+
+// NewFreezerV2 returns the freezer of the unified hierarchy mounted at root,
+// it is part of every cgroup v2 cgroup except for the root one.
+func NewFreezerV2(root string) *freezerV2Controller {
+	return &freezerV2Controller{
+		root: root,
+	}
+}
+
+type freezerV2Controller struct {
+	root string
+}
+
+func (f *freezerV2Controller) Name() Name {
+	return Freezer
+}
+
+func (f *freezerV2Controller) Path(path string) string {
+	return filepath.Join(f.root, path)
+}
+
+func (f *freezerV2Controller) Freeze(path string) error {
+	return f.setState(path, Frozen)
+}
+
+func (f *freezerV2Controller) Thaw(path string) error {
+	return f.setState(path, Thawed)
+}
+
+// setState writes cgroup.freeze and waits for the frozen key of
+// cgroup.events to follow, the kernel notifies pollers of cgroup.events when
+// it changes.
+func (f *freezerV2Controller) setState(path string, state State) error {
+	value := "0"
+	if state == Frozen {
+		value = "1"
+	}
+	events, err := os.Open(filepath.Join(f.Path(path), "cgroup.events"))
+	if err != nil {
+		return err
+	}
+	defer events.Close()
+	if err := ioutil.WriteFile(filepath.Join(f.Path(path), "cgroup.freeze"), []byte(value), defaultFilePerm); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(freezeTimeout)
+	for {
+		current, err := f.State(path)
+		if err != nil {
+			return err
+		}
+		if current == state {
+			return nil
+		}
+		timeout := time.Until(deadline)
+		if timeout <= 0 {
+			if state == Frozen {
+				f.setState(path, Thawed)
+				return errFreezeTimeout
+			}
+			return fmt.Errorf("cgroups: timed out waiting for the cgroup to be %s", state)
+		}
+		fds := []unix.PollFd{{Fd: int32(events.Fd()), Events: unix.POLLPRI}}
+		if _, err := unix.Poll(fds, int(timeout/time.Millisecond)+1); err != nil && err != unix.EINTR {
+			return err
+		}
+	}
+}
+
+// State reports Freezing while cgroup.freeze has been written but the
+// processes have not all stopped yet, and Frozen until a thaw completes.
+func (f *freezerV2Controller) State(path string) (State, error) {
+	want, err := ioutil.ReadFile(filepath.Join(f.Path(path), "cgroup.freeze"))
+	if err != nil {
+		return "", err
+	}
+	frozen := false
+	events, err := ioutil.ReadFile(filepath.Join(f.Path(path), "cgroup.events"))
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(events), "\n") {
+		if line == "frozen 1" {
+			frozen = true
+		}
+	}
+	switch {
+	case frozen:
+		// still frozen while a thaw is in progress.
+		return Frozen, nil
+	case strings.TrimSpace(string(want)) == "1":
+		return Freezing, nil
+	}
+	return Thawed, nil
+}
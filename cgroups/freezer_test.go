@@ -0,0 +1,55 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package cgroups
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFreezer(t *testing.T) {
+	mock, err := newMock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.delete()
+	freezer := NewFreezer(mock.root)
+	if err := os.MkdirAll(freezer.Path("test"), defaultDirPerm); err != nil {
+		t.Fatal(err)
+	}
+	// the mock file takes whatever is written, so the state is reached at once.
+	if err := freezer.Freeze("test"); err != nil {
+		t.Fatal(err)
+	}
+	state, err := freezer.State("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != Frozen {
+		t.Fatalf("expected state %q but received %q", Frozen, state)
+	}
+	if err := freezer.Thaw("test"); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ = freezer.State("test"); state != Thawed {
+		t.Fatalf("expected state %q but received %q", Thawed, state)
+	}
+	if _, err := os.Stat(filepath.Join(mock.root, "freezer", "test", "freezer.state")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,184 @@
+package cgroups
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const hugePagesDir = "/sys/kernel/mm/hugepages"
+
+var (
+	hugePageSizes    []string
+	hugePageSizesErr error
+	checkHugePages   sync.Once
+)
+
+// HugePageSizes returns the huge page sizes supported by the kernel in the
+// format the hugetlb controller uses in its file names, e.g. "2MB" or "1GB".
+// A kernel without huge pages supports no sizes.
+func HugePageSizes() ([]string, error) {
+	checkHugePages.Do(func() {
+		hugePageSizes, hugePageSizesErr = readHugePageSizes(hugePagesDir)
+	})
+	return hugePageSizes, hugePageSizesErr
+}
+
+func readHugePageSizes(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var sizes []string
+	for _, info := range infos {
+		size, err := hugePageSize(info.Name())
+		if err != nil {
+			return nil, err
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
+}
+
+// hugePageSize turns the name of a directory in /sys/kernel/mm/hugepages,
+// e.g. hugepages-2048kB, into the size used by the hugetlb controller.
+func hugePageSize(name string) (string, error) {
+	if !strings.HasPrefix(name, "hugepages-") || !strings.HasSuffix(name, "kB") {
+		return "", fmt.Errorf("cgroups: invalid huge page directory %q", name)
+	}
+	kb, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "hugepages-"), "kB"), 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("cgroups: invalid huge page directory %q: %v", name, err)
+	}
+	size, units := float64(kb)*1024, []string{"B", "KB", "MB", "GB", "TB", "PB"}
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	return fmt.Sprintf("%g%s", size, units[i]), nil
+}
+
+func NewHugetlb(root string) *hugetlbController {
+	sizes, _ := HugePageSizes()
+	return &hugetlbController{
+		root:  filepath.Join(root, string(Hugetlb)),
+		sizes: sizes,
+	}
+}
+
+// NewHugetlbV2 returns the hugetlb controller of the unified hierarchy
+// mounted at root, it names the limit of a page size max instead of
+// limit_in_bytes.
+func NewHugetlbV2(root string) *hugetlbController {
+	sizes, _ := HugePageSizes()
+	return &hugetlbController{
+		root:    root,
+		sizes:   sizes,
+		unified: true,
+	}
+}
+
+type hugetlbController struct {
+	root    string
+	sizes   []string
+	unified bool
+}
+
+func (h *hugetlbController) Name() Name {
+	return Hugetlb
+}
+
+func (h *hugetlbController) Path(path string) string {
+	return filepath.Join(h.root, path)
+}
+
+func (h *hugetlbController) supports(size string) bool {
+	for _, s := range h.sizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *hugetlbController) Create(path string, resources *Resources) error {
+	if err := os.MkdirAll(h.Path(path), defaultDirPerm); err != nil {
+		return err
+	}
+	file := "limit_in_bytes"
+	if h.unified {
+		file = "max"
+	}
+	for _, limit := range resources.HugepageLimits {
+		if !h.supports(limit.Pagesize) {
+			return fmt.Errorf("cgroups: huge page size %q is not supported, supported sizes are %v", limit.Pagesize, h.sizes)
+		}
+		if err := retryingWriteFile(
+			filepath.Join(h.Path(path), strings.Join([]string{"hugetlb", limit.Pagesize, file}, ".")),
+			[]byte(strconv.FormatUint(limit.Limit, 10)),
+			defaultFilePerm,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *hugetlbController) Update(path string, resources *Resources) error {
+	return h.Create(path, resources)
+}
+
+func (h *hugetlbController) Stat(path string, stats *Stats) error {
+	for _, size := range h.sizes {
+		s, err := h.readSizeStat(path, size)
+		if err != nil {
+			return err
+		}
+		stats.Hugetlb = append(stats.Hugetlb, s)
+	}
+	return nil
+}
+
+// readSizeStat reads the usage of one page size. The unified hierarchy has
+// no maximum usage and counts the failed allocations in the max event.
+func (h *hugetlbController) readSizeStat(path, size string) (*HugetlbStat, error) {
+	prefix := filepath.Join(h.Path(path), "hugetlb."+size)
+	s := &HugetlbStat{
+		Pagesize: size,
+	}
+	if h.unified {
+		usage, err := readUint(prefix + ".current")
+		if err != nil {
+			return nil, err
+		}
+		events, err := readKVFile(prefix + ".events")
+		if err != nil {
+			return nil, err
+		}
+		s.Usage, s.Failcnt = usage, events["max"]
+		return s, nil
+	}
+	for _, f := range []struct {
+		name  string
+		value *uint64
+	}{
+		{name: "usage_in_bytes", value: &s.Usage},
+		{name: "max_usage_in_bytes", value: &s.Max},
+		{name: "failcnt", value: &s.Failcnt},
+	} {
+		v, err := readUint(prefix + "." + f.name)
+		if err != nil {
+			return nil, err
+		}
+		*f.value = v
+	}
+	return s, nil
+}
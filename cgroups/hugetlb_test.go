@@ -0,0 +1,82 @@
+package cgroups
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHugePageSize(t *testing.T) {
+	for name, expected := range map[string]string{
+		"hugepages-64kB":      "64KB",
+		"hugepages-2048kB":    "2MB",
+		"hugepages-32768kB":   "32MB",
+		"hugepages-1048576kB": "1GB",
+	} {
+		size, err := hugePageSize(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != expected {
+			t.Fatalf("expected size %q for %s but received %q", expected, name, size)
+		}
+	}
+	if _, err := hugePageSize("hugepages-2MB"); err == nil {
+		t.Fatal("expected an error for an invalid directory name")
+	}
+}
+
+func TestHugetlb(t *testing.T) {
+	mock, err := newMock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.delete()
+	hugetlb := &hugetlbController{
+		root:  filepath.Join(mock.root, string(Hugetlb)),
+		sizes: []string{"2MB", "1GB"},
+	}
+	resources := &Resources{
+		HugepageLimits: []HugepageLimit{{Pagesize: "2MB", Limit: 4194304}},
+	}
+	if err := hugetlb.Create("test", resources); err != nil {
+		t.Fatal(err)
+	}
+	dir := hugetlb.Path("test")
+	data, err := ioutil.ReadFile(filepath.Join(dir, "hugetlb.2MB.limit_in_bytes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "4194304" {
+		t.Fatalf("expected limit 4194304 but received %q", data)
+	}
+	resources.HugepageLimits[0].Pagesize = "16MB"
+	if err := hugetlb.Create("test", resources); err == nil {
+		t.Fatal("expected an error for an unsupported page size")
+	}
+
+	for _, size := range hugetlb.sizes {
+		for file, value := range map[string]string{
+			"usage_in_bytes":     "2097152",
+			"max_usage_in_bytes": "4194304",
+			"failcnt":            "1",
+		} {
+			name := strings.Join([]string{"hugetlb", size, file}, ".")
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(value), defaultFilePerm); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	var stats Stats
+	if err := hugetlb.Stat("test", &stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Hugetlb) != 2 {
+		t.Fatalf("expected stats for 2 page sizes but received %d", len(stats.Hugetlb))
+	}
+	s := stats.Hugetlb[1]
+	if s.Pagesize != "1GB" || s.Usage != 2097152 || s.Max != 4194304 || s.Failcnt != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
@@ -0,0 +1,112 @@
+package cgroups
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// NewIo returns the io controller of the unified hierarchy mounted at root,
+// it replaces blkio of v1.
+func NewIo(root string) *ioController {
+	return &ioController{
+		root: root,
+	}
+}
+
+type ioController struct {
+	root string
+}
+
+func (i *ioController) Name() Name {
+	return Io
+}
+
+func (i *ioController) Path(path string) string {
+	return filepath.Join(i.root, path)
+}
+
+// Create maps the blkio weight onto the default io.weight, the leaf weight
+// has no equivalent.
+func (i *ioController) Create(path string, resources *Resources) error {
+	if err := os.MkdirAll(i.Path(path), defaultDirPerm); err != nil {
+		return err
+	}
+	if resources.BlockIO != nil && resources.BlockIO.Weight != 0 {
+		return ioutil.WriteFile(
+			filepath.Join(i.Path(path), "io.weight"),
+			[]byte(fmt.Sprintf("default %d", convertBlkioWeight(resources.BlockIO.Weight))),
+			defaultFilePerm,
+		)
+	}
+	return nil
+}
+
+func (i *ioController) Update(path string, resources *Resources) error {
+	return i.Create(path, resources)
+}
+
+// Stat reads io.stat into the bytes and operations serviced of the blkio
+// stats, e.g.
+//
+//	8:0 rbytes=90112 wbytes=4096 rios=3 wios=1 dbytes=0 dios=0
+func (i *ioController) Stat(path string, stats *Stats) error {
+	f, err := os.Open(filepath.Join(i.Path(path), "io.stat"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	blkio := &BlkIOStat{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var major, minor uint64
+		if _, err := fmt.Sscanf(fields[0], "%d:%d", &major, &minor); err != nil {
+			return fmt.Errorf("invalid device %q in io.stat: %v", fields[0], err)
+		}
+		for _, kv := range fields[1:] {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 {
+				return ErrInvalidFormat
+			}
+			v, err := strconv.ParseUint(parts[1], 10, 64)
+			if err != nil {
+				return err
+			}
+			entry := &BlkIOEntry{
+				Major: major,
+				Minor: minor,
+				Value: v,
+			}
+			switch parts[0] {
+			case "rbytes":
+				entry.Op = "Read"
+				blkio.IoServiceBytesRecursive = append(blkio.IoServiceBytesRecursive, entry)
+			case "wbytes":
+				entry.Op = "Write"
+				blkio.IoServiceBytesRecursive = append(blkio.IoServiceBytesRecursive, entry)
+			case "rios":
+				entry.Op = "Read"
+				blkio.IoServicedRecursive = append(blkio.IoServicedRecursive, entry)
+			case "wios":
+				entry.Op = "Write"
+				blkio.IoServicedRecursive = append(blkio.IoServicedRecursive, entry)
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	if blkio.PSI, err = readPSI(i.Path(path), "io.pressure"); err != nil {
+		return err
+	}
+	stats.Blkio = blkio
+	return nil
+}
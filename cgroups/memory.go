@@ -18,6 +18,8 @@ package cgroups
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -25,6 +27,9 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
 )
 
 // NewMemory returns a Memory controller given the root folder of cgroups.
@@ -92,7 +97,7 @@ func (m *memoryController) Create(path string, resources *Resources) error {
 				[]byte(strconv.FormatInt(i, 10)),
 				defaultFilePerm,
 			); err != nil {
-				return checkEBUSY(err)
+				return checkEBUSY("kmem.limit_in_bytes", err)
 			}
 		}
 	}
@@ -108,14 +113,14 @@ func (m *memoryController) Update(path string, resources *Resources) error {
 	}
 	settings := getMemorySettings(resources)
 	if g(resources.Memory.Limit) && g(resources.Memory.Swap) {
-		// if the updated swap value is larger than the current memory limit set the swap changes first
+		// if the updated memory limit is larger than the current swap limit set the swap changes first
 		// then set the memory limit as swap must always be larger than the current limit
-		current, err := readUint(filepath.Join(m.Path(path), "memory.limit_in_bytes"))
+		current, err := readUint(filepath.Join(m.Path(path), "memory.memsw.limit_in_bytes"))
 		if err != nil {
 			return err
 		}
-		if current < uint64(*resources.Memory.Swap) {
-			settings[0], settings[1] = settings[1], settings[0]
+		if current < uint64(*resources.Memory.Limit) {
+			settings[0], settings[2] = settings[2], settings[0]
 		}
 	}
 	return m.set(path, settings)
@@ -196,23 +201,135 @@ func (m *memoryController) Stat(path string, stats *Stats) error {
 	return nil
 }
 
-// func (m *memoryController) OOMEventFD(path string) (uintptr, error) {
-// 	root := m.Path(path)
-// 	f, err := os.Open(filepath.Join(root, "memory.oom_control"))
-// 	if err != nil {
-// 		return 0, err
-// 	}
-// 	defer f.Close()
-// 	fd, _, serr := unix.RawSyscall(unix.SYS_EVENTFD2, 0, unix.EFD_CLOEXEC, 0)
-// 	if serr != 0 {
-// 		return 0, serr
-// 	}
-// 	if err := writeEventFD(root, f.Fd(), fd); err != nil {
-// 		unix.Close(int(fd))
-// 		return 0, err
-// 	}
-// 	return fd, nil
-// }
+// OOMEventFD returns an eventfd that the kernel signals every time the
+// cgroup runs out of memory, and when the cgroup is removed.
+func (m *memoryController) OOMEventFD(path string) (uintptr, error) {
+	root := m.Path(path)
+	f, err := os.Open(filepath.Join(root, "memory.oom_control"))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	fd, err := unix.Eventfd(0, unix.EFD_CLOEXEC)
+	if err != nil {
+		return 0, err
+	}
+	if err := writeEventFD(root, f.Fd(), uintptr(fd)); err != nil {
+		unix.Close(fd)
+		return 0, err
+	}
+	return uintptr(fd), nil
+}
+
+// OOMEvents sends on the returned channel every time the cgroup runs out of
+// memory, until ctx is done or the cgroup is removed and the channel closed.
+// Events that happen while one is still pending are merged into it.
+func (m *memoryController) OOMEvents(ctx context.Context, path string) (<-chan struct{}, error) {
+	fd, err := m.OOMEventFD(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newEventReader(ctx, int(fd))
+	if err != nil {
+		unix.Close(int(fd))
+		return nil, err
+	}
+	eventControl := filepath.Join(m.Path(path), "cgroup.event_control")
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer func() {
+			r.Close()
+			close(ch)
+		}()
+		buf := make([]byte, 8)
+		for {
+			if _, err := r.Read(buf); err != nil {
+				return
+			}
+			// the eventfd is also signalled when the cgroup goes away.
+			if _, err := os.Lstat(eventControl); os.IsNotExist(err) {
+				return
+			}
+			notify(ch)
+		}
+	}()
+	return ch, nil
+}
+
+// notify sends on ch without blocking, a pending event stands for the new one.
+func notify(ch chan<- struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// eventReader reads from a file descriptor of the kernel, like an eventfd or
+// an inotify instance, until its context is done.
+type eventReader struct {
+	fd   int
+	stop int
+	ctx  context.Context
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newEventReader(ctx context.Context, fd int) (*eventReader, error) {
+	stop, err := unix.Eventfd(0, unix.EFD_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	r := &eventReader{
+		fd:   fd,
+		stop: stop,
+		ctx:  ctx,
+		done: make(chan struct{}),
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		select {
+		case <-ctx.Done():
+			// any value wakes up the poll in Read.
+			unix.Write(stop, []byte{1, 0, 0, 0, 0, 0, 0, 0})
+		case <-r.done:
+		}
+	}()
+	return r, nil
+}
+
+// Read blocks until the file descriptor is readable, it returns the error of
+// the context once that is done.
+func (r *eventReader) Read(buf []byte) (int, error) {
+	fds := []unix.PollFd{
+		{Fd: int32(r.fd), Events: unix.POLLIN},
+		{Fd: int32(r.stop), Events: unix.POLLIN},
+	}
+	for {
+		if _, err := unix.Poll(fds, -1); err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			return 0, err
+		}
+		if fds[1].Revents != 0 {
+			return 0, r.ctx.Err()
+		}
+		n, err := unix.Read(r.fd, buf)
+		if err == unix.EINTR {
+			continue
+		}
+		return n, err
+	}
+}
+
+// Close closes both file descriptors once the context watcher returned.
+func (r *eventReader) Close() error {
+	close(r.done)
+	r.wg.Wait()
+	unix.Close(r.stop)
+	return unix.Close(r.fd)
+}
 
 func writeEventFD(root string, cfd, efd uintptr) error {
 	f, err := os.OpenFile(filepath.Join(root, "cgroup.event_control"), os.O_WRONLY, 0)
@@ -284,7 +401,7 @@ func (m *memoryController) set(path string, settings []memorySettings) error {
 				[]byte(strconv.FormatInt(*t.value, 10)),
 				defaultFilePerm,
 			); err != nil {
-				return err
+				return checkEBUSY(t.name, err)
 			}
 		}
 	}
@@ -335,15 +452,18 @@ func getMemorySettings(resources *Resources) []memorySettings {
 	}
 }
 
-func checkEBUSY(err error) error {
-	// if pathErr, ok := err.(*os.PathError); ok {
-	// 	if errNo, ok := pathErr.Err.(syscall.Errno); ok {
-	// 		if errNo == unix.EBUSY {
-	// 			return fmt.Errorf(
-	// 				"failed to set memory.kmem.limit_in_bytes, because either tasks have already joined this cgroup or it has children")
-	// 		}
-	// 	}
-	// }
+// checkEBUSY explains why the kernel refused a memory setting with EBUSY.
+func checkEBUSY(name string, err error) error {
+	if !errors.Is(err, unix.EBUSY) {
+		return err
+	}
+	switch name {
+	case "kmem.limit_in_bytes":
+		return fmt.Errorf(
+			"cgroups: failed to set memory.kmem.limit_in_bytes, because either tasks have already joined this cgroup or it has children")
+	case "limit_in_bytes", "memsw.limit_in_bytes":
+		return fmt.Errorf("cgroups: failed to set memory.%s below the current usage of the cgroup: %v", name, err)
+	}
 	return err
 }
 
@@ -354,3 +474,181 @@ func getOomControlValue(mem *MemoryResource) *int64 {
 	}
 	return nil
 }
+
+// NewMemoryV2 returns the memory controller of the unified hierarchy mounted
+// at root.
+func NewMemoryV2(root string) *memoryV2Controller {
+	return &memoryV2Controller{
+		root: root,
+	}
+}
+
+type memoryV2Controller struct {
+	root string
+}
+
+func (m *memoryV2Controller) Name() Name {
+	return Memory
+}
+
+func (m *memoryV2Controller) Path(path string) string {
+	return filepath.Join(m.root, path)
+}
+
+// Create maps the limit onto memory.max, the reservation onto memory.low and
+// the memory+swap limit onto memory.swap.max. The kernel memory, swappiness
+// and oom killer settings have no equivalent and are ignored.
+func (m *memoryV2Controller) Create(path string, resources *Resources) error {
+	if err := os.MkdirAll(m.Path(path), defaultDirPerm); err != nil {
+		return err
+	}
+	mem := resources.Memory
+	if mem == nil {
+		return nil
+	}
+	swap, err := convertMemorySwap(mem.Limit, mem.Swap)
+	if err != nil {
+		return err
+	}
+	// memory.swap.max goes first, lowering memory.max can push pages out to
+	// a swap that is about to be limited.
+	for _, t := range []struct {
+		name  string
+		value string
+	}{
+		{
+			name:  "swap.max",
+			value: swap,
+		},
+		{
+			name:  "max",
+			value: formatMax(mem.Limit),
+		},
+		{
+			name:  "low",
+			value: formatMax(mem.Reservation),
+		},
+	} {
+		if t.value != "" {
+			if err := ioutil.WriteFile(
+				filepath.Join(m.Path(path), fmt.Sprintf("memory.%s", t.name)),
+				[]byte(t.value),
+				defaultFilePerm,
+			); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *memoryV2Controller) Update(path string, resources *Resources) error {
+	return m.Create(path, resources)
+}
+
+func (m *memoryV2Controller) Stat(path string, stats *Stats) error {
+	raw, err := readKVFile(filepath.Join(m.Path(path), "memory.stat"))
+	if err != nil {
+		return err
+	}
+	stats.Memory = &MemoryStat{
+		Usage: &MemoryEntry{},
+		Swap:  &MemoryEntry{},
+
+		Cache:        raw["file"],
+		RSS:          raw["anon"],
+		RSSHuge:      raw["anon_thp"],
+		MappedFile:   raw["file_mapped"],
+		Dirty:        raw["file_dirty"],
+		Writeback:    raw["file_writeback"],
+		PgFault:      raw["pgfault"],
+		PgMajFault:   raw["pgmajfault"],
+		InactiveAnon: raw["inactive_anon"],
+		ActiveAnon:   raw["active_anon"],
+		InactiveFile: raw["inactive_file"],
+		ActiveFile:   raw["active_file"],
+		Unevictable:  raw["unevictable"],
+	}
+	if stats.Memory.Usage.Usage, err = readUint(filepath.Join(m.Path(path), "memory.current")); err != nil {
+		return err
+	}
+	if stats.Memory.Usage.Limit, err = readMax(filepath.Join(m.Path(path), "memory.max")); err != nil {
+		return err
+	}
+	events, err := readKVFile(filepath.Join(m.Path(path), "memory.events"))
+	if err != nil {
+		return err
+	}
+	stats.Memory.Usage.Failcnt = events["max"]
+	// the swap files are missing when swap accounting is disabled.
+	if stats.Memory.Swap.Usage, err = readUint(filepath.Join(m.Path(path), "memory.swap.current")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if stats.Memory.Swap.Limit, err = readMax(filepath.Join(m.Path(path), "memory.swap.max")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	stats.Memory.PSI, err = readPSI(m.Path(path), "memory.pressure")
+	return err
+}
+
+// OOMEvents sends on the returned channel every time the oom killer kills a
+// process of the cgroup, the channel is closed once ctx is done or the cgroup
+// has no processes left or is removed. Kills that happen while an event is
+// still pending are merged into it. memory.events and cgroup.events are
+// watched with inotify, the kernel modifies them when their counters change.
+func (m *memoryV2Controller) OOMEvents(ctx context.Context, path string) (<-chan struct{}, error) {
+	var (
+		memoryEvents = filepath.Join(m.Path(path), "memory.events")
+		cgroupEvents = filepath.Join(m.Path(path), "cgroup.events")
+	)
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range []string{memoryEvents, cgroupEvents} {
+		if _, err := unix.InotifyAddWatch(fd, f, unix.IN_MODIFY); err != nil {
+			unix.Close(fd)
+			return nil, fmt.Errorf("cgroups: watching %s: %v", f, err)
+		}
+	}
+	events, err := readKVFile(memoryEvents)
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	r, err := newEventReader(ctx, fd)
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer func() {
+			r.Close()
+			close(ch)
+		}()
+		kills := events["oom_kill"]
+		buf := make([]byte, unix.SizeofInotifyEvent+unix.PathMax+1)
+		for {
+			if _, err := r.Read(buf); err != nil {
+				return
+			}
+			events, err := readKVFile(memoryEvents)
+			if err != nil {
+				return
+			}
+			if kills < events["oom_kill"] {
+				kills = events["oom_kill"]
+				notify(ch)
+			}
+			cgroup, err := readKVFile(cgroupEvents)
+			if err != nil {
+				return
+			}
+			if populated, ok := cgroup["populated"]; ok && populated == 0 {
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
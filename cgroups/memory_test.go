@@ -21,8 +21,12 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 const memoryData = `cache 1
@@ -177,6 +181,65 @@ func TestMemoryController_Stat_OptionalSwap_NoSwap(t *testing.T) {
 	checkMemoryStatHasNoSwap(t, stats.Memory)
 }
 
+func TestMemoryController_Update_RaiseLimitAndSwap(t *testing.T) {
+	// GIVEN a cgroup with a swap limit below the new memory limit, where the
+	// memory limit is a fifo to see what the swap limit is when it is written
+	tmpRoot := buildMemoryMetrics(t, []string{"", "memsw"}, []string{"limit_in_bytes"})
+	defer os.RemoveAll(tmpRoot)
+	dir := path.Join(tmpRoot, string(Memory))
+	if err := ioutil.WriteFile(path.Join(dir, "memory.memsw.limit_in_bytes"), []byte("1048576\n"), defaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+	limitFile := path.Join(dir, "memory.limit_in_bytes")
+	if err := os.Remove(limitFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := unix.Mkfifo(limitFile, 0600); err != nil {
+		t.Fatal(err)
+	}
+	type write struct {
+		limit, swap string
+		err         error
+	}
+	written := make(chan write, 1)
+	go func() {
+		limit, err := ioutil.ReadFile(limitFile)
+		if err != nil {
+			written <- write{err: err}
+			return
+		}
+		swap, err := ioutil.ReadFile(path.Join(dir, "memory.memsw.limit_in_bytes"))
+		written <- write{limit: string(limit), swap: string(swap), err: err}
+	}()
+
+	// WHEN both limits are raised
+	var (
+		limit = int64(1 << 30)
+		swap  = int64(2 << 30)
+	)
+	mc := NewMemory(tmpRoot)
+	updated := make(chan error, 1)
+	go func() {
+		updated <- mc.Update("", &Resources{Memory: &MemoryResource{Limit: &limit, Swap: &swap}})
+	}()
+
+	// THEN the swap limit is raised before the memory limit
+	select {
+	case w := <-written:
+		if err := <-updated; err != nil {
+			t.Fatal(err)
+		}
+		if w.err != nil {
+			t.Fatal(w.err)
+		}
+		if w.limit != strconv.FormatInt(limit, 10) || w.swap != strconv.FormatInt(swap, 10) {
+			t.Fatalf("expected the swap limit %d to be set before the memory limit %d but have %q and %q", swap, limit, w.swap, w.limit)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the memory limit was not written")
+	}
+}
+
 func checkMemoryStatIsComplete(t *testing.T, mem *MemoryStat) {
 	index := []uint64{
 		mem.Usage.Usage,
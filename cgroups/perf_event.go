@@ -0,0 +1,23 @@
+package cgroups
+
+import "path/filepath"
+
+// NewPerfEvent returns the perf_event controller, it has no settings and
+// only groups the processes so that perf can monitor them with --cgroup.
+func NewPerfEvent(root string) *perfEventController {
+	return &perfEventController{
+		root: filepath.Join(root, string(PerfEvent)),
+	}
+}
+
+type perfEventController struct {
+	root string
+}
+
+func (p *perfEventController) Name() Name {
+	return PerfEvent
+}
+
+func (p *perfEventController) Path(path string) string {
+	return filepath.Join(p.root, path)
+}
@@ -30,6 +30,14 @@ func NewPids(root string) *pidsController {
 	}
 }
 
+// NewPidsV2 returns the pids controller of the unified hierarchy mounted at
+// root, its files are the same as in v1.
+func NewPidsV2(root string) *pidsController {
+	return &pidsController{
+		root: root,
+	}
+}
+
 type pidsController struct {
 	root string
 }
@@ -0,0 +1,218 @@
+package cgroups
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// readPSI reads the pressure stall information of a cgroup of the unified
+// hierarchy, e.g. cpu.pressure:
+//
+//	some avg10=0.92 avg60=1.90 avg300=1.52 total=66312071
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//
+// nil is returned when the kernel does not account pressure.
+func readPSI(dir, file string) (*PSIStats, error) {
+	f, err := os.Open(filepath.Join(dir, file))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var (
+		psi = &PSIStats{}
+		sc  = bufio.NewScanner(f)
+	)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		data, err := parsePSIData(fields[1:])
+		if err != nil {
+			return nil, fmt.Errorf("cgroups: invalid %s line %q: %v", file, sc.Text(), err)
+		}
+		switch fields[0] {
+		case "some":
+			psi.Some = data
+		case "full":
+			psi.Full = data
+		}
+	}
+	if err := sc.Err(); err != nil {
+		// psi=0 on the kernel command line leaves the files in place but
+		// makes reading them fail.
+		if errors.Is(err, unix.ENOTSUP) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return psi, nil
+}
+
+func parsePSIData(fields []string) (*PSIData, error) {
+	data := &PSIData{}
+	for _, kv := range fields {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return nil, ErrInvalidFormat
+		}
+		if parts[0] == "total" {
+			v, err := strconv.ParseUint(parts[1], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			data.Total = v
+			continue
+		}
+		v, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return nil, err
+		}
+		switch parts[0] {
+		case "avg10":
+			data.Avg10 = v
+		case "avg60":
+			data.Avg60 = v
+		case "avg300":
+			data.Avg300 = v
+		}
+	}
+	return data, nil
+}
+
+// PSITrigger describes when a pressure trigger fires: whenever the tasks of
+// the cgroup are stalled on the resource for Threshold within any Window. The
+// kernel accepts windows from 500ms to 10s.
+type PSITrigger struct {
+	// Resource is Cpu, Memory or Io.
+	Resource Name
+	// Full selects the time all tasks are stalled instead of some of them.
+	Full      bool
+	Threshold time.Duration
+	Window    time.Duration
+}
+
+func (t PSITrigger) file() (string, error) {
+	switch t.Resource {
+	case Cpu, Memory, Io:
+		return string(t.Resource) + ".pressure", nil
+	}
+	return "", fmt.Errorf("cgroups: no pressure information for %q", t.Resource)
+}
+
+func (t PSITrigger) String() string {
+	kind := "some"
+	if t.Full {
+		kind = "full"
+	}
+	return fmt.Sprintf("%s %d %d", kind, t.Threshold.Microseconds(), t.Window.Microseconds())
+}
+
+// psiTrigger is a trigger registered on a pressure file, it stays registered
+// as long as the file is open.
+type psiTrigger struct {
+	fd   int
+	stop int
+
+	// protects closed and the eventfd, the watch closes both files once it
+	// returned
+	mu     sync.Mutex
+	closed bool
+}
+
+// registerPSITrigger writes the trigger to its pressure file in dir and calls
+// fn every time it fires, until the trigger is closed or the cgroup removed.
+func registerPSITrigger(dir string, t PSITrigger, fn func()) (*psiTrigger, error) {
+	file, err := t.file()
+	if err != nil {
+		return nil, err
+	}
+	fd, err := unix.Open(filepath.Join(dir, file), unix.O_RDWR|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cgroups: opening %s: %v", file, err)
+	}
+	if _, err := unix.Write(fd, append([]byte(t.String()), 0)); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("cgroups: registering trigger %q on %s: %v", t, file, err)
+	}
+	p, err := newPSITrigger(fd)
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	go p.watch(fn)
+	return p, nil
+}
+
+func newPSITrigger(fd int) (*psiTrigger, error) {
+	stop, err := unix.Eventfd(0, unix.EFD_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	return &psiTrigger{
+		fd:   fd,
+		stop: stop,
+	}, nil
+}
+
+func (p *psiTrigger) watch(fn func()) {
+	defer func() {
+		p.mu.Lock()
+		p.closed = true
+		unix.Close(p.fd)
+		unix.Close(p.stop)
+		p.mu.Unlock()
+	}()
+	fds := []unix.PollFd{
+		{Fd: int32(p.fd), Events: unix.POLLPRI},
+		{Fd: int32(p.stop), Events: unix.POLLIN},
+	}
+	for {
+		if _, err := unix.Poll(fds, -1); err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			return
+		}
+		// POLLERR is returned once the cgroup is removed.
+		if fds[1].Revents != 0 || fds[0].Revents&unix.POLLERR != 0 {
+			return
+		}
+		if fds[0].Revents&unix.POLLPRI != 0 {
+			p.mu.Lock()
+			closed := p.closed
+			p.mu.Unlock()
+			if closed {
+				return
+			}
+			fn()
+		}
+	}
+}
+
+// Close unregisters the trigger. Like the Stop of a time.Timer it does not
+// wait for a callback that is already running, so the callback may close the
+// trigger itself.
+func (p *psiTrigger) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	// any value wakes up the poll.
+	_, err := unix.Write(p.stop, []byte{1, 0, 0, 0, 0, 0, 0, 0})
+	return err
+}
@@ -0,0 +1,97 @@
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestReadPSI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cgroups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "memory.pressure"), []byte(
+		"some avg10=0.92 avg60=1.90 avg300=1.52 total=66312071\nfull avg10=0.00 avg60=0.10 avg300=0.00 total=2335325\n",
+	), defaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+	psi, err := readPSI(dir, "memory.pressure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if psi.Some == nil || psi.Some.Avg10 != 0.92 || psi.Some.Avg60 != 1.90 || psi.Some.Avg300 != 1.52 || psi.Some.Total != 66312071 {
+		t.Fatalf("unexpected some pressure %+v", psi.Some)
+	}
+	if psi.Full == nil || psi.Full.Avg60 != 0.10 || psi.Full.Total != 2335325 {
+		t.Fatalf("unexpected full pressure %+v", psi.Full)
+	}
+	if psi, err := readPSI(dir, "cpu.pressure"); err != nil || psi != nil {
+		t.Fatalf("expected no pressure for a missing file, received %+v, %v", psi, err)
+	}
+}
+
+func TestPSITriggerString(t *testing.T) {
+	trigger := PSITrigger{
+		Resource:  Memory,
+		Full:      true,
+		Threshold: 150 * time.Millisecond,
+		Window:    time.Second,
+	}
+	if s := trigger.String(); s != "full 150000 1000000" {
+		t.Fatalf("expected trigger %q but received %q", "full 150000 1000000", s)
+	}
+	if _, err := (PSITrigger{Resource: Pids}).file(); err == nil {
+		t.Fatal("expected an error for a resource without pressure information")
+	}
+}
+
+func TestPSITriggerCloseFromCallback(t *testing.T) {
+	// out of band data on a socket raises POLLPRI like a pressure trigger.
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(fds[1])
+	p, err := newPSITrigger(fds[0])
+	if err != nil {
+		unix.Close(fds[0])
+		t.Fatal(err)
+	}
+	closed := make(chan error, 1)
+	returned := make(chan struct{})
+	go func() {
+		p.watch(func() {
+			closed <- p.Close()
+		})
+		close(returned)
+	}()
+	if _, err := unix.SendmsgN(fds[1], []byte{1}, nil, nil, unix.MSG_OOB); err != nil {
+		p.Close()
+		if err == unix.EOPNOTSUPP {
+			t.Skip("out of band data is not supported on unix sockets")
+		}
+		t.Fatal(err)
+	}
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("closing the trigger from its callback did not return")
+	}
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("closing the trigger from its callback did not stop the watch")
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("closing the trigger again: %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package cgroups
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func NewRdma(root string) *rdmaController {
+	return &rdmaController{
+		root: filepath.Join(root, string(Rdma)),
+	}
+}
+
+// NewRdmaV2 returns the rdma controller of the unified hierarchy mounted at
+// root, its files are the same as in v1.
+func NewRdmaV2(root string) *rdmaController {
+	return &rdmaController{
+		root: root,
+	}
+}
+
+type rdmaController struct {
+	root string
+}
+
+func (r *rdmaController) Name() Name {
+	return Rdma
+}
+
+func (r *rdmaController) Path(path string) string {
+	return filepath.Join(r.root, path)
+}
+
+// Create writes a line per device to rdma.max, a limit that is not set is
+// left to "max", e.g.
+//
+//	mlx4_0 hca_handle=2 hca_object=max
+func (r *rdmaController) Create(path string, resources *Resources) error {
+	if err := os.MkdirAll(r.Path(path), defaultDirPerm); err != nil {
+		return err
+	}
+	devices := make([]string, 0, len(resources.Rdma))
+	for device := range resources.Rdma {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+	for _, device := range devices {
+		limit := resources.Rdma[device]
+		if err := retryingWriteFile(
+			filepath.Join(r.Path(path), "rdma.max"),
+			[]byte(fmt.Sprintf("%s hca_handle=%s hca_object=%s", device, formatRdmaLimit(limit.HcaHandles), formatRdmaLimit(limit.HcaObjects))),
+			defaultFilePerm,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *rdmaController) Update(path string, resources *Resources) error {
+	return r.Create(path, resources)
+}
+
+func (r *rdmaController) Stat(path string, stats *Stats) error {
+	current, err := r.readEntries(filepath.Join(r.Path(path), "rdma.current"))
+	if err != nil {
+		return err
+	}
+	limit, err := r.readEntries(filepath.Join(r.Path(path), "rdma.max"))
+	if err != nil {
+		return err
+	}
+	stats.Rdma = &RdmaStat{
+		Current: current,
+		Limit:   limit,
+	}
+	return nil
+}
+
+func (r *rdmaController) readEntries(path string) ([]*RdmaEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseRdmaEntries(f)
+}
+
+func formatRdmaLimit(v *uint32) string {
+	if v == nil {
+		return "max"
+	}
+	return strconv.FormatUint(uint64(*v), 10)
+}
+
+// parseRdmaEntries parses rdma.current or rdma.max, "max" is reported as the
+// largest value the kernel accepts.
+func parseRdmaEntries(reader io.Reader) ([]*RdmaEntry, error) {
+	var (
+		entries []*RdmaEntry
+		sc      = bufio.NewScanner(reader)
+	)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		entry := &RdmaEntry{
+			Device: fields[0],
+		}
+		for _, kv := range fields[1:] {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 {
+				return nil, ErrInvalidFormat
+			}
+			v := uint64(math.MaxInt32)
+			if parts[1] != "max" {
+				var err error
+				if v, err = strconv.ParseUint(parts[1], 10, 32); err != nil {
+					return nil, fmt.Errorf("cgroups: invalid rdma entry %q: %v", sc.Text(), err)
+				}
+			}
+			switch parts[0] {
+			case "hca_handle":
+				entry.HcaHandles = uint32(v)
+			case "hca_object":
+				entry.HcaObjects = uint32(v)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, sc.Err()
+}
@@ -0,0 +1,53 @@
+package cgroups
+
+import (
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestRdma(t *testing.T) {
+	mock, err := newMock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.delete()
+	rdma := NewRdma(mock.root)
+	handles := uint32(2)
+	if err := rdma.Create("test", &Resources{
+		Rdma: map[string]RdmaResource{
+			"mlx4_0": {HcaHandles: &handles},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	max := filepath.Join(rdma.Path("test"), "rdma.max")
+	data, err := ioutil.ReadFile(max)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "mlx4_0 hca_handle=2 hca_object=max"; string(data) != expected {
+		t.Fatalf("expected rdma.max %q but received %q", expected, data)
+	}
+	if err := ioutil.WriteFile(
+		filepath.Join(rdma.Path("test"), "rdma.current"),
+		[]byte("mlx4_0 hca_handle=1 hca_object=10\nocrdma1 hca_handle=0 hca_object=0\n"),
+		defaultFilePerm,
+	); err != nil {
+		t.Fatal(err)
+	}
+	var stats Stats
+	if err := rdma.Stat("test", &stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Rdma.Current) != 2 || len(stats.Rdma.Limit) != 1 {
+		t.Fatalf("unexpected rdma stats %+v", stats.Rdma)
+	}
+	if c := stats.Rdma.Current[0]; c.Device != "mlx4_0" || c.HcaHandles != 1 || c.HcaObjects != 10 {
+		t.Fatalf("unexpected rdma.current entry %+v", c)
+	}
+	if l := stats.Rdma.Limit[0]; l.HcaHandles != 2 || l.HcaObjects != math.MaxInt32 {
+		t.Fatalf("unexpected rdma.max entry %+v", l)
+	}
+}
@@ -1,9 +1,27 @@
 package cgroups
 
+import "github.com/lipeining/godocker/configs"
+
 type BlockIOResource struct {
+	Weight                  uint64
+	LeafWeight              uint64
+	WeightDevice            []WeightDevice
+	ThrottleReadBpsDevice   []ThrottleDevice
+	ThrottleWriteBpsDevice  []ThrottleDevice
+	ThrottleReadIOPSDevice  []ThrottleDevice
+	ThrottleWriteIOPSDevice []ThrottleDevice
+}
+type WeightDevice struct {
+	Major      int64
+	Minor      int64
 	Weight     uint64
 	LeafWeight uint64
 }
+type ThrottleDevice struct {
+	Major int64
+	Minor int64
+	Rate  uint64
+}
 type CpuResource struct {
 	RealtimePeriod  *uint64
 	RealtimeRuntime *int64
@@ -27,6 +45,10 @@ type NetclsResource struct {
 	ClassID    *uint32
 	Priorities []InterfacePriority
 }
+type HugepageLimit struct {
+	Pagesize string
+	Limit    uint64
+}
 type InterfacePriority struct {
 	Name     string
 	Priority uint32
@@ -34,10 +56,18 @@ type InterfacePriority struct {
 type PidsResource struct {
 	Limit int64
 }
+type RdmaResource struct {
+	HcaHandles *uint32
+	HcaObjects *uint32
+}
 type Resources struct {
-	BlockIO *BlockIOResource
-	CPU     *CpuResource
-	Memory  *MemoryResource
-	Network *NetclsResource
-	Pids    *PidsResource
+	BlockIO        *BlockIOResource
+	CPU            *CpuResource
+	Devices        []*configs.DeviceRule
+	SkipDevices    bool
+	HugepageLimits []HugepageLimit
+	Memory         *MemoryResource
+	Network        *NetclsResource
+	Pids           *PidsResource
+	Rdma           map[string]RdmaResource
 }
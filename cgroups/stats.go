@@ -1,103 +1,145 @@
 package cgroups
 
 type ThrottlingStat struct {
-	Periods          uint64
-	ThrottledPeriods uint64
-	ThrottledTime    uint64
+	Periods          uint64 `json:"periods"`
+	ThrottledPeriods uint64 `json:"throttled_periods"`
+	ThrottledTime    uint64 `json:"throttled_time"`
 }
 type CPUUsage struct {
-	Total  uint64
-	User   uint64
-	Kernel uint64
-	PerCPU []uint64
+	Total  uint64   `json:"total"`
+	User   uint64   `json:"user"`
+	Kernel uint64   `json:"kernel"`
+	PerCPU []uint64 `json:"per_cpu,omitempty"`
 }
 type CPUStat struct {
-	Throttling *ThrottlingStat
-	Usage      *CPUUsage
+	Throttling *ThrottlingStat `json:"throttling,omitempty"`
+	Usage      *CPUUsage       `json:"usage,omitempty"`
+	PSI        *PSIStats       `json:"psi,omitempty"`
 }
 type BlkIOEntry struct {
-	Op     string
-	Device string
-	Major  uint64
-	Minor  uint64
-	Value  uint64
+	Op     string `json:"op"`
+	Device string `json:"device"`
+	Major  uint64 `json:"major"`
+	Minor  uint64 `json:"minor"`
+	Value  uint64 `json:"value"`
 }
 type BlkIOStat struct {
-	SectorsRecursive        []*BlkIOEntry
-	IoServiceBytesRecursive []*BlkIOEntry
-	IoServicedRecursive     []*BlkIOEntry
-	IoServiceTimeRecursive  []*BlkIOEntry
-	IoWaitTimeRecursive     []*BlkIOEntry
-	IoMergedRecursive       []*BlkIOEntry
-	IoTimeRecursive         []*BlkIOEntry
+	SectorsRecursive        []*BlkIOEntry `json:"sectors_recursive,omitempty"`
+	IoServiceBytesRecursive []*BlkIOEntry `json:"io_service_bytes_recursive,omitempty"`
+	IoServicedRecursive     []*BlkIOEntry `json:"io_serviced_recursive,omitempty"`
+	IoQueuedRecursive       []*BlkIOEntry `json:"io_queued_recursive,omitempty"`
+	IoServiceTimeRecursive  []*BlkIOEntry `json:"io_service_time_recursive,omitempty"`
+	IoWaitTimeRecursive     []*BlkIOEntry `json:"io_wait_time_recursive,omitempty"`
+	IoMergedRecursive       []*BlkIOEntry `json:"io_merged_recursive,omitempty"`
+	IoTimeRecursive         []*BlkIOEntry `json:"io_time_recursive,omitempty"`
+	PSI                     *PSIStats     `json:"psi,omitempty"`
+}
+type PSIData struct {
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+	Total  uint64  `json:"total"`
+}
+type PSIStats struct {
+	Some *PSIData `json:"some,omitempty"`
+	Full *PSIData `json:"full,omitempty"`
 }
 type CpuacctStat struct {
+	PerCPUUser   []uint64 `json:"per_cpu_user,omitempty"`
+	PerCPUKernel []uint64 `json:"per_cpu_kernel,omitempty"`
 }
 type CpusetStat struct {
+	Cpus           string `json:"cpus"`
+	Mems           string `json:"mems"`
+	EffectiveCpus  string `json:"effective_cpus"`
+	EffectiveMems  string `json:"effective_mems"`
+	MemoryPressure uint64 `json:"memory_pressure"`
+}
+type HugetlbStat struct {
+	Pagesize string `json:"pagesize"`
+	Usage    uint64 `json:"usage"`
+	Max      uint64 `json:"max"`
+	Failcnt  uint64 `json:"failcnt"`
 }
 type MemoryEntry struct {
-	Usage   uint64
-	Max     uint64
-	Failcnt uint64
-	Limit   uint64
+	Usage   uint64 `json:"usage"`
+	Max     uint64 `json:"max"`
+	Failcnt uint64 `json:"failcnt"`
+	Limit   uint64 `json:"limit"`
 }
 type MemoryStat struct {
-	Usage     *MemoryEntry
-	Swap      *MemoryEntry
-	Kernel    *MemoryEntry
-	KernelTCP *MemoryEntry
+	Usage     *MemoryEntry `json:"usage,omitempty"`
+	Swap      *MemoryEntry `json:"swap,omitempty"`
+	Kernel    *MemoryEntry `json:"kernel,omitempty"`
+	KernelTCP *MemoryEntry `json:"kernel_tcp,omitempty"`
 
-	Cache                   uint64
-	RSS                     uint64
-	RSSHuge                 uint64
-	MappedFile              uint64
-	Dirty                   uint64
-	Writeback               uint64
-	PgPgIn                  uint64
-	PgPgOut                 uint64
-	PgFault                 uint64
-	PgMajFault              uint64
-	InactiveAnon            uint64
-	ActiveAnon              uint64
-	InactiveFile            uint64
-	ActiveFile              uint64
-	Unevictable             uint64
-	HierarchicalMemoryLimit uint64
-	HierarchicalSwapLimit   uint64
-	TotalCache              uint64
-	TotalRSS                uint64
-	TotalRSSHuge            uint64
-	TotalMappedFile         uint64
-	TotalDirty              uint64
-	TotalWriteback          uint64
-	TotalPgPgIn             uint64
-	TotalPgPgOut            uint64
-	TotalPgFault            uint64
-	TotalPgMajFault         uint64
-	TotalInactiveAnon       uint64
-	TotalActiveAnon         uint64
-	TotalInactiveFile       uint64
-	TotalActiveFile         uint64
-	TotalUnevictable        uint64
+	Cache                   uint64 `json:"cache"`
+	RSS                     uint64 `json:"rss"`
+	RSSHuge                 uint64 `json:"rss_huge"`
+	MappedFile              uint64 `json:"mapped_file"`
+	Dirty                   uint64 `json:"dirty"`
+	Writeback               uint64 `json:"writeback"`
+	PgPgIn                  uint64 `json:"pgpgin"`
+	PgPgOut                 uint64 `json:"pgpgout"`
+	PgFault                 uint64 `json:"pgfault"`
+	PgMajFault              uint64 `json:"pgmajfault"`
+	InactiveAnon            uint64 `json:"inactive_anon"`
+	ActiveAnon              uint64 `json:"active_anon"`
+	InactiveFile            uint64 `json:"inactive_file"`
+	ActiveFile              uint64 `json:"active_file"`
+	Unevictable             uint64 `json:"unevictable"`
+	HierarchicalMemoryLimit uint64 `json:"hierarchical_memory_limit"`
+	HierarchicalSwapLimit   uint64 `json:"hierarchical_swap_limit"`
+	TotalCache              uint64 `json:"total_cache"`
+	TotalRSS                uint64 `json:"total_rss"`
+	TotalRSSHuge            uint64 `json:"total_rss_huge"`
+	TotalMappedFile         uint64 `json:"total_mapped_file"`
+	TotalDirty              uint64 `json:"total_dirty"`
+	TotalWriteback          uint64 `json:"total_writeback"`
+	TotalPgPgIn             uint64 `json:"total_pgpgin"`
+	TotalPgPgOut            uint64 `json:"total_pgpgout"`
+	TotalPgFault            uint64 `json:"total_pgfault"`
+	TotalPgMajFault         uint64 `json:"total_pgmajfault"`
+	TotalInactiveAnon       uint64 `json:"total_inactive_anon"`
+	TotalActiveAnon         uint64 `json:"total_active_anon"`
+	TotalInactiveFile       uint64 `json:"total_inactive_file"`
+	TotalActiveFile         uint64 `json:"total_active_file"`
+	TotalUnevictable        uint64 `json:"total_unevictable"`
+
+	PSI *PSIStats `json:"psi,omitempty"`
 }
 type NetworkStat struct {
-	Name      string
-	RxBytes   uint64
-	RxPackets uint64
-	RxErrors  uint64
-	RxDropped uint64
-	TxBytes   uint64
-	TxPackets uint64
-	TxErrors  uint64
-	TxDropped uint64
+	Name      string `json:"name"`
+	RxBytes   uint64 `json:"rx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	RxErrors  uint64 `json:"rx_errors"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	TxPackets uint64 `json:"tx_packets"`
+	TxErrors  uint64 `json:"tx_errors"`
+	TxDropped uint64 `json:"tx_dropped"`
+}
+type RdmaEntry struct {
+	Device     string `json:"device"`
+	HcaHandles uint32 `json:"hca_handles"`
+	HcaObjects uint32 `json:"hca_objects"`
+}
+type RdmaStat struct {
+	Current []*RdmaEntry `json:"current,omitempty"`
+	Limit   []*RdmaEntry `json:"limit,omitempty"`
 }
 type PidsStat struct {
-	Current uint64
-	Limit   uint64
+	Current uint64 `json:"current"`
+	Limit   uint64 `json:"limit"`
 }
 type Stats struct {
-	Blkio  *BlkIOStat
-	CPU    *CPUStat
-	Memory *MemoryStat
-	Pids   *PidsStat
+	Blkio   *BlkIOStat     `json:"blkio,omitempty"`
+	CPU     *CPUStat       `json:"cpu,omitempty"`
+	Cpuacct *CpuacctStat   `json:"cpuacct,omitempty"`
+	Cpuset  *CpusetStat    `json:"cpuset,omitempty"`
+	Hugetlb []*HugetlbStat `json:"hugetlb,omitempty"`
+	Memory  *MemoryStat    `json:"memory,omitempty"`
+	Network []*NetworkStat `json:"network,omitempty"`
+	Pids    *PidsStat      `json:"pids,omitempty"`
+	Rdma    *RdmaStat      `json:"rdma,omitempty"`
 }
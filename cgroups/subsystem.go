@@ -16,6 +16,8 @@
 
 package cgroups
 
+import "context"
+
 // Name is a typed name for a cgroup subsystem
 type Name string
 
@@ -33,6 +35,7 @@ const (
 	Memory    Name = "memory"
 	Blkio     Name = "blkio"
 	Rdma      Name = "rdma"
+	Io        Name = "io"
 )
 
 // Subsystems returns a complete list of the default cgroups
@@ -70,6 +73,18 @@ type deleter interface {
 	Delete(path string) error
 }
 
+type freezer interface {
+	Subsystem
+	Freeze(path string) error
+	Thaw(path string) error
+	State(path string) (State, error)
+}
+
+type oomNotifier interface {
+	Subsystem
+	OOMEvents(ctx context.Context, path string) (<-chan struct{}, error)
+}
+
 type stater interface {
 	Subsystem
 	Stat(path string, stats *Stats) error
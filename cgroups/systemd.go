@@ -1,160 +1,385 @@
-// /*
-//    Copyright The containerd Authors.
+/*
+   Copyright The containerd Authors.
 
-//    Licensed under the Apache License, Version 2.0 (the "License");
-//    you may not use this file except in compliance with the License.
-//    You may obtain a copy of the License at
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
 
-//        http://www.apache.org/licenses/LICENSE-2.0
+       http://www.apache.org/licenses/LICENSE-2.0
 
-//    Unless required by applicable law or agreed to in writing, software
-//    distributed under the License is distributed on an "AS IS" BASIS,
-//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
-//    See the License for the specific language governing permissions and
-//    limitations under the License.
-// */
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
 
 package cgroups
 
-// import (
-// 	"fmt"
-// 	"path/filepath"
-// 	"strings"
-// 	"sync"
-
-// 	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
-// 	"github.com/godbus/dbus/v5"
-// 	specs "github.com/opencontainers/runtime-spec/specs-go"
-// )
-
-// const (
-// 	SystemdDbus  Name = "systemd"
-// 	defaultSlice      = "system.slice"
-// )
-
-// var (
-// 	canDelegate bool
-// 	once        sync.Once
-// )
-
-// func Systemd() ([]Subsystem, error) {
-// 	root, err := v1MountPoint()
-// 	if err != nil {
-// 		return nil, err
-// 	}
-// 	defaultSubsystems, err := defaults(root)
-// 	if err != nil {
-// 		return nil, err
-// 	}
-// 	s, err := NewSystemd(root)
-// 	if err != nil {
-// 		return nil, err
-// 	}
-// 	// make sure the systemd controller is added first
-// 	return append([]Subsystem{s}, defaultSubsystems...), nil
-// }
-
-// func Slice(slice, name string) Path {
-// 	if slice == "" {
-// 		slice = defaultSlice
-// 	}
-// 	return func(subsystem Name) (string, error) {
-// 		return filepath.Join(slice, name), nil
-// 	}
-// }
-
-// func NewSystemd(root string) (*SystemdController, error) {
-// 	return &SystemdController{
-// 		root: root,
-// 	}, nil
-// }
-
-// type SystemdController struct {
-// 	mu   sync.Mutex
-// 	root string
-// }
-
-// func (s *SystemdController) Name() Name {
-// 	return SystemdDbus
-// }
-
-// func (s *SystemdController) Create(path string, resources *specs.LinuxResources) error {
-// 	conn, err := systemdDbus.New()
-// 	if err != nil {
-// 		return err
-// 	}
-// 	defer conn.Close()
-// 	slice, name := splitName(path)
-// 	// We need to see if systemd can handle the delegate property
-// 	// Systemd will return an error if it cannot handle delegate regardless
-// 	// of its bool setting.
-// 	checkDelegate := func() {
-// 		canDelegate = true
-// 		dlSlice := newProperty("Delegate", true)
-// 		if _, err := conn.StartTransientUnit(slice, "testdelegate", []systemdDbus.Property{dlSlice}, nil); err != nil {
-// 			if dbusError, ok := err.(dbus.Error); ok {
-// 				// Starting with systemd v237, Delegate is not even a property of slices anymore,
-// 				// so the D-Bus call fails with "InvalidArgs" error.
-// 				if strings.Contains(dbusError.Name, "org.freedesktop.DBus.Error.PropertyReadOnly") || strings.Contains(dbusError.Name, "org.freedesktop.DBus.Error.InvalidArgs") {
-// 					canDelegate = false
-// 				}
-// 			}
-// 		}
-
-// 		conn.StopUnit(slice, "testDelegate", nil)
-// 	}
-// 	once.Do(checkDelegate)
-// 	properties := []systemdDbus.Property{
-// 		systemdDbus.PropDescription(fmt.Sprintf("cgroup %s", name)),
-// 		systemdDbus.PropWants(slice),
-// 		newProperty("DefaultDependencies", false),
-// 		newProperty("MemoryAccounting", true),
-// 		newProperty("CPUAccounting", true),
-// 		newProperty("BlockIOAccounting", true),
-// 	}
-
-// 	// If we can delegate, we add the property back in
-// 	if canDelegate {
-// 		properties = append(properties, newProperty("Delegate", true))
-// 	}
-
-// 	ch := make(chan string)
-// 	_, err = conn.StartTransientUnit(name, "replace", properties, ch)
-// 	if err != nil {
-// 		return err
-// 	}
-// 	<-ch
-// 	return nil
-// }
-
-// func (s *SystemdController) Delete(path string) error {
-// 	conn, err := systemdDbus.New()
-// 	if err != nil {
-// 		return err
-// 	}
-// 	defer conn.Close()
-// 	_, name := splitName(path)
-// 	ch := make(chan string)
-// 	_, err = conn.StopUnit(name, "replace", ch)
-// 	if err != nil {
-// 		return err
-// 	}
-// 	<-ch
-// 	return nil
-// }
-
-// func newProperty(name string, units interface{}) systemdDbus.Property {
-// 	return systemdDbus.Property{
-// 		Name:  name,
-// 		Value: dbus.MakeVariant(units),
-// 	}
-// }
-
-// func unitName(name string) string {
-// 	return fmt.Sprintf("%s.slice", name)
-// }
-
-// func splitName(path string) (slice string, unit string) {
-// 	slice, unit = filepath.Split(path)
-// 	return strings.TrimSuffix(slice, "/"), unit
-// }
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	defaultSlice = "system.slice"
+	// jobTimeout is how long we wait for systemd to start or stop a unit.
+	jobTimeout = 30 * time.Second
+)
+
+// newSystemdConn connects to systemd, the tests point it to a fake systemd
+// on a private bus.
+var newSystemdConn = func() (*systemdDbus.Conn, error) {
+	return systemdDbus.New()
+}
+
+// ExpandSlice returns the cgroup path of a slice, systemd nests the slices
+// by the dashes in their names, e.g. a-b.slice is /a.slice/a-b.slice.
+func ExpandSlice(slice string) (string, error) {
+	const suffix = ".slice"
+	if !strings.HasSuffix(slice, suffix) || len(slice) == len(suffix) || strings.Contains(slice, "/") {
+		return "", fmt.Errorf("cgroups: invalid slice name %q", slice)
+	}
+	name := strings.TrimSuffix(slice, suffix)
+	if name == "-" {
+		return "/", nil
+	}
+	var path, prefix string
+	for _, component := range strings.Split(name, "-") {
+		if component == "" {
+			return "", fmt.Errorf("cgroups: invalid slice name %q", slice)
+		}
+		path += "/" + prefix + component + suffix
+		prefix += component + "-"
+	}
+	return path, nil
+}
+
+// ScopeName returns the name of the transient scope of a container.
+func ScopeName(prefix, name string) string {
+	if prefix == "" {
+		return name + ".scope"
+	}
+	return prefix + "-" + name + ".scope"
+}
+
+// systemdCgroup is a cgroup that systemd creates as a transient scope with
+// Delegate=yes. systemd only applies the resources it knows about, so the
+// cgroupfs view of the scope does everything else, like the controllers
+// systemd does not manage and the stats.
+type systemdCgroup struct {
+	*cgroup
+	slice string
+	unit  string
+
+	// protects started and resources
+	unitMu    sync.Mutex
+	started   bool
+	resources *Resources
+}
+
+// NewSystemd returns the cgroup of the transient scope unit in slice. A
+// scope cannot be empty, systemd starts it with the first process added.
+func NewSystemd(slice, unit string, resources *Resources) (Cgroup, error) {
+	s, err := newSystemdCgroup(slice, unit)
+	if err != nil {
+		return nil, err
+	}
+	s.resources = resources
+	return s, nil
+}
+
+// LoadSystemd loads the cgroup of an existing transient scope.
+func LoadSystemd(slice, unit string) (Cgroup, error) {
+	s, err := newSystemdCgroup(slice, unit)
+	if err != nil {
+		return nil, err
+	}
+	var active []Subsystem
+	for _, sub := range s.subsystems {
+		if _, err := os.Lstat(sub.(pather).Path(s.path)); err == nil {
+			active = append(active, sub)
+		}
+	}
+	if len(active) == 0 {
+		return nil, ErrCgroupDeleted
+	}
+	s.subsystems = active
+	s.started = true
+	return s, nil
+}
+
+func newSystemdCgroup(slice, unit string) (*systemdCgroup, error) {
+	if slice == "" {
+		slice = defaultSlice
+	}
+	if !strings.HasSuffix(unit, ".scope") {
+		return nil, fmt.Errorf("cgroups: %q is not a scope unit", unit)
+	}
+	dir, err := ExpandSlice(slice)
+	if err != nil {
+		return nil, err
+	}
+	subsystems, unifiedRoot, err := hierarchy()
+	if err != nil {
+		return nil, err
+	}
+	var enabled []Subsystem
+	for _, s := range pathers(subsystems) {
+		if _, err := os.Lstat(s.Path("/")); err == nil {
+			enabled = append(enabled, s)
+		}
+	}
+	return &systemdCgroup{
+		cgroup: &cgroup{
+			path:        filepath.Join(dir, unit),
+			subsystems:  enabled,
+			unifiedRoot: unifiedRoot,
+		},
+		slice: slice,
+		unit:  unit,
+	}, nil
+}
+
+// Add starts the scope with the process when it is the first one, and adds
+// the process to the hierarchies systemd does not manage.
+func (s *systemdCgroup) Add(process Process) error {
+	if err := s.start(process.Pid); err != nil {
+		return err
+	}
+	return s.cgroup.Add(process)
+}
+
+// AddTask starts the scope like Add does.
+func (s *systemdCgroup) AddTask(process Process) error {
+	if err := s.start(process.Pid); err != nil {
+		return err
+	}
+	return s.cgroup.AddTask(process)
+}
+
+func (s *systemdCgroup) start(pid int) error {
+	s.unitMu.Lock()
+	defer s.unitMu.Unlock()
+	if s.started {
+		return nil
+	}
+	resources := s.resources
+	if resources == nil {
+		resources = &Resources{}
+	}
+	conn, err := newSystemdConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	properties := []systemdDbus.Property{
+		systemdDbus.PropDescription("godocker container " + s.unit),
+		systemdDbus.PropSlice(s.slice),
+		systemdDbus.PropPids(uint32(pid)),
+		newProperty("Delegate", true),
+		newProperty("DefaultDependencies", false),
+		newProperty("MemoryAccounting", true),
+		newProperty("CPUAccounting", true),
+		newProperty("TasksAccounting", true),
+	}
+	resourceProps, err := systemdProperties(resources)
+	if err != nil {
+		return err
+	}
+	ch := make(chan string, 1)
+	if _, err := conn.StartTransientUnit(s.unit, "replace", append(properties, resourceProps...), ch); err != nil {
+		return fmt.Errorf("cgroups: starting unit %s: %v", s.unit, err)
+	}
+	if err := waitJob(s.unit, ch); err != nil {
+		return err
+	}
+	s.started = true
+	// systemd only creates the cgroup in the hierarchies it manages and
+	// leaves the resources it does not know about alone.
+	for _, sub := range s.subsystems {
+		if err := initializeSubsystem(sub, s.path, resources); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Update changes the unit properties, so that systemd does not put back the
+// old values when it reloads, and then the cgroup itself.
+func (s *systemdCgroup) Update(resources *Resources) error {
+	s.unitMu.Lock()
+	defer s.unitMu.Unlock()
+	if s.started {
+		properties, err := systemdProperties(resources)
+		if err != nil {
+			return err
+		}
+		if len(properties) > 0 {
+			conn, err := newSystemdConn()
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			if err := conn.SetUnitProperties(s.unit, true, properties...); err != nil {
+				return fmt.Errorf("cgroups: updating unit %s: %v", s.unit, err)
+			}
+		}
+	}
+	s.resources = resources
+	return s.cgroup.Update(resources)
+}
+
+// Delete stops the scope, which removes the cgroups systemd created, and
+// then what is left in the other hierarchies.
+func (s *systemdCgroup) Delete() error {
+	s.unitMu.Lock()
+	defer s.unitMu.Unlock()
+	if s.started {
+		conn, err := newSystemdConn()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		ch := make(chan string, 1)
+		if _, err := conn.StopUnit(s.unit, "replace", ch); err != nil {
+			if !isUnitNotFound(err) {
+				return fmt.Errorf("cgroups: stopping unit %s: %v", s.unit, err)
+			}
+		} else if err := waitJob(s.unit, ch); err != nil {
+			return err
+		}
+		s.started = false
+	}
+	return s.cgroup.Delete()
+}
+
+// systemdProperties translates the resources into the unit properties
+// systemd applies itself.
+func systemdProperties(resources *Resources) ([]systemdDbus.Property, error) {
+	var properties []systemdDbus.Property
+	if cpu := resources.CPU; cpu != nil {
+		if cpu.Shares != nil {
+			if Mode() == Unified {
+				properties = append(properties, newProperty("CPUWeight", convertCPUShares(*cpu.Shares)))
+			} else {
+				properties = append(properties, newProperty("CPUShares", *cpu.Shares))
+			}
+		}
+		if cpu.Quota != nil && *cpu.Quota > 0 {
+			period := uint64(100000)
+			if cpu.Period != nil && *cpu.Period != 0 {
+				period = *cpu.Period
+			}
+			// systemd only accepts whole percents of a cpu, round up.
+			perSec := uint64(*cpu.Quota) * 1000000 / period
+			if perSec%10000 != 0 {
+				perSec = (perSec/10000 + 1) * 10000
+			}
+			properties = append(properties, newProperty("CPUQuotaPerSecUSec", perSec))
+		}
+		// systemd only knows the cpuset of the unified hierarchy, since
+		// v244, the cpuset controller applies it on the others.
+		if cpu.Cpus != "" && Mode() == Unified {
+			bits, err := rangeToBits(cpu.Cpus)
+			if err != nil {
+				return nil, err
+			}
+			properties = append(properties, newProperty("AllowedCPUs", bits))
+		}
+		if cpu.Mems != "" && Mode() == Unified {
+			bits, err := rangeToBits(cpu.Mems)
+			if err != nil {
+				return nil, err
+			}
+			properties = append(properties, newProperty("AllowedMemoryNodes", bits))
+		}
+	}
+	if mem := resources.Memory; mem != nil && mem.Limit != nil {
+		properties = append(properties, newProperty("MemoryMax", systemdLimit(*mem.Limit)))
+	}
+	if pids := resources.Pids; pids != nil && pids.Limit != 0 {
+		properties = append(properties, newProperty("TasksMax", systemdLimit(pids.Limit)))
+	}
+	return properties, nil
+}
+
+// systemdLimit turns a limit where -1 is unlimited into the infinity of
+// systemd.
+func systemdLimit(v int64) uint64 {
+	if v < 0 {
+		return math.MaxUint64
+	}
+	return uint64(v)
+}
+
+// rangeToBits turns a cpuset list like 0-3,6 into the bitmask systemd
+// expects, the first byte holds the first eight cpus.
+func rangeToBits(list string) ([]byte, error) {
+	var bits []byte
+	for _, r := range strings.Split(list, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		bounds := strings.SplitN(r, "-", 2)
+		start, err := strconv.ParseUint(bounds[0], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("cgroups: invalid cpuset list %q: %v", list, err)
+		}
+		end := start
+		if len(bounds) == 2 {
+			if end, err = strconv.ParseUint(bounds[1], 10, 16); err != nil {
+				return nil, fmt.Errorf("cgroups: invalid cpuset list %q: %v", list, err)
+			}
+		}
+		if end < start {
+			return nil, fmt.Errorf("cgroups: invalid cpuset list %q", list)
+		}
+		for i := start; i <= end; i++ {
+			for uint64(len(bits)) <= i/8 {
+				bits = append(bits, 0)
+			}
+			bits[i/8] |= 1 << (i % 8)
+		}
+	}
+	if len(bits) == 0 {
+		return nil, fmt.Errorf("cgroups: empty cpuset list %q", list)
+	}
+	return bits, nil
+}
+
+func waitJob(unit string, ch <-chan string) error {
+	select {
+	case result := <-ch:
+		if result != "done" {
+			return fmt.Errorf("cgroups: job for unit %s finished with %q", unit, result)
+		}
+		return nil
+	case <-time.After(jobTimeout):
+		return fmt.Errorf("cgroups: timed out waiting for the job of unit %s", unit)
+	}
+}
+
+func isUnitNotFound(err error) bool {
+	if dbusError, ok := err.(dbus.Error); ok {
+		return strings.Contains(dbusError.Name, "org.freedesktop.systemd1.NoSuchUnit")
+	}
+	return false
+}
+
+func newProperty(name string, units interface{}) systemdDbus.Property {
+	return systemdDbus.Property{
+		Name:  name,
+		Value: dbus.MakeVariant(units),
+	}
+}
@@ -0,0 +1,336 @@
+package cgroups
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
+	"github.com/godbus/dbus/v5"
+)
+
+func TestExpandSlice(t *testing.T) {
+	for slice, expected := range map[string]string{
+		"-.slice":         "/",
+		"system.slice":    "/system.slice",
+		"a-b-c.slice":     "/a.slice/a-b.slice/a-b-c.slice",
+		".slice":          "",
+		"a--b.slice":      "",
+		"system":          "",
+		"a/b.slice":       "",
+		"user-1000.slice": "/user.slice/user-1000.slice",
+	} {
+		path, err := ExpandSlice(slice)
+		if expected == "" {
+			if err == nil {
+				t.Errorf("expected an error for %q but received %q", slice, path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("expanding %q: %v", slice, err)
+			continue
+		}
+		if path != expected {
+			t.Errorf("expected %q to expand to %q but received %q", slice, expected, path)
+		}
+	}
+}
+
+func TestSystemdProperties(t *testing.T) {
+	var (
+		shares = uint64(512)
+		quota  = int64(12345)
+		memory = int64(-1)
+	)
+	properties, err := systemdProperties(&Resources{
+		CPU: &CpuResource{
+			Shares: &shares,
+			Quota:  &quota,
+			Cpus:   "0-2,9",
+		},
+		Memory: &MemoryResource{Limit: &memory},
+		Pids:   &PidsResource{Limit: 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]interface{})
+	for _, p := range properties {
+		values[p.Name] = p.Value.Value()
+	}
+	expected := map[string]interface{}{
+		"CPUQuotaPerSecUSec": uint64(130000),
+		"MemoryMax":          uint64(math.MaxUint64),
+		"TasksMax":           uint64(10),
+	}
+	if Mode() == Unified {
+		expected["CPUWeight"] = convertCPUShares(shares)
+		expected["AllowedCPUs"] = []byte{0x07, 0x02}
+	} else {
+		expected["CPUShares"] = shares
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Fatalf("expected properties %v but received %v", expected, values)
+	}
+}
+
+func TestRangeToBits(t *testing.T) {
+	bits, err := rangeToBits("0-2,9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []byte{0x07, 0x02}; !reflect.DeepEqual(bits, expected) {
+		t.Fatalf("expected %v but received %v", expected, bits)
+	}
+	if _, err := rangeToBits("3-1"); err == nil {
+		t.Fatal("expected an error for an invalid cpuset list")
+	}
+}
+
+// fakeSystemd implements the part of the systemd manager the driver uses.
+type fakeSystemd struct {
+	conn *dbus.Conn
+
+	mu    sync.Mutex
+	jobs  uint32
+	units map[string]map[string]interface{}
+}
+
+func (f *fakeSystemd) StartTransientUnit(name, mode string, properties []systemdDbus.Property, aux []systemdDbus.PropertyCollection) (dbus.ObjectPath, *dbus.Error) {
+	f.mu.Lock()
+	f.units[name] = make(map[string]interface{})
+	f.mu.Unlock()
+	f.setProperties(name, properties)
+	return f.job(name), nil
+}
+
+func (f *fakeSystemd) StopUnit(name, mode string) (dbus.ObjectPath, *dbus.Error) {
+	f.mu.Lock()
+	_, ok := f.units[name]
+	delete(f.units, name)
+	f.mu.Unlock()
+	if !ok {
+		return "", dbus.NewError("org.freedesktop.systemd1.NoSuchUnit", []interface{}{"Unit " + name + " not loaded."})
+	}
+	return f.job(name), nil
+}
+
+func (f *fakeSystemd) SetUnitProperties(name string, runtime bool, properties []systemdDbus.Property) *dbus.Error {
+	if !f.setProperties(name, properties) {
+		return dbus.NewError("org.freedesktop.systemd1.NoSuchUnit", []interface{}{"Unit " + name + " not loaded."})
+	}
+	return nil
+}
+
+func (f *fakeSystemd) setProperties(name string, properties []systemdDbus.Property) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	unit, ok := f.units[name]
+	if !ok {
+		return false
+	}
+	for _, p := range properties {
+		unit[p.Name] = p.Value.Value()
+	}
+	return true
+}
+
+// job reports a job for the unit that is done right away.
+func (f *fakeSystemd) job(unit string) dbus.ObjectPath {
+	f.mu.Lock()
+	f.jobs++
+	id := f.jobs
+	f.mu.Unlock()
+	path := dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/systemd1/job/%d", id))
+	go f.conn.Emit("/org/freedesktop/systemd1", "org.freedesktop.systemd1.Manager.JobRemoved", id, path, unit, "done")
+	return path
+}
+
+// unit returns a copy of the properties of the unit, nil when it is not
+// running.
+func (f *fakeSystemd) unit(name string) map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	unit, ok := f.units[name]
+	if !ok {
+		return nil
+	}
+	properties := make(map[string]interface{}, len(unit))
+	for k, v := range unit {
+		properties[k] = v
+	}
+	return properties
+}
+
+func (f *fakeSystemd) jobCount() uint32 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.jobs
+}
+
+// startFakeSystemd runs a private bus with a fake systemd on it and points
+// the driver to it.
+func startFakeSystemd(t *testing.T) (*fakeSystemd, func()) {
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon is not available")
+	}
+	dir, err := ioutil.TempDir("", "cgroups-dbus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := filepath.Join(dir, "bus.conf")
+	if err := ioutil.WriteFile(config, []byte(`<busconfig>
+  <type>custom</type>
+  <listen>unix:path=`+filepath.Join(dir, "bus")+`</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow user="*"/>
+    <allow own="*"/>
+    <allow send_destination="*"/>
+    <allow receive_sender="*"/>
+  </policy>
+</busconfig>
+`), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	cmd := exec.Command(daemon, "--config-file="+config, "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	cleanup := func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		os.RemoveAll(dir)
+	}
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	address = strings.TrimSpace(address)
+	dial := func() (*dbus.Conn, error) {
+		conn, err := dbus.Dial(address)
+		if err != nil {
+			return nil, err
+		}
+		if err := conn.Auth(nil); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if err := conn.Hello(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+	conn, err := dial()
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	f := &fakeSystemd{
+		conn:  conn,
+		units: make(map[string]map[string]interface{}),
+	}
+	if err := conn.Export(f, "/org/freedesktop/systemd1", "org.freedesktop.systemd1.Manager"); err != nil {
+		conn.Close()
+		cleanup()
+		t.Fatal(err)
+	}
+	if reply, err := conn.RequestName("org.freedesktop.systemd1", dbus.NameFlagDoNotQueue); err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		conn.Close()
+		cleanup()
+		t.Fatalf("requesting the systemd name: %v %v", reply, err)
+	}
+	original := newSystemdConn
+	newSystemdConn = func() (*systemdDbus.Conn, error) {
+		return systemdDbus.NewConnection(dial)
+	}
+	return f, func() {
+		newSystemdConn = original
+		conn.Close()
+		cleanup()
+	}
+}
+
+func TestSystemdScope(t *testing.T) {
+	f, cleanup := startFakeSystemd(t)
+	defer cleanup()
+	const unit = "godocker-test.scope"
+	memory := int64(1 << 20)
+	// no subsystems so that only the unit is managed
+	s := &systemdCgroup{
+		cgroup: &cgroup{
+			path: filepath.Join("/test.slice", unit),
+		},
+		slice:     "test.slice",
+		unit:      unit,
+		resources: &Resources{Memory: &MemoryResource{Limit: &memory}},
+	}
+	pid := os.Getpid()
+	if err := s.Add(Process{Pid: pid}); err != nil {
+		t.Fatal(err)
+	}
+	properties := f.unit(unit)
+	if properties == nil {
+		t.Fatalf("unit %s was not started", unit)
+	}
+	for name, expected := range map[string]interface{}{
+		"Slice":     "test.slice",
+		"PIDs":      []uint32{uint32(pid)},
+		"Delegate":  true,
+		"MemoryMax": uint64(1 << 20),
+	} {
+		if !reflect.DeepEqual(properties[name], expected) {
+			t.Errorf("expected %s to be %v but received %v", name, expected, properties[name])
+		}
+	}
+	// the scope is only started once
+	if err := s.Add(Process{Pid: pid}); err != nil {
+		t.Fatal(err)
+	}
+	if jobs := f.jobCount(); jobs != 1 {
+		t.Fatalf("expected 1 job but received %d", jobs)
+	}
+
+	if err := s.Update(&Resources{Pids: &PidsResource{Limit: 10}}); err != nil {
+		t.Fatal(err)
+	}
+	if tasks := f.unit(unit)["TasksMax"]; tasks != uint64(10) {
+		t.Fatalf("expected TasksMax to be 10 but received %v", tasks)
+	}
+
+	if err := s.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if f.unit(unit) != nil {
+		t.Fatalf("unit %s was not stopped", unit)
+	}
+	// a unit systemd already forgot about is deleted as well
+	gone := &systemdCgroup{
+		cgroup:  &cgroup{path: s.path},
+		slice:   s.slice,
+		unit:    unit,
+		started: true,
+	}
+	if err := gone.Delete(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,211 @@
+package cgroups
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	cgroupThreads        = "cgroup.threads"
+	cgroupControllers    = "cgroup.controllers"
+	cgroupSubtreeControl = "cgroup.subtree_control"
+)
+
+// hierarchy returns the subsystems of the cgroup hierarchies mounted on the
+// host and the mountpoint of the unified hierarchy when some of them are its
+// controllers. In hybrid mode a controller is taken from the unified
+// hierarchy only when it is not mounted as a v1 controller.
+func hierarchy() ([]Subsystem, string, error) {
+	switch Mode() {
+	case Unified:
+		subsystems, err := defaultsV2(unifiedMountpoint)
+		return subsystems, unifiedMountpoint, err
+	case Legacy, Hybrid:
+		mountpoints, err := v1Mounts()
+		if err != nil {
+			return nil, "", err
+		}
+		subsystems := v1Subsystems(mountpoints)
+		if Mode() == Legacy {
+			return subsystems, "", nil
+		}
+		root := filepath.Join(unifiedMountpoint, "unified")
+		unified, err := defaultsV2(root)
+		if err != nil {
+			return nil, "", err
+		}
+		var v2 []Subsystem
+		for _, s := range unified {
+			if _, ok := mountpoints[s.Name()]; !ok {
+				v2 = append(v2, s)
+			}
+		}
+		if len(v2) == 0 {
+			return subsystems, "", nil
+		}
+		return append(subsystems, v2...), root, nil
+	}
+	return nil, "", ErrMountPointNotExist
+}
+
+// inUnified reports whether the subsystem is a controller of the unified
+// hierarchy mounted at root.
+func inUnified(s Subsystem, root string) bool {
+	p, ok := s.(pather)
+	return ok && root != "" && p.Path("/") == root
+}
+
+// defaultsV2 returns the known controllers of the unified hierarchy mounted
+// at root that are listed in its cgroup.controllers. The freezer and the
+// devices filter are not controllers and are part of every cgroup.
+func defaultsV2(root string) ([]Subsystem, error) {
+	data, err := ioutil.ReadFile(filepath.Join(root, cgroupControllers))
+	if err != nil {
+		return nil, err
+	}
+	available := make(map[Name]bool)
+	for _, c := range strings.Fields(string(data)) {
+		available[Name(c)] = true
+	}
+	s := []Subsystem{
+		NewFreezerV2(root),
+		NewDevicesV2(root),
+	}
+	for _, c := range []Subsystem{
+		NewPidsV2(root),
+		NewCpusetV2(root),
+		NewCpuV2(root),
+		NewMemoryV2(root),
+		NewHugetlbV2(root),
+		NewIo(root),
+		NewRdmaV2(root),
+	} {
+		if available[c.Name()] {
+			s = append(s, c)
+		}
+	}
+	return s, nil
+}
+
+// enableControllers writes the controllers of the subsystems to the
+// cgroup.subtree_control of root and every ancestor of path below it. A
+// cgroup v2 group only gets a controller when its parent delegates it, so
+// this goes top down and creates the ancestors on the way.
+func enableControllers(root, path string, subsystems []Subsystem) error {
+	var controllers []string
+	for _, s := range subsystems {
+		if inUnified(s, root) && s.Name() != Freezer && s.Name() != Devices {
+			controllers = append(controllers, "+"+string(s.Name()))
+		}
+	}
+	if len(controllers) == 0 {
+		return nil
+	}
+	var dirs []string
+	for dir := filepath.Dir(filepath.Join(root, path)); len(dir) >= len(root); dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.MkdirAll(dirs[i], defaultDirPerm); err != nil {
+			return err
+		}
+		if err := retryingWriteFile(
+			filepath.Join(dirs[i], cgroupSubtreeControl),
+			[]byte(strings.Join(controllers, " ")),
+			defaultFilePerm,
+		); err != nil {
+			return fmt.Errorf("cgroups: enabling controllers in %s: %v", dirs[i], err)
+		}
+	}
+	return nil
+}
+
+// readKVFile reads a flat keyed file such as cpu.stat or memory.stat.
+func readKVFile(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var (
+		raw = make(map[string]uint64)
+		sc  = bufio.NewScanner(f)
+	)
+	for sc.Scan() {
+		key, v, err := parseKV(sc.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		raw[key] = v
+	}
+	return raw, sc.Err()
+}
+
+// readMax reads a limit file of the unified hierarchy, "max" is returned as
+// 0 like the pids controller does.
+func readMax(path string) (uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	v := strings.TrimSpace(string(data))
+	if v == "max" {
+		return 0, nil
+	}
+	return parseUint(v, 10, 64)
+}
+
+// formatMax formats a v1 style limit where -1 means unlimited, nil is left
+// unset.
+func formatMax(v *int64) string {
+	switch {
+	case v == nil:
+		return ""
+	case *v == -1:
+		return "max"
+	}
+	return strconv.FormatInt(*v, 10)
+}
+
+// convertCPUShares maps cpu.shares, [2-262144], onto cpu.weight, [1-10000].
+func convertCPUShares(shares uint64) uint64 {
+	if shares < 2 {
+		shares = 2
+	}
+	if shares > 262144 {
+		shares = 262144
+	}
+	return 1 + ((shares-2)*9999)/262142
+}
+
+// convertBlkioWeight maps blkio.weight, [10-1000], onto io.weight, [1-10000].
+func convertBlkioWeight(weight uint64) uint64 {
+	if weight < 10 {
+		weight = 10
+	}
+	if weight > 1000 {
+		weight = 1000
+	}
+	return 1 + ((weight-10)*9999)/990
+}
+
+// convertMemorySwap turns the memory+swap limit of v1 into memory.swap.max,
+// which only limits the swap.
+func convertMemorySwap(limit, swap *int64) (string, error) {
+	switch {
+	case swap == nil:
+		return "", nil
+	case *swap == -1:
+		return "max", nil
+	case limit == nil || *limit == -1:
+		return "", fmt.Errorf("cgroups: a memory+swap limit of %d requires a memory limit", *swap)
+	case *swap < *limit:
+		return "", fmt.Errorf("cgroups: memory+swap limit %d is lower than the memory limit %d", *swap, *limit)
+	}
+	return strconv.FormatInt(*swap-*limit, 10), nil
+}
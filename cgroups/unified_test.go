@@ -0,0 +1,177 @@
+package cgroups
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newMockV2(t *testing.T, controllers string) string {
+	root, err := ioutil.TempDir("", "cgroups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, cgroupControllers), []byte(controllers), defaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestDefaultsV2(t *testing.T) {
+	root := newMockV2(t, "cpuset cpu io memory hugetlb pids rdma\n")
+	defer os.RemoveAll(root)
+	subsystems, err := defaultsV2(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []Name
+	for _, s := range subsystems {
+		names = append(names, s.Name())
+	}
+	expected := []Name{Freezer, Devices, Pids, Cpuset, Cpu, Memory, Hugetlb, Io, Rdma}
+	if len(names) != len(expected) {
+		t.Fatalf("expected subsystems %v but received %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("expected subsystems %v but received %v", expected, names)
+		}
+	}
+}
+
+func TestEnableControllers(t *testing.T) {
+	root := newMockV2(t, "cpu memory\n")
+	defer os.RemoveAll(root)
+	subsystems := []Subsystem{NewFreezerV2(root), NewCpuV2(root), NewMemoryV2(root)}
+	if err := enableControllers(root, "/a/b/test", subsystems); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"", "a", "a/b"} {
+		data, err := ioutil.ReadFile(filepath.Join(root, dir, cgroupSubtreeControl))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "+cpu +memory" {
+			t.Fatalf("expected +cpu +memory in %q but received %q", dir, data)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "a/b/test")); !os.IsNotExist(err) {
+		t.Fatalf("expected the cgroup itself to be left to the subsystems, got %v", err)
+	}
+}
+
+func TestCpuV2(t *testing.T) {
+	root := newMockV2(t, "cpu\n")
+	defer os.RemoveAll(root)
+	var (
+		shares uint64 = 1024
+		quota  int64  = 50000
+		period uint64 = 100000
+		cpu           = NewCpuV2(root)
+	)
+	if err := cpu.Create("test", &Resources{CPU: &CpuResource{Shares: &shares, Quota: &quota, Period: &period}}); err != nil {
+		t.Fatal(err)
+	}
+	for file, expected := range map[string]string{
+		"cpu.weight": "39",
+		"cpu.max":    "50000 100000",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(root, "test", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Fatalf("expected %q in %s but received %q", expected, file, data)
+		}
+	}
+	stat := "usage_usec 3000\nuser_usec 2000\nsystem_usec 1000\nnr_periods 4\nnr_throttled 2\nthrottled_usec 7\n"
+	if err := ioutil.WriteFile(filepath.Join(root, "test", "cpu.stat"), []byte(stat), defaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+	stats := &Stats{CPU: &CPUStat{Throttling: &ThrottlingStat{}, Usage: &CPUUsage{}}}
+	if err := cpu.Stat("test", stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.CPU.Usage.Total != 3000000 || stats.CPU.Usage.Kernel != 1000000 || stats.CPU.Throttling.ThrottledTime != 7000 {
+		t.Fatalf("unexpected cpu stats %+v %+v", stats.CPU.Usage, stats.CPU.Throttling)
+	}
+}
+
+func TestIoV2Stat(t *testing.T) {
+	root := newMockV2(t, "io\n")
+	defer os.RemoveAll(root)
+	stat := "8:0 rbytes=90112 wbytes=4096 rios=3 wios=1 dbytes=0 dios=0\n"
+	if err := ioutil.WriteFile(filepath.Join(root, "io.stat"), []byte(stat), defaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+	var stats Stats
+	if err := NewIo(root).Stat("/", &stats); err != nil {
+		t.Fatal(err)
+	}
+	bytes := stats.Blkio.IoServiceBytesRecursive
+	if len(bytes) != 2 || bytes[0].Op != "Read" || bytes[0].Value != 90112 || bytes[1].Major != 8 {
+		t.Fatalf("unexpected bytes serviced %+v", bytes)
+	}
+	if len(stats.Blkio.IoServicedRecursive) != 2 {
+		t.Fatalf("unexpected ios serviced %+v", stats.Blkio.IoServicedRecursive)
+	}
+}
+
+func TestConvertMemorySwap(t *testing.T) {
+	limit, swap, unlimited := int64(100), int64(300), int64(-1)
+	for _, tc := range []struct {
+		limit, swap *int64
+		expected    string
+		err         bool
+	}{
+		{nil, nil, "", false},
+		{&limit, &unlimited, "max", false},
+		{&limit, &swap, "200", false},
+		{nil, &swap, "", true},
+		{&swap, &limit, "", true},
+	} {
+		v, err := convertMemorySwap(tc.limit, tc.swap)
+		if (err != nil) != tc.err || v != tc.expected {
+			t.Fatalf("expected %q (error %v) but received %q (%v)", tc.expected, tc.err, v, err)
+		}
+	}
+}
+
+func TestMemoryV2OOMEvents(t *testing.T) {
+	root := newMockV2(t, "memory\n")
+	defer os.RemoveAll(root)
+	write := func(name, data string) {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(data), defaultFilePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("memory.events", "low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n")
+	write("cgroup.events", "populated 1\nfrozen 0\n")
+	events, err := NewMemoryV2(root).OOMEvents(context.Background(), "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the kills after the watch started are reported.
+	write("memory.events", "low 0\nhigh 0\nmax 5\noom 2\noom_kill 2\n")
+	if _, ok := <-events; !ok {
+		t.Fatal("expected an oom event")
+	}
+	write("cgroup.events", "populated 0\nfrozen 0\n")
+	if _, ok := <-events; ok {
+		t.Fatal("expected the events to be closed once the cgroup is empty")
+	}
+
+	// nobody reads the events, cancelling still stops the watch.
+	write("cgroup.events", "populated 1\nfrozen 0\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	if events, err = NewMemoryV2(root).OOMEvents(ctx, "/"); err != nil {
+		t.Fatal(err)
+	}
+	write("memory.events", "low 0\nhigh 0\nmax 7\noom 4\noom_kill 3\n")
+	write("memory.events", "low 0\nhigh 0\nmax 9\noom 5\noom_kill 4\n")
+	cancel()
+	for range events {
+	}
+}
@@ -17,6 +17,7 @@ package cgroups
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -24,69 +25,127 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
 )
 
-// v1MountPoint returns the mount point where the cgroup
-// mountpoints are mounted in a single hiearchy
-func getMountPoint() (string, error) {
-	f, err := os.Open("/proc/self/mountinfo")
+const unifiedMountpoint = "/sys/fs/cgroup"
+
+var (
+	cgroupMode CGMode
+	checkMode  sync.Once
+)
+
+// CGMode is the cgroups mode of the host system
+type CGMode int
+
+const (
+	// Unavailable cgroup mountpoint
+	Unavailable CGMode = iota
+	// Legacy cgroups v1
+	Legacy
+	// Hybrid with cgroups v1 controllers and a cgroups v2 mount at
+	// /sys/fs/cgroup/unified
+	Hybrid
+	// Unified with only cgroups v2 mounted
+	Unified
+)
+
+// Mode returns the cgroups mode running on the host
+func Mode() CGMode {
+	checkMode.Do(func() {
+		var st unix.Statfs_t
+		if err := unix.Statfs(unifiedMountpoint, &st); err != nil {
+			cgroupMode = Unavailable
+			return
+		}
+		if st.Type == unix.CGROUP2_SUPER_MAGIC {
+			cgroupMode = Unified
+			return
+		}
+		cgroupMode = Legacy
+		if err := unix.Statfs(filepath.Join(unifiedMountpoint, "unified"), &st); err != nil {
+			return
+		}
+		if st.Type == unix.CGROUP2_SUPER_MAGIC {
+			cgroupMode = Hybrid
+		}
+	})
+	return cgroupMode
+}
+
+// v1Mounts returns the mountpoint of every v1 controller the calling process
+// is part of. Co-mounted controllers such as cpu,cpuacct share one mountpoint
+// and named hierarchies are keyed without their name= prefix. Cgroup paths
+// are always below the mountpoint, even when only a part of the hierarchy is
+// mounted there, e.g. inside of a container.
+func v1Mounts() (map[Name]string, error) {
+	controllers, err := parseCgroupFile("/proc/self/cgroup")
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer f.Close()
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		if err := scanner.Err(); err != nil {
-			return "", err
-		}
-		var (
-			text   = scanner.Text()
-			fields = strings.Split(text, " ")
-			// safe as mountinfo encodes mountpoints with spaces as \040.
-			index               = strings.Index(text, " - ")
-			postSeparatorFields = strings.Fields(text[index+3:])
-			numPostFields       = len(postSeparatorFields)
-		)
-		// format strings:
-		// 26 23 0:22 / /sys/fs/cgroup/cpuset rw,nosuid,nodev,noexec,relatime shared:13 - cgroup cgroup rw,cpuset
-		// postSeparatorFields = ["cgroup", "cgroup", "rw,cpuset"]
-		// filepath.Dir(fields[4]) = filepath.Dir(/sys/fs/cgroup/cpuset) = /sys/fs/cgroup
-
-		// this is an error as we can't detect if the mount is for "cgroup"
-		if numPostFields == 0 {
-			return "", fmt.Errorf("Found no fields post '-' in %q", text)
-		}
-		if postSeparatorFields[0] == "cgroup" {
-			// check that the mount is properly formated.
-			if numPostFields < 3 {
-				return "", fmt.Errorf("Error found less than 3 fields post '-' in %q", text)
+	mounts := make(map[Name]string)
+	for c := range controllers {
+		m, err := getCgroupMount(c)
+		if err != nil {
+			// the controller is enabled but not mounted.
+			if err == ErrNoCgroupMountDestination {
+				continue
 			}
-			return filepath.Dir(fields[4]), nil
+			return nil, err
 		}
+		mounts[Name(strings.TrimPrefix(c, "name="))] = m
 	}
-	return "", ErrMountPointNotExist
+	return mounts, nil
 }
 
-const unifiedMountpoint = "/sys/fs/cgroup"
+// v1Controllers constructs the known v1 subsystems from the directory their
+// hierarchy is mounted at.
+var v1Controllers = []struct {
+	name Name
+	new  func(mountpoint string) Subsystem
+}{
+	{"systemd", func(m string) Subsystem { return &namedController{root: m, name: "systemd"} }},
+	{Freezer, func(m string) Subsystem { return &freezerController{root: m} }},
+	{Devices, func(m string) Subsystem { return &devicesController{root: m} }},
+	{Hugetlb, func(m string) Subsystem {
+		sizes, _ := HugePageSizes()
+		return &hugetlbController{root: m, sizes: sizes}
+	}},
+	{Pids, func(m string) Subsystem { return &pidsController{root: m} }},
+	{NetCLS, func(m string) Subsystem { return &netclsController{root: m} }},
+	{NetPrio, func(m string) Subsystem { return &netprioController{root: m} }},
+	{Cpuset, func(m string) Subsystem { return &cpusetController{root: m} }},
+	{Cpu, func(m string) Subsystem { return &cpuController{root: m} }},
+	{Cpuacct, func(m string) Subsystem { return &cpuacctController{root: m} }},
+	{Memory, func(m string) Subsystem { return &memoryController{root: m, ignored: map[string]struct{}{}} }},
+	{Blkio, func(m string) Subsystem { return &blkioController{root: m, procRoot: "/proc"} }},
+	{PerfEvent, func(m string) Subsystem { return &perfEventController{root: m} }},
+	{Rdma, func(m string) Subsystem { return &rdmaController{root: m} }},
+}
 
-// defaults returns all known groups
+// v1Subsystems returns the known v1 subsystems that have a mountpoint.
+func v1Subsystems(mountpoints map[Name]string) []Subsystem {
+	var s []Subsystem
+	for _, c := range v1Controllers {
+		if m, ok := mountpoints[c.name]; ok {
+			s = append(s, c.new(m))
+		}
+	}
+	return s
+}
+
+// defaults returns all known groups with their hierarchies mounted next to
+// each other under root
 func defaults(root string) ([]Subsystem, error) {
-	s := []Subsystem{
-		NewNamed(root, "systemd"),
-		// NewFreezer(root),
-		NewPids(root),
-		NewNetCls(root),
-		NewNetPrio(root),
-		// NewPerfEvent(root),
-		NewCputset(root),
-		NewCpu(root),
-		NewCpuacct(root),
-		NewMemory(root),
-		// NewBlkio(root),
-		// NewRdma(root),
-	}
-	return s, nil
+	mountpoints := make(map[Name]string)
+	for _, c := range v1Controllers {
+		mountpoints[c.name] = filepath.Join(root, string(c.name))
+	}
+	return v1Subsystems(mountpoints), nil
 }
 
 // remove will remove a cgroup path handling EAGAIN and EBUSY errors and
@@ -105,6 +164,19 @@ func remove(path string) error {
 	return fmt.Errorf("cgroups: unable to remove path %q", path)
 }
 
+// retryingWriteFile writes to a cgroup file, retrying when the kernel returns
+// EINTR as it does when the write races with a signal
+func retryingWriteFile(filename string, data []byte, perm os.FileMode) error {
+	for {
+		err := ioutil.WriteFile(filename, data, perm)
+		if errors.Is(err, unix.EINTR) {
+			logrus.Infof("interrupted while writing %s to %s", string(data), filename)
+			continue
+		}
+		return err
+	}
+}
+
 func readUint(path string) (uint64, error) {
 	v, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -179,24 +251,43 @@ func parseCgroupFromReader(r io.Reader) (map[string]string, error) {
 	return cgroups, nil
 }
 
-func getCgroupDestination(subsystem string) (string, error) {
+// getCgroupMount finds the cgroup v1 mountpoint of the subsystem in mountinfo
+func getCgroupMount(subsystem string) (string, error) {
 	f, err := os.Open("/proc/self/mountinfo")
 	if err != nil {
 		return "", err
 	}
 	defer f.Close()
-	s := bufio.NewScanner(f)
+	return findCgroupMount(f, subsystem)
+}
+
+// findCgroupMount reads mountinfo lines such as
+//
+//	33 32 0:29 / /sys/fs/cgroup/cpu,cpuacct rw,relatime - cgroup cgroup rw,cpu,cpuacct
+func findCgroupMount(r io.Reader, subsystem string) (string, error) {
+	s := bufio.NewScanner(r)
 	for s.Scan() {
-		if err := s.Err(); err != nil {
-			return "", err
+		var (
+			text  = s.Text()
+			index = strings.Index(text, " - ")
+		)
+		if index < 0 {
+			continue
+		}
+		// safe as mountinfo encodes mountpoints with spaces as \040.
+		fields, postSeparatorFields := strings.Fields(text[:index]), strings.Fields(text[index+3:])
+		if len(fields) < 5 || len(postSeparatorFields) < 3 || postSeparatorFields[0] != "cgroup" {
+			continue
 		}
-		fields := strings.Fields(s.Text())
-		for _, opt := range strings.Split(fields[len(fields)-1], ",") {
+		for _, opt := range strings.Split(postSeparatorFields[2], ",") {
 			if opt == subsystem {
-				return fields[3], nil
+				return fields[4], nil
 			}
 		}
 	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
 	return "", ErrNoCgroupMountDestination
 }
 
@@ -0,0 +1,64 @@
+package cgroups
+
+import (
+	"strings"
+	"testing"
+)
+
+const mountinfo = `24 30 0:22 / /sys rw,nosuid,nodev,noexec,relatime shared:7 - sysfs sysfs rw
+32 24 0:28 / /sys/fs/cgroup rw,relatime - tmpfs tmpfs rw,mode=755
+33 32 0:29 / /sys/fs/cgroup/cpu,cpuacct rw,relatime - cgroup cgroup rw,cpu,cpuacct
+36 32 0:32 /docker/abc /cgroup/memory rw,relatime - cgroup cgroup rw,memory
+41 32 0:37 / /sys/fs/cgroup/systemd rw,relatime - cgroup cgroup rw,xattr,name=systemd
+42 32 0:38 / /sys/fs/cgroup/unified rw,relatime - cgroup2 cgroup2 rw
+`
+
+func TestFindCgroupMount(t *testing.T) {
+	for _, tc := range []struct {
+		subsystem string
+		expected  string
+	}{
+		{"cpu", "/sys/fs/cgroup/cpu,cpuacct"},
+		{"cpuacct", "/sys/fs/cgroup/cpu,cpuacct"},
+		{"memory", "/cgroup/memory"},
+		{"name=systemd", "/sys/fs/cgroup/systemd"},
+	} {
+		m, err := findCgroupMount(strings.NewReader(mountinfo), tc.subsystem)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.subsystem, err)
+		}
+		if m != tc.expected {
+			t.Fatalf("%s: expected %s but received %s", tc.subsystem, tc.expected, m)
+		}
+	}
+	if _, err := findCgroupMount(strings.NewReader(mountinfo), "pids"); err != ErrNoCgroupMountDestination {
+		t.Fatalf("expected %v for an unmounted controller but received %v", ErrNoCgroupMountDestination, err)
+	}
+}
+
+func TestV1Subsystems(t *testing.T) {
+	mountpoints := make(map[Name]string)
+	for _, name := range []Name{Cpu, Cpuacct, Memory} {
+		m, err := findCgroupMount(strings.NewReader(mountinfo), string(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mountpoints[name] = m
+	}
+	subsystems := v1Subsystems(mountpoints)
+	// the memory hierarchy is only mounted from /docker/abc, the cgroups are
+	// still created below its mountpoint.
+	expected := map[Name]string{
+		Cpu:     "/sys/fs/cgroup/cpu,cpuacct/test",
+		Cpuacct: "/sys/fs/cgroup/cpu,cpuacct/test",
+		Memory:  "/cgroup/memory/test",
+	}
+	if len(subsystems) != len(expected) {
+		t.Fatalf("expected %d subsystems but received %d", len(expected), len(subsystems))
+	}
+	for _, s := range pathers(subsystems) {
+		if p := s.Path("/test"); p != expected[s.Name()] {
+			t.Fatalf("expected %s path %s but received %s", s.Name(), expected[s.Name()], p)
+		}
+	}
+}
@@ -27,6 +27,10 @@ type Cgroup struct {
 	// This takes precedence over Path.
 	Paths map[string]string
 
+	// Systemd tells the cgroup is a transient scope of systemd, Parent is its
+	// slice and its unit is named after ScopePrefix and Name.
+	Systemd bool `json:"systemd,omitempty"`
+
 	// Resources contains various cgroups settings to apply
 	*Resources
 }
@@ -98,6 +102,12 @@ type Resources struct {
 	// set the freeze value for the process
 	Freezer FreezerState `json:"freezer"`
 
+	// Hugetlb limit (in bytes)
+	HugetlbLimit []*HugepageLimit `json:"hugetlb_limit"`
+
+	// Rdma resource restriction configuration, keyed by the device name
+	Rdma map[string]LinuxRdma `json:"rdma"`
+
 	// Whether to disable OOM Killer
 	OomKillDisable bool `json:"oom_kill_disable"`
 
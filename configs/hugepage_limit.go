@@ -0,0 +1,10 @@
+package configs
+
+// HugepageLimit limits the huge pages of one size a cgroup may use.
+type HugepageLimit struct {
+	// which type of hugepage to limit, e.g. "2MB" or "1GB".
+	Pagesize string `json:"page_size"`
+
+	// usage limit for hugepage.
+	Limit uint64 `json:"limit"`
+}
@@ -0,0 +1,166 @@
+// +build linux
+
+package container
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/lipeining/godocker/configs"
+	"golang.org/x/sys/unix"
+)
+
+var capabilityMap = map[string]int{
+	"CAP_CHOWN":            unix.CAP_CHOWN,
+	"CAP_DAC_OVERRIDE":     unix.CAP_DAC_OVERRIDE,
+	"CAP_DAC_READ_SEARCH":  unix.CAP_DAC_READ_SEARCH,
+	"CAP_FOWNER":           unix.CAP_FOWNER,
+	"CAP_FSETID":           unix.CAP_FSETID,
+	"CAP_KILL":             unix.CAP_KILL,
+	"CAP_SETGID":           unix.CAP_SETGID,
+	"CAP_SETUID":           unix.CAP_SETUID,
+	"CAP_SETPCAP":          unix.CAP_SETPCAP,
+	"CAP_LINUX_IMMUTABLE":  unix.CAP_LINUX_IMMUTABLE,
+	"CAP_NET_BIND_SERVICE": unix.CAP_NET_BIND_SERVICE,
+	"CAP_NET_BROADCAST":    unix.CAP_NET_BROADCAST,
+	"CAP_NET_ADMIN":        unix.CAP_NET_ADMIN,
+	"CAP_NET_RAW":          unix.CAP_NET_RAW,
+	"CAP_IPC_LOCK":         unix.CAP_IPC_LOCK,
+	"CAP_IPC_OWNER":        unix.CAP_IPC_OWNER,
+	"CAP_SYS_MODULE":       unix.CAP_SYS_MODULE,
+	"CAP_SYS_RAWIO":        unix.CAP_SYS_RAWIO,
+	"CAP_SYS_CHROOT":       unix.CAP_SYS_CHROOT,
+	"CAP_SYS_PTRACE":       unix.CAP_SYS_PTRACE,
+	"CAP_SYS_PACCT":        unix.CAP_SYS_PACCT,
+	"CAP_SYS_ADMIN":        unix.CAP_SYS_ADMIN,
+	"CAP_SYS_BOOT":         unix.CAP_SYS_BOOT,
+	"CAP_SYS_NICE":         unix.CAP_SYS_NICE,
+	"CAP_SYS_RESOURCE":     unix.CAP_SYS_RESOURCE,
+	"CAP_SYS_TIME":         unix.CAP_SYS_TIME,
+	"CAP_SYS_TTY_CONFIG":   unix.CAP_SYS_TTY_CONFIG,
+	"CAP_MKNOD":            unix.CAP_MKNOD,
+	"CAP_LEASE":            unix.CAP_LEASE,
+	"CAP_AUDIT_WRITE":      unix.CAP_AUDIT_WRITE,
+	"CAP_AUDIT_CONTROL":    unix.CAP_AUDIT_CONTROL,
+	"CAP_SETFCAP":          unix.CAP_SETFCAP,
+	"CAP_MAC_OVERRIDE":     unix.CAP_MAC_OVERRIDE,
+	"CAP_MAC_ADMIN":        unix.CAP_MAC_ADMIN,
+	"CAP_SYSLOG":           unix.CAP_SYSLOG,
+	"CAP_WAKE_ALARM":       unix.CAP_WAKE_ALARM,
+	"CAP_BLOCK_SUSPEND":    unix.CAP_BLOCK_SUSPEND,
+	"CAP_AUDIT_READ":       unix.CAP_AUDIT_READ,
+	// not known to x/sys yet.
+	"CAP_PERFMON":            38,
+	"CAP_BPF":                39,
+	"CAP_CHECKPOINT_RESTORE": 40,
+}
+
+// containerCapabilities are the capability sets that the container's
+// process is started with.
+type containerCapabilities struct {
+	bounding    []int
+	effective   []int
+	inheritable []int
+	permitted   []int
+	ambient     []int
+}
+
+func capSlice(names []string) ([]int, error) {
+	var caps []int
+	for _, c := range names {
+		v, ok := capabilityMap[c]
+		if !ok {
+			return nil, fmt.Errorf("unknown capability %q", c)
+		}
+		caps = append(caps, v)
+	}
+	return caps, nil
+}
+
+// newContainerCapList returns the capabilities for the config.
+func newContainerCapList(capConfig *configs.Capabilities) (*containerCapabilities, error) {
+	var (
+		c   containerCapabilities
+		err error
+	)
+	for _, set := range []struct {
+		dst   *[]int
+		names []string
+	}{
+		{&c.bounding, capConfig.Bounding},
+		{&c.effective, capConfig.Effective},
+		{&c.inheritable, capConfig.Inheritable},
+		{&c.permitted, capConfig.Permitted},
+		{&c.ambient, capConfig.Ambient},
+	} {
+		if *set.dst, err = capSlice(set.names); err != nil {
+			return nil, err
+		}
+	}
+	return &c, nil
+}
+
+// lastCap returns the highest capability supported by the running kernel.
+func lastCap() (int, error) {
+	data, err := ioutil.ReadFile("/proc/sys/kernel/cap_last_cap")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// ApplyBoundingSet drops every capability of the calling thread's bounding
+// set that is not listed in the config.
+func (c *containerCapabilities) ApplyBoundingSet() error {
+	last, err := lastCap()
+	if err != nil {
+		return err
+	}
+	keep := make(map[int]bool, len(c.bounding))
+	for _, v := range c.bounding {
+		keep[v] = true
+	}
+	for v := 0; v <= last; v++ {
+		if keep[v] {
+			continue
+		}
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(v), 0, 0, 0); err != nil {
+			return fmt.Errorf("dropping capability %d from the bounding set: %v", v, err)
+		}
+	}
+	return nil
+}
+
+// ApplyCaps sets the effective, permitted, inheritable and ambient sets of
+// the calling thread, they are inherited by the process it execs.
+func (c *containerCapabilities) ApplyCaps() error {
+	var (
+		hdr  = unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+		data [2]unix.CapUserData
+	)
+	for _, set := range []struct {
+		dst  func(*unix.CapUserData) *uint32
+		caps []int
+	}{
+		{func(d *unix.CapUserData) *uint32 { return &d.Effective }, c.effective},
+		{func(d *unix.CapUserData) *uint32 { return &d.Permitted }, c.permitted},
+		{func(d *unix.CapUserData) *uint32 { return &d.Inheritable }, c.inheritable},
+	} {
+		for _, v := range set.caps {
+			*set.dst(&data[v/32]) |= 1 << uint(v%32)
+		}
+	}
+	if err := unix.Capset(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("capset: %v", err)
+	}
+	for _, v := range c.ambient {
+		// ambient capabilities need to be in the permitted and inheritable
+		// sets, the kernel refuses to raise them otherwise.
+		if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_RAISE, uintptr(v), 0, 0); err != nil {
+			return fmt.Errorf("raising ambient capability %d: %v", v, err)
+		}
+	}
+	return nil
+}
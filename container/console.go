@@ -0,0 +1,76 @@
+// +build linux
+
+package container
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// setupConsole sets up the console from inside the container, and sends the
+// master pty fd over the console socket (using cmsg). Creating it from the
+// container's own /dev/ptmx keeps the console scoped to the container's devpts
+// instance, so this has to be run *after* we've pivoted to the new rootfs.
+func setupConsole(socket *os.File) error {
+	master, slavePath, err := newPty()
+	if err != nil {
+		return err
+	}
+	// After we return from here, we don't need the console anymore.
+	defer master.Close()
+
+	// Send the master fd to the parent over the console socket.
+	rights := unix.UnixRights(int(master.Fd()))
+	if err := unix.Sendmsg(int(socket.Fd()), []byte(master.Name()), rights, nil, 0); err != nil {
+		return fmt.Errorf("sending console master: %v", err)
+	}
+	// Now, dup over all the things.
+	return dupStdio(slavePath)
+}
+
+// newPty opens a new pseudoterminal master from the container's /dev/ptmx
+// and returns it with the path of its slave end.
+func newPty() (*os.File, string, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	ptn, err := unix.IoctlGetInt(int(master.Fd()), unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+		return nil, "", err
+	}
+	// unlockpt(3)
+	if err := unix.IoctlSetPointerInt(int(master.Fd()), unix.TIOCSPTLCK, 0); err != nil {
+		master.Close()
+		return nil, "", err
+	}
+	return master, fmt.Sprintf("/dev/pts/%d", ptn), nil
+}
+
+// dupStdio opens the slavePath for the console and dups the fds to the current
+// processes stdio, fd 0,1,2.
+func dupStdio(slavePath string) error {
+	fd, err := unix.Open(slavePath, unix.O_RDWR, 0)
+	if err != nil {
+		return &os.PathError{
+			Op:   "open",
+			Path: slavePath,
+			Err:  err,
+		}
+	}
+	for _, i := range []int{0, 1, 2} {
+		if err := unix.Dup3(fd, i, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setCtty makes the terminal on stdin the controlling terminal of the
+// current session.
+func setCtty() error {
+	return unix.IoctlSetInt(0, unix.TIOCSCTTY, 0)
+}
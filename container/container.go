@@ -1,11 +1,57 @@
 package container
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/lipeining/godocker/cgroups"
+	"github.com/lipeining/godocker/configs"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// Status is the status of a container.
+type Status int
+
+const (
+	// Created is the status that denotes the container exists but has not been run yet.
+	Created Status = iota
+	// Running is the status that denotes the container exists and is running.
+	Running
+	// Paused is the status that denotes the container exists, but all its processes are paused.
+	Paused
+	// Stopped is the status that denotes the container does not have a created or running process.
+	Stopped
 )
 
+func (s Status) String() string {
+	switch s {
+	case Created:
+		return "created"
+	case Running:
+		return "running"
+	case Paused:
+		return "paused"
+	case Stopped:
+		return "stopped"
+	default:
+		return "unknown"
+	}
+}
+
 // BaseContainer is a libcontainer container object.
 //
 // Each container is thread-safe within the same process. Since a container can
@@ -15,27 +61,27 @@ type BaseContainer interface {
 	// Returns the ID of the container
 	ID() string
 
-	// // Returns the current status of the container.
-	// //
-	// // errors:
-	// // ContainerNotExists - Container no longer exists,
-	// // Systemerror - System error.
-	// Status() (Status, error)
+	// Returns the current status of the container.
+	//
+	// errors:
+	// ContainerNotExists - Container no longer exists,
+	// Systemerror - System error.
+	Status() (Status, error)
 
-	// // State returns the current container's state information.
-	// //
-	// // errors:
-	// // SystemError - System error.
-	// State() (*State, error)
+	// State returns the current container's state information.
+	//
+	// errors:
+	// SystemError - System error.
+	State() (*State, error)
 
-	// // OCIState returns the current container's state information.
-	// //
-	// // errors:
-	// // SystemError - System error.
-	// OCIState() (*specs.State, error)
+	// OCIState returns the current container's state information.
+	//
+	// errors:
+	// SystemError - System error.
+	OCIState() (*specs.State, error)
 
-	// // Returns the current config of the container.
-	// Config() configs.Config
+	// Returns the current config of the container.
+	Config() configs.Config
 
 	// Returns the PIDs inside this container. The PIDs are in the namespace of the calling process.
 	//
@@ -47,20 +93,24 @@ type BaseContainer interface {
 	// the Container state is PAUSED in which case every PID in the slice is valid.
 	Processes() ([]int, error)
 
-	// // Returns statistics for the container.
-	// //
-	// // errors:
-	// // ContainerNotExists - Container no longer exists,
-	// // Systemerror - System error.
-	// Stats() (*Stats, error)
+	// Returns statistics for the container, the network statistics are
+	// only reported for a container with its own network namespace.
+	//
+	// errors:
+	// ContainerNotExists - Container no longer exists,
+	// ContainerNotRunning - Container is stopped,
+	// Systemerror - System error.
+	Stats() (*cgroups.Stats, error)
 
-	// // Set resources of container as configured
-	// //
-	// // We can use this to change resources when containers are running.
-	// //
-	// // errors:
-	// // SystemError - System error.
-	// Set(config configs.Config) error
+	// Set resources of container as configured
+	//
+	// We can use this to change resources when containers are running. The
+	// previous resources are restored when any of them cannot be applied.
+	//
+	// errors:
+	// ContainerNotRunning - Container is stopped,
+	// SystemError - System error.
+	Set(config configs.Config) error
 
 	// Start a process inside the container. Returns error if process fails to
 	// start. You can track process lifecycle with passed Process structure.
@@ -156,50 +206,727 @@ type Container interface {
 	// ContainerNotPaused - Container is not paused,
 	// Systemerror - System error.
 	Resume() error
+
+	// NotifyOOM returns a read-only channel signaling when the container's
+	// processes are killed by the oom killer, each event is also recorded in
+	// the container's state. Kills that happen while an event is still
+	// pending are merged into it. The channel is closed once ctx is done or
+	// the container's cgroup is gone.
+	//
+	// The kills are only recorded while the channel is open, there is no
+	// process watching the container on its own.
+	//
+	// errors:
+	// ContainerNotExists - Container no longer exists,
+	// Systemerror - System error.
+	NotifyOOM(ctx context.Context) (<-chan struct{}, error)
 }
 
 type linuxContainer struct {
-	id   string
-	root string
-	// cgroupManager        cgroups.Manager
-	initPath    string
-	initArgs    []string
-	initProcess InitProcess
-	m           sync.Mutex
-	created     time.Time
+	id                   string
+	root                 string
+	config               *configs.Config
+	cgroupManager        cgroups.Cgroup
+	initPath             string
+	initArgs             []string
+	initProcess          parentProcess
+	initProcessStartTime uint64
+	m                    sync.Mutex
+	state                containerState
+	fifo                 *os.File
+	created              time.Time
+	oomKilled            bool
 }
 
 func (l *linuxContainer) ID() string {
 	return l.id
 }
+func (l *linuxContainer) Status() (Status, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.currentStatus()
+}
+func (l *linuxContainer) Config() configs.Config {
+	return *l.config
+}
+func (l *linuxContainer) State() (*State, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.currentState()
+}
+func (l *linuxContainer) OCIState() (*specs.State, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.currentOCIState()
+}
+
+// currentOCIState returns the state as defined by the runtime-spec, the pid
+// is only set while init is alive.
+func (l *linuxContainer) currentOCIState() (*specs.State, error) {
+	status, err := l.currentStatus()
+	if err != nil {
+		return nil, err
+	}
+	bundle, annotations := annotations(l.config.Labels)
+	state := &specs.State{
+		Version:     specs.Version,
+		ID:          l.id,
+		Status:      status.String(),
+		Bundle:      bundle,
+		Annotations: annotations,
+	}
+	if status != Stopped && l.initProcess != nil {
+		state.Pid = l.initProcess.pid()
+	}
+	return state, nil
+}
+
 func (l *linuxContainer) Processes() ([]int, error) {
-	return nil, nil
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.cgroupManager == nil {
+		return nil, nil
+	}
+	pids, err := cgroupPids(l.cgroupManager)
+	if err != nil {
+		return nil, fmt.Errorf("getting all container pids from cgroups: %v", err)
+	}
+	return pids, nil
+}
+
+// cgroupPids returns the pids in the cgroup and all of its descendants. Every
+// hierarchy should hold the same processes, the freezer one is read as it is
+// what pausing acts on, another one is picked in a fixed order without it.
+func cgroupPids(m cgroups.Cgroup) ([]int, error) {
+	paths := m.Paths()
+	subsystem := cgroups.Freezer
+	if _, ok := paths[subsystem]; !ok {
+		names := make([]string, 0, len(paths))
+		for name := range paths {
+			names = append(names, string(name))
+		}
+		if len(names) == 0 {
+			return nil, cgroups.ErrCgroupDeleted
+		}
+		sort.Strings(names)
+		subsystem = cgroups.Name(names[0])
+	}
+	procs, err := m.Processes(subsystem, true)
+	if err != nil {
+		return nil, err
+	}
+	pids := make([]int, 0, len(procs))
+	for _, p := range procs {
+		pids = append(pids, p.Pid)
+	}
+	return pids, nil
 }
 func (l *linuxContainer) Start(process *Process) error {
+	l.m.Lock()
+	defer l.m.Unlock()
+	status, err := l.currentStatus()
+	if err != nil {
+		return err
+	}
+	if !process.Init {
+		switch status {
+		case Stopped:
+			return ErrNotRunning
+		case Paused:
+			return ErrPaused
+		}
+		return l.startSetns(process)
+	}
+	if l.initProcess != nil {
+		if status == Stopped {
+			return ErrStopped
+		}
+		return fmt.Errorf("cannot start a container in the %s state", status)
+	}
+	if err := l.createExecFifo(); err != nil {
+		return err
+	}
+	if err := l.start(process); err != nil {
+		l.deleteExecFifo()
+		return err
+	}
 	return nil
 }
 func (l *linuxContainer) Run(process *Process) error {
+	if err := l.Start(process); err != nil {
+		return err
+	}
+	if process.Init {
+		return l.exec()
+	}
 	return nil
 }
 func (l *linuxContainer) Destroy() error {
-	return nil
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.state.destroy()
 }
 func (l *linuxContainer) Signal(s os.Signal, all bool) error {
+	l.m.Lock()
+	defer l.m.Unlock()
+	status, err := l.currentStatus()
+	if err != nil {
+		return err
+	}
+	if all {
+		// without a pid namespace processes may outlive init, they can
+		// still be found through the cgroup.
+		if l.cgroupManager == nil {
+			if status == Stopped {
+				return ErrNotRunning
+			}
+			return fmt.Errorf("container %s has no cgroup to find its processes in", l.id)
+		}
+		return signalAllProcesses(l.cgroupManager, s)
+	}
+	// currentStatus checked the start time of the init pid, so we do not
+	// signal an unrelated process that reused it.
+	if status == Stopped {
+		return ErrNotRunning
+	}
+	if err := l.initProcess.signal(s); err != nil {
+		return fmt.Errorf("signaling init process: %v", err)
+	}
+	// a frozen process does not act on SIGKILL before it is thawed.
+	if status == Paused && s == unix.SIGKILL {
+		if err := l.cgroupManager.Thaw(); err != nil {
+			return err
+		}
+		l.setFreezerState(configs.Thawed)
+		return l.refreshState()
+	}
+	return nil
+}
+
+// signalAllProcesses freezes the cgroup so that no process can fork while we
+// go through cgroup.procs, signals every process in it and thaws it again. A
+// paused container is left frozen.
+func signalAllProcesses(m cgroups.Cgroup, s os.Signal) error {
+	sig, ok := s.(unix.Signal)
+	if !ok {
+		return errors.New("os: unsupported signal type")
+	}
+	paused := m.State() == cgroups.Frozen
+	if err := m.Freeze(); err != nil {
+		logrus.Warn(err)
+	}
+	pids, err := cgroupPids(m)
+	if err != nil {
+		m.Thaw()
+		return err
+	}
+	for _, pid := range pids {
+		if err := unix.Kill(pid, sig); err != nil && err != unix.ESRCH {
+			logrus.Warnf("signaling pid %d: %v", pid, err)
+		}
+	}
+	if paused && sig != unix.SIGKILL {
+		return nil
+	}
+	if err := m.Thaw(); err != nil {
+		logrus.Warn(err)
+	}
 	return nil
 }
 func (l *linuxContainer) Exec() error {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.exec()
+}
+
+// exec releases the init blocked on the exec fifo by opening the reading
+// end, init then execs the user process.
+func (l *linuxContainer) exec() error {
+	path := filepath.Join(l.root, execFifoFilename)
+	pid := l.initProcess.pid()
+	blockingFifoOpenCh := awaitFifoOpen(path)
+	for {
+		select {
+		case result := <-blockingFifoOpenCh:
+			if err := handleFifoResult(result); err != nil {
+				return err
+			}
+			// the fifo is gone, record that the container runs now.
+			return l.refreshState()
+
+		case <-time.After(time.Millisecond * 100):
+			stat, err := GetProcStat(pid)
+			if err != nil || stat.isDead() {
+				// could be because process started, ran, and completed between our 100ms timeout and our GetProcStat() check.
+				// see if the fifo exists and has data (with a non-blocking open, which will succeed if the writing process is complete).
+				if err := handleFifoResult(fifoOpen(path, false)); err != nil {
+					return errors.New("container process is already dead")
+				}
+				return l.refreshState()
+			}
+		}
+	}
+}
+
+func readFromExecFifo(execFifo io.Reader) error {
+	data, err := ioutil.ReadAll(execFifo)
+	if err != nil {
+		return err
+	}
+	if len(data) <= 0 {
+		return errors.New("cannot start an already running container")
+	}
 	return nil
 }
-func (l *linuxContainer) Pause() error {
+
+func awaitFifoOpen(path string) <-chan openResult {
+	fifoOpened := make(chan openResult)
+	go func() {
+		result := fifoOpen(path, true)
+		fifoOpened <- result
+	}()
+	return fifoOpened
+}
+
+func fifoOpen(path string, block bool) openResult {
+	flags := os.O_RDONLY
+	if !block {
+		flags |= unix.O_NONBLOCK
+	}
+	f, err := os.OpenFile(path, flags, 0)
+	if err != nil {
+		return openResult{err: fmt.Errorf("exec fifo: %v", err)}
+	}
+	return openResult{file: f}
+}
+
+func handleFifoResult(result openResult) error {
+	if result.err != nil {
+		return result.err
+	}
+	f := result.file
+	defer f.Close()
+	if err := readFromExecFifo(f); err != nil {
+		return err
+	}
+	return os.Remove(f.Name())
+}
+
+type openResult struct {
+	file *os.File
+	err  error
+}
+
+func (l *linuxContainer) createExecFifo() error {
+	rootuid, err := l.config.HostRootUID()
+	if err != nil {
+		return err
+	}
+	rootgid, err := l.config.HostRootGID()
+	if err != nil {
+		return err
+	}
+
+	fifoName := filepath.Join(l.root, execFifoFilename)
+	if _, err := os.Stat(fifoName); err == nil {
+		return fmt.Errorf("exec fifo %s already exists", fifoName)
+	}
+	oldMask := unix.Umask(0000)
+	if err := unix.Mkfifo(fifoName, 0622); err != nil {
+		unix.Umask(oldMask)
+		return err
+	}
+	unix.Umask(oldMask)
+	return os.Chown(fifoName, rootuid, rootgid)
+}
+
+func (l *linuxContainer) deleteExecFifo() {
+	fifoName := filepath.Join(l.root, execFifoFilename)
+	os.Remove(fifoName)
+}
+
+// includeExecFifo opens the container's execfifo as a pathfd, so that the
+// container cannot access the statedir (and the FIFO itself remains
+// un-opened). It then adds the FifoFd to the given exec.Cmd as an inherited
+// fd, with _LIBCONTAINER_FIFOFD set to its fd number.
+func (l *linuxContainer) includeExecFifo(cmd *exec.Cmd) error {
+	fifoName := filepath.Join(l.root, execFifoFilename)
+	fifoFd, err := unix.Open(fifoName, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	l.fifo = os.NewFile(uintptr(fifoFd), fifoName)
+
+	cmd.ExtraFiles = append(cmd.ExtraFiles, l.fifo)
+	cmd.Env = append(cmd.Env,
+		fmt.Sprintf("_LIBCONTAINER_FIFOFD=%d", stdioFdCount+len(cmd.ExtraFiles)-1))
 	return nil
 }
+func (l *linuxContainer) Pause() error {
+	l.m.Lock()
+	defer l.m.Unlock()
+	status, err := l.currentStatus()
+	if err != nil {
+		return err
+	}
+	if status != Running {
+		return ErrNotRunning
+	}
+	if l.cgroupManager == nil {
+		return cgroups.ErrFreezerNotSupported
+	}
+	if err := l.cgroupManager.Freeze(); err != nil {
+		return err
+	}
+	l.setFreezerState(configs.Frozen)
+	return l.state.transition(&pausedState{c: l})
+}
 func (l *linuxContainer) Resume() error {
+	l.m.Lock()
+	defer l.m.Unlock()
+	status, err := l.currentStatus()
+	if err != nil {
+		return err
+	}
+	if status != Paused {
+		return ErrNotPaused
+	}
+	if err := l.cgroupManager.Thaw(); err != nil {
+		return err
+	}
+	l.setFreezerState(configs.Thawed)
+	return l.state.transition(&runningState{c: l})
+}
+
+// setFreezerState records the freezer state in the config that the
+// transition persists, the freezer cgroup itself stays the source of truth.
+func (l *linuxContainer) setFreezerState(state configs.FreezerState) {
+	if l.config.Cgroups != nil && l.config.Cgroups.Resources != nil {
+		l.config.Cgroups.Resources.Freezer = state
+	}
+}
+
+func (l *linuxContainer) Stats() (*cgroups.Stats, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	status, err := l.currentStatus()
+	if err != nil {
+		return nil, err
+	}
+	if status == Stopped {
+		return nil, ErrNotRunning
+	}
+	if l.cgroupManager == nil {
+		return nil, ErrNotExist
+	}
+	stats, err := l.cgroupManager.Stat(cgroups.IgnoreNotExist)
+	if err != nil {
+		return nil, err
+	}
+	if l.config.Namespaces.Contains(configs.NEWNET) {
+		if stats.Network, err = networkStats(l.initProcess.pid()); err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+func (l *linuxContainer) Set(config configs.Config) error {
+	l.m.Lock()
+	defer l.m.Unlock()
+	status, err := l.currentStatus()
+	if err != nil {
+		return err
+	}
+	if status == Stopped || l.cgroupManager == nil {
+		return ErrNotRunning
+	}
+	if config.Cgroups == nil || config.Cgroups.Resources == nil {
+		return fmt.Errorf("no resources to update")
+	}
+	if err := l.cgroupManager.Update(cgroupResources(config.Cgroups.Resources)); err != nil {
+		// put back the resources the subsystems before the failing one
+		// have already been updated with.
+		if l.config.Cgroups != nil {
+			if err2 := l.cgroupManager.Update(cgroupResources(l.config.Cgroups.Resources)); err2 != nil {
+				logrus.Warnf("restoring the resources of container %s: %v", l.id, err2)
+			}
+		}
+		return err
+	}
+	l.config = &config
+	_, err = l.updateState()
+	return err
+}
+
+func (l *linuxContainer) NotifyOOM(ctx context.Context) (<-chan struct{}, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.cgroupManager == nil {
+		return nil, ErrNotExist
+	}
+	events, err := l.cgroupManager.OOMEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer close(ch)
+		for range events {
+			l.m.Lock()
+			l.oomKilled = true
+			if _, err := l.updateState(); err != nil {
+				logrus.Warnf("recording the oom kill of container %s: %v", l.id, err)
+			}
+			l.m.Unlock()
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// isPaused asks the freezer, a container can only be paused through it.
+func (l *linuxContainer) isPaused() bool {
+	if l.cgroupManager == nil {
+		return false
+	}
+	return l.cgroupManager.State() == cgroups.Frozen
+}
+
+func (l *linuxContainer) start(p *Process) error {
+	parent, err := l.newInitProcess(p)
+	if err != nil {
+		return fmt.Errorf("creating new parent process: %v", err)
+	}
+	if p.Init {
+		// The init owns its own O_PATH fd to the fifo from now on.
+		defer func() {
+			l.fifo.Close()
+			l.fifo = nil
+		}()
+	}
+	if err := parent.start(); err != nil {
+		return fmt.Errorf("starting container process: %v", err)
+	}
+	l.initProcess = parent
+	l.created = time.Now().UTC()
+	p.ops = parent
+	if l.initProcessStartTime, err = parent.startTime(); err != nil {
+		return fmt.Errorf("reading start time of init: %v", err)
+	}
+	// init is now blocked on the exec fifo until someone calls Exec.
+	if err := l.state.transition(&createdState{c: l}); err != nil {
+		return err
+	}
+	if _, err := l.updateState(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (l *linuxContainer) currentStatus() (Status, error) {
+	if err := l.refreshState(); err != nil {
+		return -1, err
+	}
+	return l.state.status(), nil
+}
+
+// refreshState brings the in-memory state in line with what is actually
+// running, a container loaded from disk may have died in the meantime.
+func (l *linuxContainer) refreshState() error {
+	if l.isPaused() {
+		return l.state.transition(&pausedState{c: l})
+	}
+	switch l.runType() {
+	case Created:
+		return l.state.transition(&createdState{c: l})
+	case Running:
+		return l.state.transition(&runningState{c: l})
+	}
+	return l.state.transition(&stoppedState{c: l})
+}
+
+// runType looks at the recorded init process to find out whether the
+// container is still alive. The start time guards against the pid having
+// been reused by an unrelated process.
+func (l *linuxContainer) runType() Status {
+	if l.initProcess == nil {
+		return Stopped
+	}
+	pid := l.initProcess.pid()
+	if pid <= 0 {
+		return Stopped
+	}
+	stat, err := GetProcStat(pid)
+	if err != nil {
+		return Stopped
+	}
+	if stat.StartTime != l.initProcessStartTime || stat.isDead() {
+		return Stopped
+	}
+	// We'll create exec fifo and blocking on it after container is created,
+	// and delete it after start container.
+	if _, err := os.Stat(filepath.Join(l.root, execFifoFilename)); err == nil {
+		return Created
+	}
+	return Running
+}
+
+// startSetns starts an additional process inside the running container.
+func (l *linuxContainer) startSetns(p *Process) error {
+	parent, err := l.newSetnsProcess(p)
+	if err != nil {
+		return fmt.Errorf("creating new setns process: %v", err)
+	}
+	if err := parent.start(); err != nil {
+		return err
+	}
+	p.ops = parent
 	return nil
 }
-func startContainer() {
 
+func (l *linuxContainer) newSetnsProcess(p *Process) (*setnsProcess, error) {
+	state, err := l.currentState()
+	if err != nil {
+		return nil, err
+	}
+	nsPaths, err := joinNamespacePaths(state.NamespacePaths)
+	if err != nil {
+		return nil, err
+	}
+	cmd, pipePair, err := newParentCmd(p, initSetns)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Path = l.initPath
+	cmd.Args = l.initArgs
+	return &setnsProcess{
+		cmd:             cmd,
+		messageSockPair: pipePair,
+		process:         p,
+		config:          l.newInitConfig(p),
+		manager:         l.cgroupManager,
+		bootstrapData:   l.bootstrapData(0, nsPaths),
+	}, nil
 }
 
-func createContainer() {
+// joinNamespacePaths returns the namespaces for nsenter to join as
+// "type:path", user first. Namespaces that we are already a member of are
+// skipped, setns(2) refuses to join the current user namespace.
+func joinNamespacePaths(paths map[configs.NamespaceType]string) ([]string, error) {
+	var nsPaths []string
+	for _, t := range configs.NamespaceTypes() {
+		path, ok := paths[t]
+		if !ok {
+			continue
+		}
+		name := configs.NsName(t)
+		target, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %s: %v", name, err)
+		}
+		if current, err := os.Stat("/proc/self/ns/" + name); err == nil && os.SameFile(target, current) {
+			continue
+		}
+		nsPaths = append(nsPaths, name+":"+path)
+	}
+	return nsPaths, nil
+}
+
+func (l *linuxContainer) newInitProcess(p *Process) (*InitProcess, error) {
+	paths := make(map[configs.NamespaceType]string)
+	for _, ns := range l.config.Namespaces {
+		if ns.Path != "" {
+			paths[ns.Type] = ns.Path
+		}
+	}
+	nsPaths, err := joinNamespacePaths(paths)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := NewInitProcess(p)
+	if err != nil {
+		return nil, err
+	}
+	parent.cmd.Path = l.initPath
+	parent.cmd.Args = l.initArgs
+	parent.cmd.Dir = l.config.Rootfs
+	if p.Init {
+		if err := l.includeExecFifo(parent.cmd); err != nil {
+			return nil, fmt.Errorf("including execfifo in cmd.Exec setup: %v", err)
+		}
+	}
+	parent.config = l.newInitConfig(p)
+	parent.manager = l.cgroupManager
+	parent.bootstrapData = l.bootstrapData(cloneFlags(l.config.Namespaces), nsPaths)
+	return parent, nil
+}
+
+// bootstrapData encodes the namespaces to join and to create, which nsenter
+// reads before the go runtime of the child starts.
+func (l *linuxContainer) bootstrapData(cloneFlags uintptr, nsPaths []string) io.Reader {
+	r := newNetlinkRequest(InitMsg, 0)
+	r.AddData(&Int32msg{
+		Type:  CloneFlagsAttr,
+		Value: uint32(cloneFlags),
+	})
+	if len(nsPaths) > 0 {
+		r.AddData(&Bytemsg{
+			Type:  NsPathsAttr,
+			Value: []byte(strings.Join(nsPaths, ",")),
+		})
+	}
+	// write the id mappings only when we create a new user namespace.
+	if cloneFlags&unix.CLONE_NEWUSER != 0 {
+		r.AddData(&Bytemsg{
+			Type:  UidmapAttr,
+			Value: encodeIDMapping(l.config.UidMappings),
+		})
+		r.AddData(&Bytemsg{
+			Type:  GidmapAttr,
+			Value: encodeIDMapping(l.config.GidMappings),
+		})
+	}
+	if l.config.OomScoreAdj != nil {
+		r.AddData(&Bytemsg{
+			Type:  OomScoreAdjAttr,
+			Value: []byte(strconv.Itoa(*l.config.OomScoreAdj)),
+		})
+	}
+	return bytes.NewReader(r.Serialize())
+}
+
+// encodeIDMapping returns the mappings in the format of /proc/<pid>/uid_map.
+func encodeIDMapping(idMap []configs.IDMap) []byte {
+	var data bytes.Buffer
+	for _, im := range idMap {
+		fmt.Fprintf(&data, "%d %d %d\n", im.ContainerID, im.HostID, im.Size)
+	}
+	return data.Bytes()
+}
 
+func (l *linuxContainer) newInitConfig(process *Process) *initConfig {
+	cfg := &initConfig{
+		Args:             process.Args,
+		Env:              process.Env,
+		Cwd:              process.Cwd,
+		User:             process.User,
+		AdditionalGroups: process.AdditionalGroups,
+		Config:           l.config,
+		ContainerId:      l.id,
+		CreateConsole:    process.ConsoleSocket != nil,
+		PassedFilesCount: len(process.ExtraFiles),
+		Capabilities:     l.config.Capabilities,
+		NoNewPrivileges:  l.config.NoNewPrivileges,
+	}
+	if process.Capabilities != nil {
+		cfg.Capabilities = process.Capabilities
+	}
+	if process.NoNewPrivileges != nil {
+		cfg.NoNewPrivileges = *process.NoNewPrivileges
+	}
+	return cfg
 }
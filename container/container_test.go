@@ -0,0 +1,107 @@
+package container
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lipeining/godocker/cgroups"
+	"github.com/lipeining/godocker/configs"
+	"golang.org/x/sys/unix"
+)
+
+// mockProcess is an init process that is the test itself, so that the
+// container is seen as running.
+type mockProcess struct {
+	parentProcess
+}
+
+func (m *mockProcess) pid() int {
+	return os.Getpid()
+}
+
+// mockCgroup applies the pids limit of an update before the memory limit,
+// which fails with EBUSY like the kernel does when the usage is above it.
+type mockCgroup struct {
+	cgroups.Cgroup
+	busyLimit int64
+	pids      int64
+	memory    int64
+}
+
+func (m *mockCgroup) State() cgroups.State {
+	return cgroups.Thawed
+}
+
+func (m *mockCgroup) Paths() map[cgroups.Name]string {
+	return nil
+}
+
+func (m *mockCgroup) Update(r *cgroups.Resources) error {
+	m.pids = r.Pids.Limit
+	if limit := r.Memory.Limit; limit != nil {
+		if *limit == m.busyLimit {
+			return fmt.Errorf("write memory.limit_in_bytes: %v", unix.EBUSY)
+		}
+		m.memory = *limit
+	}
+	return nil
+}
+
+func TestSetRollback(t *testing.T) {
+	root, err := ioutil.TempDir("", "container")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	start, err := getProcessStartTime(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockCgroup{busyLimit: 1 << 20}
+	old := configs.Config{
+		Cgroups: &configs.Cgroup{
+			Resources: &configs.Resources{Memory: 1 << 30, PidsLimit: 10},
+		},
+	}
+	c := &linuxContainer{
+		id:                   "test",
+		root:                 root,
+		config:               &old,
+		cgroupManager:        m,
+		initProcess:          &mockProcess{},
+		initProcessStartTime: start,
+	}
+	c.state = &runningState{c: c}
+	if err := m.Update(cgroupResources(old.Cgroups.Resources)); err != nil {
+		t.Fatal(err)
+	}
+
+	update := configs.Config{
+		Cgroups: &configs.Cgroup{
+			Resources: &configs.Resources{Memory: 1 << 20, PidsLimit: 20},
+		},
+	}
+	if err := c.Set(update); err == nil {
+		t.Fatal("expected the update to fail")
+	}
+	if m.pids != 10 || m.memory != 1<<30 {
+		t.Fatalf("expected the resources to be rolled back but have pids %d and memory %d", m.pids, m.memory)
+	}
+	if c.config != &old {
+		t.Fatal("expected the config to be kept after a failed update")
+	}
+
+	update.Cgroups.Resources.Memory = 1 << 29
+	if err := c.Set(update); err != nil {
+		t.Fatal(err)
+	}
+	if m.pids != 20 || m.memory != 1<<29 {
+		t.Fatalf("expected the update to be applied but have pids %d and memory %d", m.pids, m.memory)
+	}
+	if _, err := os.Stat(filepath.Join(root, stateFilename)); err != nil {
+		t.Fatalf("expected the state to be saved: %v", err)
+	}
+}
@@ -1,19 +1,27 @@
 package container
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
 	"runtime/debug"
 	"strconv"
 
 	securejoin "github.com/cyphar/filepath-securejoin"
+	"github.com/lipeining/godocker/cgroups"
+	"github.com/lipeining/godocker/configs"
 	"golang.org/x/sys/unix"
 )
 
 const (
-	stateFilename = "state.json"
+	stateFilename    = "state.json"
+	execFifoFilename = "exec.fifo"
 )
 
+var idRegex = regexp.MustCompile(`^[\w+-\.]+$`)
+
 type Factory interface {
 	// Creates a new container with the given id and starts the initial process inside it.
 	// id must be a string containing only letters, digits and underscores and must contain
@@ -31,7 +39,7 @@ type Factory interface {
 	// Systemerror - System error
 	//
 	// On error, any partially created container parts are cleaned up (the operation is atomic).
-	Create(id string) (Container, error)
+	Create(id string, config *configs.Config) (Container, error)
 
 	// Load takes an ID for an existing container and returns the container information
 	// from the state.  This presents a read only view of the container.
@@ -47,7 +55,7 @@ type Factory interface {
 	// Errors:
 	// Pipe connection error
 	// System error
-	// StartInitialization() error
+	StartInitialization() error
 
 	// Type returns info string about factory type (e.g. lxc, libcontainer...)
 	// Type() string
@@ -95,74 +103,95 @@ type LinuxFactory struct {
 	CriuPath string
 }
 
-func (l *LinuxFactory) Create(id string) (Container, error) {
+func (l *LinuxFactory) Create(id string, config *configs.Config) (_ Container, err error) {
 	if l.Root == "" {
-		return nil, nil
+		return nil, fmt.Errorf("invalid root")
+	}
+	if err := l.validateID(id); err != nil {
+		return nil, err
+	}
+	if config.Cgroups == nil {
+		return nil, fmt.Errorf("invalid config: no cgroups")
 	}
-	// if err := l.validateID(id); err != nil {
-	// 	return nil, err
-	// }
 	containerRoot, err := securejoin.SecureJoin(l.Root, id)
 	if err != nil {
 		return nil, err
 	}
 	if _, err := os.Stat(containerRoot); err == nil {
-		return nil, err
+		return nil, fmt.Errorf("container with id exists: %v", id)
 	} else if !os.IsNotExist(err) {
 		return nil, err
 	}
 	if err := os.MkdirAll(containerRoot, 0711); err != nil {
 		return nil, err
 	}
+	// leave nothing behind when the container cannot be created.
+	defer func() {
+		if err != nil {
+			os.RemoveAll(containerRoot)
+		}
+	}()
 	if err := os.Chown(containerRoot, unix.Geteuid(), unix.Getegid()); err != nil {
 		return nil, err
 	}
+	cm, err := newCgroup(config.Cgroups)
+	if err != nil {
+		return nil, fmt.Errorf("creating cgroups for %s: %v", id, err)
+	}
 	c := &linuxContainer{
-		id:       id,
-		root:     containerRoot,
-		initPath: l.InitPath,
-		initArgs: l.InitArgs,
+		id:            id,
+		root:          containerRoot,
+		config:        config,
+		initPath:      l.InitPath,
+		initArgs:      l.InitArgs,
+		cgroupManager: cm,
 	}
+	c.state = &stoppedState{c: c}
 	return c, nil
 }
 
 func (l *LinuxFactory) Load(id string) (Container, error) {
 	if l.Root == "" {
-		return nil, nil
+		return nil, fmt.Errorf("invalid root")
 	}
 	//when load, we need to check id is valid or not.
-	// if err := l.validateID(id); err != nil {
-	// 	return nil, err
-	// }
+	if err := l.validateID(id); err != nil {
+		return nil, err
+	}
 	containerRoot, err := securejoin.SecureJoin(l.Root, id)
 	if err != nil {
 		return nil, err
 	}
-	// state, err := l.loadState(containerRoot, id)
-	// if err != nil {
-	// 	return nil, err
-	// }
-	// r := &Process{
-	// 	processPid:       state.InitProcessPid,
-	// 	processStartTime: state.InitProcessStartTime,
-	// 	fds:              state.ExternalDescriptors,
-	// }
+	state, err := l.loadState(containerRoot, id)
+	if err != nil {
+		return nil, err
+	}
+	r := &nonChildProcess{
+		processPid:       state.InitProcessPid,
+		processStartTime: state.InitProcessStartTime,
+	}
 	c := &linuxContainer{
-		// initProcess:          r,
-		// initProcessStartTime: state.InitProcessStartTime,
-		id: id,
-		// config:               &state.Config,
-		initPath: l.InitPath,
-		initArgs: l.InitArgs,
-		root:     containerRoot,
-	}
-	// c.state = &loadedState{c: c}
-	// if err := c.refreshState(); err != nil {
-	// 	return nil, err
-	// }
-	// if intelrdt.IsCatEnabled() || intelrdt.IsMbaEnabled() {
-	// 	c.intelRdtManager = l.NewIntelRdtManager(&state.Config, id, state.IntelRdtPath)
-	// }
+		initProcess:          r,
+		initProcessStartTime: state.InitProcessStartTime,
+		id:                   id,
+		config:               &state.Config,
+		initPath:             l.InitPath,
+		initArgs:             l.InitArgs,
+		root:                 containerRoot,
+		created:              state.Created,
+		oomKilled:            state.OOMKilled,
+	}
+	c.state = &stoppedState{c: c}
+	// The cgroup may already be gone when the container has been killed
+	// behind our back, that is fine for a container that is only inspected.
+	if state.Config.Cgroups != nil {
+		if cm, err := loadCgroup(state.Config.Cgroups); err == nil {
+			c.cgroupManager = cm
+		}
+	}
+	if err := c.refreshState(); err != nil {
+		return nil, err
+	}
 	return c, nil
 }
 
@@ -170,8 +199,11 @@ func (l *LinuxFactory) Load(id string) (Container, error) {
 // This is a low level implementation detail of the reexec and should not be consumed externally
 func (l *LinuxFactory) StartInitialization() (err error) {
 	var (
-		pipefd      int
-		envInitPipe = os.Getenv("_LIBCONTAINER_INITPIPE")
+		pipefd, fifofd, consoleSocketFd int
+		envInitPipe                     = os.Getenv("_LIBCONTAINER_INITPIPE")
+		envInitType                     = os.Getenv("_LIBCONTAINER_INITTYPE")
+		envFifoFd                       = os.Getenv("_LIBCONTAINER_FIFOFD")
+		envConsole                      = os.Getenv("_LIBCONTAINER_CONSOLE")
 	)
 
 	// Get the INITPIPE.
@@ -181,11 +213,27 @@ func (l *LinuxFactory) StartInitialization() (err error) {
 	}
 
 	var (
-		pipe = os.NewFile(uintptr(pipefd), "pipe")
+		pipe          = os.NewFile(uintptr(pipefd), "pipe")
+		consoleSocket *os.File
 	)
 	defer pipe.Close()
 
-	// Only init processes have FIFOFD.
+	// Only the init process has the exec fifo.
+	fifofd = -1
+	if envFifoFd != "" {
+		if fifofd, err = strconv.Atoi(envFifoFd); err != nil {
+			return fmt.Errorf("unable to convert _LIBCONTAINER_FIFOFD=%s to int: %s", envFifoFd, err)
+		}
+	}
+
+	if envConsole != "" {
+		consoleSocketFd, err = strconv.Atoi(envConsole)
+		if err != nil {
+			return fmt.Errorf("unable to convert _LIBCONTAINER_CONSOLE=%s to int: %s", envConsole, err)
+		}
+		consoleSocket = os.NewFile(uintptr(consoleSocketFd), "console-socket")
+		defer consoleSocket.Close()
+	}
 
 	// clear the current process's environment to clean any libcontainer
 	// specific env vars.
@@ -193,15 +241,15 @@ func (l *LinuxFactory) StartInitialization() (err error) {
 
 	defer func() {
 		// We have an error during the initialization of the container's init,
-		// send it back to the parent process in the form of an initError.
-		// if werr := utils.WriteJSON(pipe, errors.New("system")); werr != nil {
-		// 	fmt.Fprintln(os.Stderr, err)
-		// 	return
-		// }
-		// if werr := utils.WriteJSON(pipe, err); werr != nil {
-		// 	fmt.Fprintln(os.Stderr, err)
-		// 	return
-		// }
+		// send it back to the parent process in the form of an initError. Once
+		// the pipe has been closed there is nobody left to read it, so fall
+		// back to stderr.
+		if err == nil {
+			return
+		}
+		if werr := writeSyncError(pipe, err); werr != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
 	}()
 	defer func() {
 		if e := recover(); e != nil {
@@ -209,17 +257,20 @@ func (l *LinuxFactory) StartInitialization() (err error) {
 		}
 	}()
 
-	// i, err := newContainerInit(it, pipe, consoleSocket, fifofd)
-	// if err != nil {
-	// 	return err
-	// }
+	var config *initConfig
+	if err := json.NewDecoder(pipe).Decode(&config); err != nil {
+		return fmt.Errorf("reading init config: %v", err)
+	}
+	i, err := newContainerInit(initType(envInitType), pipe, consoleSocket, config, fifofd)
+	if err != nil {
+		return err
+	}
 
 	// If Init succeeds, syscall.Exec will not return, hence none of the defers will be called.
-	// return i.Init()
-	return nil
+	return i.Init()
 }
 
-func (l *LinuxFactory) loadState(root, id string) (error, error) {
+func (l *LinuxFactory) loadState(root, id string) (*State, error) {
 	stateFilePath, err := securejoin.SecureJoin(root, stateFilename)
 	if err != nil {
 		return nil, err
@@ -227,15 +278,41 @@ func (l *LinuxFactory) loadState(root, id string) (error, error) {
 	f, err := os.Open(stateFilePath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, err
+			return nil, fmt.Errorf("%w: %s", ErrNotExist, id)
 		}
 		return nil, err
 	}
 	defer f.Close()
-	return nil, nil
-	// var state *State
-	// if err := json.NewDecoder(f).Decode(&state); err != nil {
-	// 	return nil, newGenericError(err, SystemError)
-	// }
-	// return state, nil
+	var state *State
+	if err := json.NewDecoder(f).Decode(&state); err != nil {
+		return nil, fmt.Errorf("decoding state of container %q: %v", id, err)
+	}
+	return state, nil
+}
+
+func (l *LinuxFactory) validateID(id string) error {
+	if !idRegex.MatchString(id) || string(os.PathSeparator)+id != filepath.Clean(string(os.PathSeparator)+id) {
+		return fmt.Errorf("invalid id format: %v", id)
+	}
+	if len(id) > 1024 {
+		return fmt.Errorf("id %q is too long", id)
+	}
+	return nil
+}
+
+// newCgroup returns the cgroup of the config, a transient scope of systemd
+// when the systemd driver is used.
+func newCgroup(c *configs.Cgroup) (cgroups.Cgroup, error) {
+	if c.Systemd {
+		return cgroups.NewSystemd(c.Parent, cgroups.ScopeName(c.ScopePrefix, c.Name), cgroupResources(c.Resources))
+	}
+	return cgroups.NewCgroup(c.Path, cgroupResources(c.Resources))
+}
+
+// loadCgroup loads the existing cgroup of the config.
+func loadCgroup(c *configs.Cgroup) (cgroups.Cgroup, error) {
+	if c.Systemd {
+		return cgroups.LoadSystemd(c.Parent, cgroups.ScopeName(c.ScopePrefix, c.Name))
+	}
+	return cgroups.Load(c.Path)
 }
@@ -0,0 +1,234 @@
+// +build linux
+
+package container
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/lipeining/godocker/configs"
+	"golang.org/x/sys/unix"
+)
+
+type initType string
+
+const (
+	initSetns    initType = "setns"
+	initStandard initType = "standard"
+)
+
+const stdioFdCount = 3
+
+// initConfig is everything the init process needs from its parent to set up
+// the container and exec the user process.
+type initConfig struct {
+	Args             []string              `json:"args"`
+	Env              []string              `json:"env"`
+	Cwd              string                `json:"cwd"`
+	User             string                `json:"user"`
+	AdditionalGroups []string              `json:"additional_groups"`
+	Config           *configs.Config       `json:"config"`
+	Capabilities     *configs.Capabilities `json:"capabilities"`
+	NoNewPrivileges  bool                  `json:"no_new_privileges"`
+	ContainerId      string                `json:"containerid"`
+	CreateConsole    bool                  `json:"create_console"`
+	PassedFilesCount int                   `json:"passed_files_count"`
+}
+
+type initer interface {
+	Init() error
+}
+
+func newContainerInit(t initType, pipe, consoleSocket *os.File, config *initConfig, fifoFd int) (initer, error) {
+	if err := populateProcessEnvironment(config.Env); err != nil {
+		return nil, err
+	}
+	switch t {
+	case initSetns:
+		return &linuxSetnsInit{
+			pipe:          pipe,
+			consoleSocket: consoleSocket,
+			config:        config,
+		}, nil
+	case initStandard:
+		return &linuxStandardInit{
+			pipe:          pipe,
+			consoleSocket: consoleSocket,
+			parentPid:     unix.Getppid(),
+			fifoFd:        fifoFd,
+			config:        config,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown init type %q", t)
+}
+
+// syncParentReady sends to the given pipe a JSON payload which indicates that
+// the init is ready to Exec the child process. It then waits for the parent to
+// indicate that it is cleared to Exec.
+func syncParentReady(pipe io.ReadWriter) error {
+	// Tell parent.
+	if err := writeSync(pipe, procReady); err != nil {
+		return err
+	}
+	// Wait for parent to give the all-clear.
+	return readSync(pipe, procRun)
+}
+
+// populateProcessEnvironment loads the provided environment variables into the
+// current processes's environment.
+func populateProcessEnvironment(env []string) error {
+	for _, pair := range env {
+		p := strings.SplitN(pair, "=", 2)
+		if len(p) < 2 {
+			return fmt.Errorf("invalid environment variable: %q", pair)
+		}
+		if err := os.Setenv(p[0], p[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finalizeNamespace drops the caps, sets the correct user
+// and working dir, and closes any leaked file descriptors
+// before executing the command inside the namespace
+func finalizeNamespace(config *initConfig) error {
+	// Ensure that all unwanted fds we may have accidentally
+	// inherited are marked close-on-exec so they stay out of the
+	// container
+	if err := closeExecFrom(config.PassedFilesCount + 3); err != nil {
+		return fmt.Errorf("close exec fds: %v", err)
+	}
+	var caps *containerCapabilities
+	if config.Capabilities != nil {
+		var err error
+		if caps, err = newContainerCapList(config.Capabilities); err != nil {
+			return err
+		}
+		// drop capabilities in bounding set before changing user
+		if err := caps.ApplyBoundingSet(); err != nil {
+			return fmt.Errorf("apply bounding set: %v", err)
+		}
+	}
+	// preserve existing capabilities while we change users
+	if err := unix.Prctl(unix.PR_SET_KEEPCAPS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("set keep caps: %v", err)
+	}
+	if err := setupUser(config); err != nil {
+		return fmt.Errorf("setup user: %v", err)
+	}
+	if err := unix.Prctl(unix.PR_SET_KEEPCAPS, 0, 0, 0, 0); err != nil {
+		return fmt.Errorf("clear keep caps: %v", err)
+	}
+	if caps != nil {
+		if err := caps.ApplyCaps(); err != nil {
+			return fmt.Errorf("apply caps: %v", err)
+		}
+	}
+	if config.Cwd != "" {
+		if err := unix.Chdir(config.Cwd); err != nil {
+			return fmt.Errorf("chdir to cwd (%q) set in config.json failed: %v", config.Cwd, err)
+		}
+	}
+	return nil
+}
+
+// setupUser changes the groups, gid, and uid for the user inside the container
+func setupUser(config *initConfig) error {
+	uid, gid, err := parseUser(config.User)
+	if err != nil {
+		return err
+	}
+	var groups []int
+	for _, g := range config.AdditionalGroups {
+		gid, err := strconv.Atoi(g)
+		if err != nil {
+			return fmt.Errorf("invalid additional group %q: %v", g, err)
+		}
+		groups = append(groups, gid)
+	}
+	// setgroups(2) is denied inside a user namespace unless the parent
+	// allowed it, so only touch the groups when there is something to set.
+	if len(groups) > 0 || !config.Config.Namespaces.Contains(configs.NEWUSER) {
+		if err := syscall.Setgroups(groups); err != nil {
+			return err
+		}
+	}
+	// x/sys refuses to change credentials of a single thread, the syscall
+	// package applies them to every thread of the runtime.
+	if err := syscall.Setgid(gid); err != nil {
+		return err
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return err
+	}
+	// if we didn't get HOME already, set it to the root of the container.
+	if envHome := os.Getenv("HOME"); envHome == "" {
+		if err := os.Setenv("HOME", "/"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseUser parses a user string in the form uid[:gid].
+func parseUser(user string) (int, int, error) {
+	if user == "" {
+		return 0, 0, nil
+	}
+	parts := strings.SplitN(user, ":", 2)
+	uid, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid uid %q: %v", parts[0], err)
+	}
+	gid := 0
+	if len(parts) == 2 {
+		if gid, err = strconv.Atoi(parts[1]); err != nil {
+			return 0, 0, fmt.Errorf("invalid gid %q: %v", parts[1], err)
+		}
+	}
+	return uid, gid, nil
+}
+
+func setupRlimits(limits []configs.Rlimit) error {
+	for _, rlimit := range limits {
+		if err := unix.Setrlimit(rlimit.Type, &unix.Rlimit{Max: rlimit.Hard, Cur: rlimit.Soft}); err != nil {
+			return fmt.Errorf("error setting rlimit type %v: %v", rlimit.Type, err)
+		}
+	}
+	return nil
+}
+
+// closeExecFrom marks every fd from minFd upwards as close-on-exec.
+func closeExecFrom(minFd int) error {
+	fdList, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		return err
+	}
+	for _, fi := range fdList {
+		fd, err := strconv.Atoi(fi.Name())
+		if err != nil {
+			// ignore non-numeric file names
+			continue
+		}
+		if fd < minFd {
+			continue
+		}
+		// intentionally ignore errors from unix.CloseOnExec as the fd
+		// may be the one used to read /proc/self/fd itself.
+		unix.CloseOnExec(fd)
+	}
+	return nil
+}
+
+// writeSystemProperty writes the value to a path under /proc/sys as determined from the key.
+// For e.g. net.ipv4.ip_forward translated to /proc/sys/net/ipv4/ip_forward.
+func writeSystemProperty(key, value string) error {
+	keyPath := strings.Replace(key, ".", "/", -1)
+	return ioutil.WriteFile(fmt.Sprintf("/proc/sys/%s", keyPath), []byte(value), 0644)
+}
@@ -0,0 +1,121 @@
+// +build linux
+
+package container
+
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+// list of known message types we want to send to bootstrap program
+// The number is randomly chosen to not conflict with known netlink types
+const (
+	InitMsg         uint16 = 62000
+	CloneFlagsAttr  uint16 = 27281
+	NsPathsAttr     uint16 = 27282
+	UidmapAttr      uint16 = 27283
+	GidmapAttr      uint16 = 27284
+	OomScoreAdjAttr uint16 = 27286
+)
+
+const (
+	// nlmsgHdrLen is the size of struct nlmsghdr.
+	nlmsgHdrLen = 16
+	// nlaHdrLen is the size of struct nlattr.
+	nlaHdrLen = 4
+)
+
+// nativeEndian is the byte order of the running machine, nsenter reads the
+// message into C structs.
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	var x uint16 = 1
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// nlaAlign rounds the length up to the netlink attribute alignment.
+func nlaAlign(l int) int {
+	return (l + 3) &^ 3
+}
+
+type netlinkAttr interface {
+	Serialize() []byte
+	Len() int
+}
+
+// Int32msg has the following representation
+// | nlattr len | nlattr type |
+// | uint32 value             |
+type Int32msg struct {
+	Type  uint16
+	Value uint32
+}
+
+// Serialize serializes the message.
+// Int32msg has the following representation
+// | nlattr len | nlattr type |
+// | uint32 value             |
+func (msg *Int32msg) Serialize() []byte {
+	buf := make([]byte, msg.Len())
+	nativeEndian.PutUint16(buf[0:2], uint16(msg.Len()))
+	nativeEndian.PutUint16(buf[2:4], msg.Type)
+	nativeEndian.PutUint32(buf[4:8], msg.Value)
+	return buf
+}
+
+func (msg *Int32msg) Len() int {
+	return nlaHdrLen + 4
+}
+
+// Bytemsg has the following representation
+// | nlattr len | nlattr type |
+// | value              | pad |
+type Bytemsg struct {
+	Type  uint16
+	Value []byte
+}
+
+func (msg *Bytemsg) Serialize() []byte {
+	l := msg.Len()
+	buf := make([]byte, nlaAlign(l))
+	nativeEndian.PutUint16(buf[0:2], uint16(l))
+	nativeEndian.PutUint16(buf[2:4], msg.Type)
+	copy(buf[nlaHdrLen:], msg.Value)
+	return buf
+}
+
+func (msg *Bytemsg) Len() int {
+	return nlaHdrLen + len(msg.Value) + 1 // null-terminated
+}
+
+// netlinkRequest is a struct nlmsghdr followed by its attributes.
+type netlinkRequest struct {
+	Type  uint16
+	Flags uint16
+	attrs []netlinkAttr
+}
+
+func newNetlinkRequest(typ uint16, flags uint16) *netlinkRequest {
+	return &netlinkRequest{Type: typ, Flags: flags}
+}
+
+func (r *netlinkRequest) AddData(attr netlinkAttr) {
+	r.attrs = append(r.attrs, attr)
+}
+
+// Serialize returns the header and attributes of the request, the header
+// carries the length of the whole message.
+func (r *netlinkRequest) Serialize() []byte {
+	var data []byte
+	for _, attr := range r.attrs {
+		data = append(data, attr.Serialize()...)
+	}
+	buf := make([]byte, nlmsgHdrLen, nlmsgHdrLen+len(data))
+	nativeEndian.PutUint32(buf[0:4], uint32(nlmsgHdrLen+len(data)))
+	nativeEndian.PutUint16(buf[4:6], r.Type)
+	nativeEndian.PutUint16(buf[6:8], r.Flags)
+	// nlmsg_seq and nlmsg_pid are unused.
+	return append(buf, data...)
+}
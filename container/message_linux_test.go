@@ -0,0 +1,33 @@
+// +build linux
+
+package container
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNetlinkRequestSerialize(t *testing.T) {
+	r := newNetlinkRequest(InitMsg, 0)
+	r.AddData(&Int32msg{Type: CloneFlagsAttr, Value: 0x20000})
+	r.AddData(&Bytemsg{Type: NsPathsAttr, Value: []byte("net:/a")})
+	data := r.Serialize()
+
+	// header, 8 byte int32 attribute and a 4+7 byte attribute padded to 12.
+	if len(data) != nlmsgHdrLen+8+12 {
+		t.Fatalf("expected %d bytes, got %d", nlmsgHdrLen+8+12, len(data))
+	}
+	if l := nativeEndian.Uint32(data[0:4]); int(l) != len(data) {
+		t.Fatalf("expected message length %d, got %d", len(data), l)
+	}
+	if typ := nativeEndian.Uint16(data[4:6]); typ != InitMsg {
+		t.Fatalf("expected type %d, got %d", InitMsg, typ)
+	}
+	attr := data[nlmsgHdrLen+8:]
+	if l := nativeEndian.Uint16(attr[0:2]); l != 11 {
+		t.Fatalf("expected attribute length 11, got %d", l)
+	}
+	if !bytes.Equal(attr[4:11], []byte("net:/a\x00")) {
+		t.Fatalf("unexpected attribute value %q", attr[4:11])
+	}
+}
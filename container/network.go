@@ -0,0 +1,197 @@
+// +build linux
+
+package container
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/lipeining/godocker/cgroups"
+	"github.com/lipeining/godocker/configs"
+	"golang.org/x/sys/unix"
+)
+
+// ifreqFlags is the part of struct ifreq used by SIOCGIFFLAGS/SIOCSIFFLAGS.
+type ifreqFlags struct {
+	name  [unix.IFNAMSIZ]byte
+	flags uint16
+	_     [22]byte
+}
+
+// setupNetwork brings up the interfaces that live inside the container's
+// network namespace. Only loopback interfaces are created by init, anything
+// else has to be moved into the namespace by the caller between create and
+// start.
+func setupNetwork(config *configs.Config) error {
+	for _, n := range config.Networks {
+		if n.Type != "loopback" {
+			continue
+		}
+		name := n.Name
+		if name == "" {
+			name = "lo"
+		}
+		if err := interfaceUp(name); err != nil {
+			return fmt.Errorf("bringing up %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func interfaceUp(name string) error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	var req ifreqFlags
+	copy(req.name[:unix.IFNAMSIZ-1], name)
+	if err := ioctlIfreq(fd, unix.SIOCGIFFLAGS, &req); err != nil {
+		return err
+	}
+	req.flags |= unix.IFF_UP
+	return ioctlIfreq(fd, unix.SIOCSIFFLAGS, &req)
+}
+
+func ioctlIfreq(fd int, req uintptr, ifr *ifreqFlags) error {
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), req, uintptr(unsafe.Pointer(ifr))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// removeNetworks deletes the host side of the veth pairs of the container.
+// The pair is normally gone together with the network namespace already, a
+// missing interface is not an error.
+func removeNetworks(networks []*configs.Network) error {
+	for _, n := range networks {
+		if n.Type != "veth" || n.HostInterfaceName == "" {
+			continue
+		}
+		iface, err := net.InterfaceByName(n.HostInterfaceName)
+		if err != nil {
+			continue
+		}
+		if err := deleteLink(iface.Index); err != nil {
+			return fmt.Errorf("deleting %s: %v", n.HostInterfaceName, err)
+		}
+	}
+	return nil
+}
+
+// ifInfomsg is a struct ifinfomsg, the header of rtnetlink link messages.
+type ifInfomsg struct {
+	unix.IfInfomsg
+}
+
+func (msg *ifInfomsg) Serialize() []byte {
+	return (*(*[unix.SizeofIfInfomsg]byte)(unsafe.Pointer(&msg.IfInfomsg)))[:]
+}
+
+func (msg *ifInfomsg) Len() int {
+	return unix.SizeofIfInfomsg
+}
+
+// deleteLink sends RTM_DELLINK for the interface and waits for the kernel to
+// acknowledge it.
+func deleteLink(index int) error {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	r := newNetlinkRequest(unix.RTM_DELLINK, unix.NLM_F_REQUEST|unix.NLM_F_ACK)
+	r.AddData(&ifInfomsg{unix.IfInfomsg{
+		Family: unix.AF_UNSPEC,
+		Index:  int32(index),
+	}})
+	if err := unix.Sendto(fd, r.Serialize(), 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return err
+	}
+	buf := make([]byte, unix.Getpagesize())
+	n, _, err := unix.Recvfrom(fd, buf, 0)
+	if err != nil {
+		return err
+	}
+	msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+	if err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		if m.Header.Type != unix.NLMSG_ERROR || len(m.Data) < 4 {
+			continue
+		}
+		if errno := int32(nativeEndian.Uint32(m.Data[0:4])); errno != 0 {
+			return unix.Errno(-errno)
+		}
+	}
+	return nil
+}
+
+// networkStats reads the counters of every interface in the network
+// namespace of the process.
+func networkStats(pid int) ([]*cgroups.NetworkStat, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/net/dev", pid))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseNetDev(f)
+}
+
+// parseNetDev parses /proc/net/dev, two header lines followed by a line per
+// interface:
+//
+//	eth0: 1296 16 0 0 0 0 0 0 936 12 0 0 0 0 0 0
+//
+// the first eight counters are received, the last eight transmitted.
+func parseNetDev(r io.Reader) ([]*cgroups.NetworkStat, error) {
+	var (
+		stats []*cgroups.NetworkStat
+		sc    = bufio.NewScanner(r)
+	)
+	for line := 0; sc.Scan(); line++ {
+		if line < 2 {
+			continue
+		}
+		parts := strings.SplitN(sc.Text(), ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid net/dev line %q", sc.Text())
+		}
+		fields := strings.Fields(parts[1])
+		if len(fields) != 16 {
+			return nil, fmt.Errorf("invalid net/dev line %q", sc.Text())
+		}
+		stat := &cgroups.NetworkStat{
+			Name: strings.TrimSpace(parts[0]),
+		}
+		for _, c := range []struct {
+			index int
+			value *uint64
+		}{
+			{0, &stat.RxBytes},
+			{1, &stat.RxPackets},
+			{2, &stat.RxErrors},
+			{3, &stat.RxDropped},
+			{8, &stat.TxBytes},
+			{9, &stat.TxPackets},
+			{10, &stat.TxErrors},
+			{11, &stat.TxDropped},
+		} {
+			v, err := strconv.ParseUint(fields[c.index], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid net/dev line %q: %v", sc.Text(), err)
+			}
+			*c.value = v
+		}
+		stats = append(stats, stat)
+	}
+	return stats, sc.Err()
+}
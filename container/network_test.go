@@ -0,0 +1,31 @@
+// +build linux
+
+package container
+
+import (
+	"strings"
+	"testing"
+)
+
+const netDev = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:     336       4    0    0    0     0          0         0      336       4    0    0    0     0       0          0
+  eth0:    1296      16    1    2    0     0          0         0      936      12    3    4    0     0       0          0
+`
+
+func TestParseNetDev(t *testing.T) {
+	stats, err := parseNetDev(strings.NewReader(netDev))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 interfaces, got %d", len(stats))
+	}
+	eth0 := stats[1]
+	if eth0.Name != "eth0" || eth0.RxBytes != 1296 || eth0.RxPackets != 16 || eth0.RxErrors != 1 || eth0.RxDropped != 2 {
+		t.Fatalf("unexpected receive counters %+v", eth0)
+	}
+	if eth0.TxBytes != 936 || eth0.TxPackets != 12 || eth0.TxErrors != 3 || eth0.TxDropped != 4 {
+		t.Fatalf("unexpected transmit counters %+v", eth0)
+	}
+}
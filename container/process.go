@@ -1,11 +1,27 @@
 package container
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"syscall"
+
+	"github.com/lipeining/godocker/cgroups"
+	"github.com/lipeining/godocker/configs"
+	"golang.org/x/sys/unix"
 )
 
+var errInvalidProcess = errors.New("invalid process")
+
+type processOperations interface {
+	wait() (*os.ProcessState, error)
+	signal(sig os.Signal) error
+	pid() int
+}
+
 // Process specifies the configuration and IO for a process inside
 // a container.
 type Process struct {
@@ -15,11 +31,89 @@ type Process struct {
 	// Env specifies the environment variables for the process.
 	Env []string
 
+	// User will set the uid and gid of the executing process running inside the container
+	// local to the container's user and group configuration, in the form uid[:gid].
+	User string
+
+	// AdditionalGroups specifies the gids that should be added to supplementary groups
+	// in addition to those that the user belongs to.
+	AdditionalGroups []string
+
 	// Cwd will change the processes current working directory inside the container's rootfs.
 	Cwd string
 
-	// Init 
+	// Stdin is a pointer to a reader which provides the standard input stream.
+	Stdin io.Reader
+
+	// Stdout is a pointer to a writer which receives the standard output stream.
+	Stdout io.Writer
+
+	// Stderr is a pointer to a writer which receives the standard error stream.
+	Stderr io.Writer
+
+	// ExtraFiles specifies additional open files to be inherited by the container
+	ExtraFiles []*os.File
+
+	// ConsoleSocket provides the masterfd console.
+	ConsoleSocket *os.File
+
+	// Capabilities specify the capabilities to keep when executing the process inside the container
+	// All capabilities not specified will be dropped from the processes capability mask
+	Capabilities *configs.Capabilities
+
+	// NoNewPrivileges controls whether processes can gain additional privileges.
+	NoNewPrivileges *bool
+
+	// Init specifies whether the process is the first process in the container.
 	Init bool
+
+	ops processOperations
+}
+
+// Wait waits for the process to exit.
+// Wait releases any resources associated with the Process
+func (p Process) Wait() (*os.ProcessState, error) {
+	if p.ops == nil {
+		return nil, errInvalidProcess
+	}
+	return p.ops.wait()
+}
+
+// Pid returns the process ID
+func (p Process) Pid() (int, error) {
+	if p.ops == nil {
+		return -1, errInvalidProcess
+	}
+	return p.ops.pid(), nil
+}
+
+// Signal sends a signal to the Process.
+func (p Process) Signal(sig os.Signal) error {
+	if p.ops == nil {
+		return errInvalidProcess
+	}
+	return p.ops.signal(sig)
+}
+
+// parentProcess is the container's init as seen from godocker, either a
+// child that was just started or the pid recorded in the container's state.
+type parentProcess interface {
+	// pid returns the pid for the running process.
+	pid() int
+
+	// start starts the process execution.
+	start() error
+
+	// send a SIGKILL to the process and wait for the exit.
+	terminate() error
+
+	// wait waits on the process returning the process state.
+	wait() (*os.ProcessState, error)
+
+	// startTime returns the process start time.
+	startTime() (uint64, error)
+
+	signal(os.Signal) error
 }
 
 type filePair struct {
@@ -27,54 +121,322 @@ type filePair struct {
 	child  *os.File
 }
 
+// newSockPair returns a new unix socket pair, both ends are close-on-exec.
+func newSockPair(name string) (parent *os.File, child *os.File, err error) {
+	fds, err := unix.Socketpair(unix.AF_LOCAL, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return os.NewFile(uintptr(fds[1]), name+"-p"), os.NewFile(uintptr(fds[0]), name+"-c"), nil
+}
+
+// InitProcess is the parent side of the container's init: it owns the
+// re-exec of "/proc/self/exe init" and the socket pair used to hand the
+// configuration over to it and to follow its progress.
 type InitProcess struct {
 	cmd             *exec.Cmd
 	messageSockPair filePair
 	process         *Process
+	config          *initConfig
+	manager         cgroups.Cgroup
+	bootstrapData   io.Reader
 }
 
 // NewInitProcess create a process to init
-func NewInitProcess(process *Process) InitProcess {
-	readPipe, writePipe, _ := os.Pipe()
-	// 调用自身，传入 init 参数，也就是执行 initCommand
-	cmd := exec.Command("/proc/self/exe", "init")
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Cloneflags: syscall.CLONE_NEWUTS | syscall.CLONE_NEWPID | syscall.CLONE_NEWNS |
-			syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC,
-	}
-	// DefaultContainerInfoPath, ContainerLogFileName := "", ""
-	// containerName := "1"
-	tty := true
-	if tty {
-		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-	} else {
-		// // 把日志输出到文件里
-		// logDir := path.Join(DefaultContainerInfoPath, containerName)
-		// if _, err := os.Stat(logDir); err != nil && os.IsNotExist(err) {
-		// 	err := os.MkdirAll(logDir, os.ModePerm)
-		// 	if err != nil {
-		// 		logrus.Errorf("mkdir container log, err: %v", err)
-		// 	}
-		// }
-		// logFileName := path.Join(logDir, ContainerLogFileName)
-		// file, err := os.Create(logFileName)
-		// if err != nil {
-		// 	logrus.Errorf("create log file, err: %v", err)
-		// }
-		// cmd.Stdout = file
-	}
-	// set parent child pipe which use to pass config
-	// how about fix process.ExtraFiles
-	cmd.ExtraFiles = []*os.File{
-		readPipe,
-	}
-	cmd.Env = append(os.Environ(), process.Env...)
-	cmd.Dir = process.Cwd
-	return InitProcess{
+func NewInitProcess(process *Process) (*InitProcess, error) {
+	cmd, pipePair, err := newParentCmd(process, initStandard)
+	if err != nil {
+		return nil, err
+	}
+	return &InitProcess{
 		cmd:             cmd,
-		messageSockPair: filePair{readPipe, writePipe},
+		messageSockPair: pipePair,
 		process:         process,
+	}, nil
+}
+
+// newParentCmd returns the re-exec of "/proc/self/exe init" for the process
+// together with the socket pair used to talk to it.
+func newParentCmd(process *Process, it initType) (*exec.Cmd, filePair, error) {
+	parentPipe, childPipe, err := newSockPair("init")
+	if err != nil {
+		return nil, filePair{}, fmt.Errorf("creating new init pipe: %v", err)
+	}
+	// 调用自身，传入 init 参数，也就是执行 initCommand
+	cmd := exec.Command("/proc/self/exe", "init")
+	cmd.Stdin = process.Stdin
+	cmd.Stdout = process.Stdout
+	cmd.Stderr = process.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+	cmd.ExtraFiles = append(cmd.ExtraFiles, process.ExtraFiles...)
+	if process.ConsoleSocket != nil {
+		cmd.ExtraFiles = append(cmd.ExtraFiles, process.ConsoleSocket)
+		cmd.Env = append(cmd.Env,
+			fmt.Sprintf("_LIBCONTAINER_CONSOLE=%d", stdioFdCount+len(cmd.ExtraFiles)-1),
+		)
+	}
+	// set parent child pipe which use to pass config and sync messages
+	cmd.ExtraFiles = append(cmd.ExtraFiles, childPipe)
+	cmd.Env = append(cmd.Env,
+		fmt.Sprintf("_LIBCONTAINER_INITPIPE=%d", stdioFdCount+len(cmd.ExtraFiles)-1),
+		fmt.Sprintf("_LIBCONTAINER_INITTYPE=%s", it),
+	)
+	return cmd, filePair{parentPipe, childPipe}, nil
+}
+
+func (p *InitProcess) pid() int {
+	return p.cmd.Process.Pid
+}
+
+func (p *InitProcess) startTime() (uint64, error) {
+	return getProcessStartTime(p.pid())
+}
+
+func (p *InitProcess) start() error {
+	err := p.cmd.Start()
+	p.messageSockPair.child.Close()
+	if err != nil {
+		p.messageSockPair.parent.Close()
+		return fmt.Errorf("starting init process command: %v", err)
+	}
+	defer p.messageSockPair.parent.Close()
+	if err := bootstrap(p.cmd, p.messageSockPair.parent, p.bootstrapData); err != nil {
+		return fmt.Errorf("bootstrapping init process: %v", err)
+	}
+	// The child blocks on the pipe until the config is written, so it can
+	// not exec the user process before it has been placed in its cgroups.
+	if p.manager != nil {
+		if err := p.manager.Add(cgroups.Process{Pid: p.pid()}); err != nil {
+			p.terminate()
+			return fmt.Errorf("applying cgroup configuration for process: %v", err)
+		}
+	}
+	if err := p.sendConfig(); err != nil {
+		p.terminate()
+		return fmt.Errorf("sending config to init process: %v", err)
+	}
+	if err := syncWithChild(p.messageSockPair.parent); err != nil {
+		p.terminate()
+		return err
+	}
+	return nil
+}
+
+// bootstrap hands nsenter its bootstrap data and waits for it to report the
+// pid of the process that it forked into the container's namespaces.
+// cmd.Process is switched over to that process, nsenter itself has exited by
+// then and the child is ours to wait for as nsenter cloned it as its sibling.
+func bootstrap(cmd *exec.Cmd, pipe io.ReadWriter, data io.Reader) error {
+	if _, err := io.Copy(pipe, data); err != nil {
+		cmd.Process.Kill()
+		cmd.Process.Wait()
+		return fmt.Errorf("copying bootstrap data to pipe: %v", err)
+	}
+	sync, err := readSyncT(pipe, procPid)
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Process.Wait()
+		return err
+	}
+	status, err := cmd.Process.Wait()
+	if err != nil {
+		return fmt.Errorf("waiting for nsenter: %v", err)
+	}
+	if !status.Success() {
+		return fmt.Errorf("nsenter failed: %s", status)
+	}
+	process, err := os.FindProcess(sync.Pid)
+	if err != nil {
+		return err
+	}
+	cmd.Process = process
+	return nil
+}
+
+// syncWithChild runs the parent side of the sync protocol until the child
+// closes its end of the pipe, it returns any error reported by the child.
+func syncWithChild(pipe io.ReadWriter) error {
+	var sentRun bool
+	ierr := parseSync(pipe, func(sync *syncT) error {
+		switch sync.Type {
+		case procReady:
+			// The child is done with its setup and waits for us to let it
+			// exec the user process.
+			if err := writeSync(pipe, procRun); err != nil {
+				return fmt.Errorf("writing syncT 'run': %v", err)
+			}
+			sentRun = true
+		default:
+			return fmt.Errorf("invalid JSON payload from child: unexpected sync type %q", sync.Type)
+		}
+		return nil
+	})
+	if ierr == nil && !sentRun {
+		ierr = errInitExited
+	}
+	return ierr
+}
+
+func (p *InitProcess) sendConfig() error {
+	return json.NewEncoder(p.messageSockPair.parent).Encode(p.config)
+}
+
+func (p *InitProcess) wait() (*os.ProcessState, error) {
+	err := p.cmd.Wait()
+	if err != nil {
+		return p.cmd.ProcessState, err
+	}
+	return p.cmd.ProcessState, nil
+}
+
+func (p *InitProcess) terminate() error {
+	if p.cmd.Process == nil {
+		return nil
+	}
+	err := p.cmd.Process.Kill()
+	if _, werr := p.wait(); err == nil {
+		err = werr
+	}
+	return err
+}
+
+func (p *InitProcess) signal(sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return errors.New("os: unsupported signal type")
+	}
+	return syscall.Kill(p.pid(), s)
+}
+
+// cloneFlags returns the unshare(2) flags needed to create the namespaces
+// that the container does not join through a path. The cgroup namespace is
+// left out on purpose: init unshares it once it has been moved into the
+// container's cgroups so that they become the root of its view.
+func cloneFlags(namespaces configs.Namespaces) uintptr {
+	var flag uintptr
+	for _, ns := range namespaces {
+		if ns.Path != "" || ns.Type == configs.NEWCGROUP {
+			continue
+		}
+		flag |= uintptr(namespaceFlags[ns.Type])
+	}
+	return flag
+}
+
+var namespaceFlags = map[configs.NamespaceType]int{
+	configs.NEWNET:    unix.CLONE_NEWNET,
+	configs.NEWNS:     unix.CLONE_NEWNS,
+	configs.NEWUSER:   unix.CLONE_NEWUSER,
+	configs.NEWIPC:    unix.CLONE_NEWIPC,
+	configs.NEWUTS:    unix.CLONE_NEWUTS,
+	configs.NEWPID:    unix.CLONE_NEWPID,
+	configs.NEWCGROUP: unix.CLONE_NEWCGROUP,
+}
+
+// setnsProcess is a process started inside an existing container, nsenter
+// joins the container's namespaces before the go runtime of the child starts.
+type setnsProcess struct {
+	cmd             *exec.Cmd
+	messageSockPair filePair
+	process         *Process
+	config          *initConfig
+	manager         cgroups.Cgroup
+	bootstrapData   io.Reader
+}
+
+func (p *setnsProcess) pid() int {
+	return p.cmd.Process.Pid
+}
+
+func (p *setnsProcess) startTime() (uint64, error) {
+	return getProcessStartTime(p.pid())
+}
+
+func (p *setnsProcess) start() error {
+	err := p.cmd.Start()
+	p.messageSockPair.child.Close()
+	if err != nil {
+		p.messageSockPair.parent.Close()
+		return fmt.Errorf("starting setns process: %v", err)
+	}
+	defer p.messageSockPair.parent.Close()
+	if err := bootstrap(p.cmd, p.messageSockPair.parent, p.bootstrapData); err != nil {
+		return fmt.Errorf("bootstrapping setns process: %v", err)
+	}
+	// The child waits for its config before it does anything, so it has
+	// joined the cgroups before the user process runs.
+	if p.manager != nil {
+		if err := p.manager.Add(cgroups.Process{Pid: p.pid()}); err != nil {
+			p.terminate()
+			return fmt.Errorf("adding pid %d to cgroups: %v", p.pid(), err)
+		}
+	}
+	if err := json.NewEncoder(p.messageSockPair.parent).Encode(p.config); err != nil {
+		p.terminate()
+		return fmt.Errorf("writing config to pipe: %v", err)
+	}
+	if err := syncWithChild(p.messageSockPair.parent); err != nil {
+		p.terminate()
+		return fmt.Errorf("executing setns process: %v", err)
+	}
+	return nil
+}
+
+func (p *setnsProcess) wait() (*os.ProcessState, error) {
+	err := p.cmd.Wait()
+	return p.cmd.ProcessState, err
+}
+
+func (p *setnsProcess) terminate() error {
+	if p.cmd.Process == nil {
+		return nil
+	}
+	err := p.cmd.Process.Kill()
+	if _, werr := p.wait(); err == nil {
+		err = werr
+	}
+	return err
+}
+
+func (p *setnsProcess) signal(sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return errors.New("os: unsupported signal type")
+	}
+	return unix.Kill(p.pid(), s)
+}
+
+// nonChildProcess represents a process where the calling process is not
+// the parent process, it is used for containers loaded from their state.
+type nonChildProcess struct {
+	processPid       int
+	processStartTime uint64
+}
+
+func (p *nonChildProcess) start() error {
+	return errors.New("restored process cannot be started")
+}
+
+func (p *nonChildProcess) pid() int {
+	return p.processPid
+}
+
+func (p *nonChildProcess) terminate() error {
+	return errors.New("restored process cannot be terminated")
+}
+
+func (p *nonChildProcess) wait() (*os.ProcessState, error) {
+	return nil, errors.New("restored process cannot be waited on")
+}
+
+func (p *nonChildProcess) startTime() (uint64, error) {
+	return p.processStartTime, nil
+}
+
+func (p *nonChildProcess) signal(s os.Signal) error {
+	proc, err := os.FindProcess(p.processPid)
+	if err != nil {
+		return err
 	}
+	return proc.Signal(s)
 }
@@ -0,0 +1,109 @@
+package container
+
+import (
+	"github.com/lipeining/godocker/cgroups"
+	"github.com/lipeining/godocker/configs"
+)
+
+// cgroupResources translates the container's resource configuration into
+// the settings understood by the cgroups package. Zero values are treated
+// as unset so that the kernel defaults are kept.
+func cgroupResources(r *configs.Resources) *cgroups.Resources {
+	resources := &cgroups.Resources{}
+	if r == nil {
+		return resources
+	}
+	resources.Devices = r.Devices
+	resources.SkipDevices = r.SkipDevices
+	int64p := func(v int64) *int64 {
+		if v == 0 {
+			return nil
+		}
+		return &v
+	}
+	uint64p := func(v uint64) *uint64 {
+		if v == 0 {
+			return nil
+		}
+		return &v
+	}
+	mem := &cgroups.MemoryResource{
+		Limit:       int64p(r.Memory),
+		Reservation: int64p(r.MemoryReservation),
+		Swap:        int64p(r.MemorySwap),
+		Kernel:      int64p(r.KernelMemory),
+		KernelTCP:   int64p(r.KernelMemoryTCP),
+	}
+	if r.MemorySwappiness != nil {
+		swappiness := int64(*r.MemorySwappiness)
+		mem.Swappiness = &swappiness
+	}
+	if r.OomKillDisable {
+		disable := true
+		mem.DisableOOMKiller = &disable
+	}
+	resources.Memory = mem
+	resources.CPU = &cgroups.CpuResource{
+		Shares:          uint64p(r.CpuShares),
+		Quota:           int64p(r.CpuQuota),
+		Period:          uint64p(r.CpuPeriod),
+		RealtimeRuntime: int64p(r.CpuRtRuntime),
+		RealtimePeriod:  uint64p(r.CpuRtPeriod),
+		Cpus:            r.CpusetCpus,
+		Mems:            r.CpusetMems,
+	}
+	resources.Pids = &cgroups.PidsResource{
+		Limit: r.PidsLimit,
+	}
+	blkio := &cgroups.BlockIOResource{
+		Weight:                  uint64(r.BlkioWeight),
+		LeafWeight:              uint64(r.BlkioLeafWeight),
+		ThrottleReadBpsDevice:   throttleDevices(r.BlkioThrottleReadBpsDevice),
+		ThrottleWriteBpsDevice:  throttleDevices(r.BlkioThrottleWriteBpsDevice),
+		ThrottleReadIOPSDevice:  throttleDevices(r.BlkioThrottleReadIOPSDevice),
+		ThrottleWriteIOPSDevice: throttleDevices(r.BlkioThrottleWriteIOPSDevice),
+	}
+	for _, wd := range r.BlkioWeightDevice {
+		blkio.WeightDevice = append(blkio.WeightDevice, cgroups.WeightDevice{
+			Major:      wd.Major,
+			Minor:      wd.Minor,
+			Weight:     uint64(wd.Weight),
+			LeafWeight: uint64(wd.LeafWeight),
+		})
+	}
+	resources.BlockIO = blkio
+	for _, l := range r.HugetlbLimit {
+		resources.HugepageLimits = append(resources.HugepageLimits, cgroups.HugepageLimit{
+			Pagesize: l.Pagesize,
+			Limit:    l.Limit,
+		})
+	}
+	for device, l := range r.Rdma {
+		if resources.Rdma == nil {
+			resources.Rdma = make(map[string]cgroups.RdmaResource)
+		}
+		resources.Rdma[device] = cgroups.RdmaResource{
+			HcaHandles: l.HcaHandles,
+			HcaObjects: l.HcaObjects,
+		}
+	}
+	if r.NetClsClassid != 0 {
+		classID := r.NetClsClassid
+		resources.Network = &cgroups.NetclsResource{
+			ClassID: &classID,
+		}
+	}
+	return resources
+}
+
+func throttleDevices(devices []*configs.ThrottleDevice) []cgroups.ThrottleDevice {
+	var out []cgroups.ThrottleDevice
+	for _, td := range devices {
+		out = append(out, cgroups.ThrottleDevice{
+			Major: td.Major,
+			Minor: td.Minor,
+			Rate:  td.Rate,
+		})
+	}
+	return out
+}
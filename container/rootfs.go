@@ -1,13 +1,22 @@
 package container
 
 import (
+	"bufio"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	securejoin "github.com/cyphar/filepath-securejoin"
+	"github.com/lipeining/godocker/configs"
 	"golang.org/x/sys/unix"
 )
 
+const defaultMountFlags = unix.MS_NOEXEC | unix.MS_NOSUID | unix.MS_NODEV
+
 // pivotRoot will call pivot_root such that rootfs becomes the new root
 // filesystem, and everything else is cleaned up.
 func pivotRoot(rootfs string) error {
@@ -105,30 +114,404 @@ func readonlyPath(path string) error {
 	return unix.Mount(path, path, "", unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY|unix.MS_REC, "")
 }
 
-// // remountReadonly will remount an existing mount point and ensure that it is read-only.
-// func remountReadonly(m *configs.Mount) error {
-// 	var (
-// 		dest  = m.Destination
-// 		flags = m.Flags
-// 	)
-// 	for i := 0; i < 5; i++ {
-// 		// There is a special case in the kernel for
-// 		// MS_REMOUNT | MS_BIND, which allows us to change only the
-// 		// flags even as an unprivileged user (i.e. user namespace)
-// 		// assuming we don't drop any security related flags (nodev,
-// 		// nosuid, etc.). So, let's use that case so that we can do
-// 		// this re-mount without failing in a userns.
-// 		flags |= unix.MS_REMOUNT | unix.MS_BIND | unix.MS_RDONLY
-// 		if err := unix.Mount("", dest, "", uintptr(flags), ""); err != nil {
-// 			switch err {
-// 			case unix.EBUSY:
-// 				time.Sleep(100 * time.Millisecond)
-// 				continue
-// 			default:
-// 				return err
-// 			}
-// 		}
-// 		return nil
-// 	}
-// 	return fmt.Errorf("unable to mount %s as readonly max retries reached", dest)
-// }
+// remountReadonly will remount an existing mount point and ensure that it is read-only.
+func remountReadonly(m *configs.Mount) error {
+	var (
+		dest  = m.Destination
+		flags = m.Flags
+	)
+	for i := 0; i < 5; i++ {
+		// There is a special case in the kernel for
+		// MS_REMOUNT | MS_BIND, which allows us to change only the
+		// flags even as an unprivileged user (i.e. user namespace)
+		// assuming we don't drop any security related flags (nodev,
+		// nosuid, etc.). So, let's use that case so that we can do
+		// this re-mount without failing in a userns.
+		flags |= unix.MS_REMOUNT | unix.MS_BIND | unix.MS_RDONLY
+		if err := unix.Mount("", dest, "", uintptr(flags), ""); err != nil {
+			switch err {
+			case unix.EBUSY:
+				time.Sleep(100 * time.Millisecond)
+				continue
+			default:
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unable to mount %s as readonly max retries reached", dest)
+}
+
+// prepareRootfs sets up the devices, mount points, and filesystems for use
+// inside a new mount namespace. It doesn't set anything as ro. You must call
+// finalizeRootfs after this function to finish setting up the rootfs.
+func prepareRootfs(config *configs.Config) error {
+	if !config.Namespaces.Contains(configs.NEWNS) {
+		return fmt.Errorf("mount namespace is required to set up the rootfs")
+	}
+	if err := prepareRoot(config); err != nil {
+		return fmt.Errorf("preparing rootfs: %v", err)
+	}
+	setupDev := needsSetupDev(config)
+	for _, m := range config.Mounts {
+		if err := mountToRootfs(m, config.Rootfs); err != nil {
+			return fmt.Errorf("mounting %q to rootfs at %q: %v", m.Source, m.Destination, err)
+		}
+	}
+	if setupDev {
+		if err := createDevices(config); err != nil {
+			return fmt.Errorf("creating device nodes: %v", err)
+		}
+		if err := setupPtmx(config); err != nil {
+			return fmt.Errorf("setting up ptmx: %v", err)
+		}
+		if err := setupDevSymlinks(config.Rootfs); err != nil {
+			return fmt.Errorf("setting up /dev symlinks: %v", err)
+		}
+	}
+	if err := unix.Chdir(config.Rootfs); err != nil {
+		return fmt.Errorf("changing dir to %q: %v", config.Rootfs, err)
+	}
+	var err error
+	if config.NoPivotRoot {
+		err = msMoveRoot(config.Rootfs)
+	} else {
+		err = pivotRoot(config.Rootfs)
+	}
+	if err != nil {
+		return fmt.Errorf("jailing process inside rootfs: %v", err)
+	}
+	return nil
+}
+
+// finalizeRootfs sets anything to ro if necessary. You must call
+// prepareRootfs first.
+func finalizeRootfs(config *configs.Config) error {
+	// remount dev as ro if specified
+	for _, m := range config.Mounts {
+		if filepath.Clean(m.Destination) == "/dev" {
+			if m.Flags&unix.MS_RDONLY == unix.MS_RDONLY {
+				if err := remountReadonly(m); err != nil {
+					return fmt.Errorf("remounting %q as readonly: %v", m.Destination, err)
+				}
+			}
+			break
+		}
+	}
+	// set rootfs ( / ) as readonly
+	if config.Readonlyfs {
+		if err := unix.Mount("/", "/", "bind", unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("setting rootfs as readonly: %v", err)
+		}
+	}
+	unix.Umask(0022)
+	return nil
+}
+
+// needsSetupDev returns true if /dev needs to be set up.
+func needsSetupDev(config *configs.Config) bool {
+	for _, m := range config.Mounts {
+		if m.Device == "bind" && filepath.Clean(m.Destination) == "/dev" {
+			return false
+		}
+	}
+	return true
+}
+
+func prepareRoot(config *configs.Config) error {
+	flag := unix.MS_SLAVE | unix.MS_REC
+	if config.RootPropagation != 0 {
+		flag = config.RootPropagation
+	}
+	if err := unix.Mount("", "/", "", uintptr(flag), ""); err != nil {
+		return err
+	}
+	return unix.Mount(config.Rootfs, config.Rootfs, "bind", unix.MS_BIND|unix.MS_REC, "")
+}
+
+func mountToRootfs(m *configs.Mount, rootfs string) error {
+	dest, err := securejoin.SecureJoin(rootfs, m.Destination)
+	if err != nil {
+		return err
+	}
+	switch m.Device {
+	case "tmpfs":
+		stat, err := os.Stat(dest)
+		if err != nil {
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				return err
+			}
+		}
+		if err := mountPropagate(m, dest); err != nil {
+			return err
+		}
+		if stat != nil {
+			if err = os.Chmod(dest, stat.Mode()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "bind":
+		stat, err := os.Stat(m.Source)
+		if err != nil {
+			// error out if the source of a bind mount does not exist as we will be
+			// unable to bind anything to it.
+			return err
+		}
+		if err := createIfNotExists(dest, stat.IsDir()); err != nil {
+			return err
+		}
+		if err := unix.Mount(m.Source, dest, "bind", uintptr(m.Flags|unix.MS_BIND), ""); err != nil {
+			return err
+		}
+		// bind mount won't change mount options, we need remount to make mount options effective.
+		// first check that we have non-default options required before attempting a remount
+		if m.Flags&^(unix.MS_REC|unix.MS_REMOUNT|unix.MS_BIND) != 0 {
+			// only remount if unique mount options are set
+			if err := unix.Mount(m.Source, dest, m.Device, uintptr(m.Flags|unix.MS_REMOUNT|unix.MS_BIND), ""); err != nil {
+				return err
+			}
+		}
+		for _, pflag := range m.PropagationFlags {
+			if err := unix.Mount("", dest, "", uintptr(pflag), ""); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "cgroup":
+		// The v1 hierarchies are not bind mounted into the container yet,
+		// a read-only tmpfs keeps the mountpoint present without exposing
+		// the host's cgroups.
+		if err := os.MkdirAll(dest, 0755); err != nil {
+			return err
+		}
+		tmpfs := &configs.Mount{
+			Source:      "tmpfs",
+			Device:      "tmpfs",
+			Destination: m.Destination,
+			Flags:       defaultMountFlags | unix.MS_RDONLY,
+			Data:        "mode=755",
+		}
+		return mountPropagate(tmpfs, dest)
+	default:
+		if err := os.MkdirAll(dest, 0755); err != nil {
+			return err
+		}
+		return mountPropagate(m, dest)
+	}
+}
+
+// Do the mount operation followed by additional mounts required to take care
+// of propagation flags.
+func mountPropagate(m *configs.Mount, dest string) error {
+	var (
+		data  = m.Data
+		flags = m.Flags
+	)
+	// Delay mounting the filesystem read-only if we need to do further
+	// operations on it. We need to set up files in "/dev" and tmpfs mounts may
+	// need to be chmod-ed after mounting. The mount will be remounted ro later.
+	if filepath.Clean(m.Destination) == "/dev" || m.Device == "tmpfs" {
+		flags &= ^unix.MS_RDONLY
+	}
+	if err := unix.Mount(m.Source, dest, m.Device, uintptr(flags), data); err != nil {
+		return err
+	}
+	for _, pflag := range m.PropagationFlags {
+		if err := unix.Mount("", dest, "", uintptr(pflag), ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createDevices creates the device nodes in the container.
+func createDevices(config *configs.Config) error {
+	useBindMount := config.Namespaces.Contains(configs.NEWUSER)
+	oldMask := unix.Umask(0000)
+	defer unix.Umask(oldMask)
+	for _, node := range config.Devices {
+		// containers running in a user namespace are not allowed to mknod
+		// devices so we can just bind mount it from the host.
+		if err := createDeviceNode(config.Rootfs, node, useBindMount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createDeviceNode creates the device node inside the container.
+func createDeviceNode(rootfs string, node *configs.Device, bind bool) error {
+	if node.Path == "" {
+		// The node only exists for cgroup reasons, ignore it here.
+		return nil
+	}
+	dest, err := securejoin.SecureJoin(rootfs, node.Path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	if bind {
+		return bindMountDeviceNode(dest, node)
+	}
+	if err := mknodDevice(dest, node); err != nil {
+		if os.IsExist(err) {
+			return nil
+		} else if os.IsPermission(err) {
+			return bindMountDeviceNode(dest, node)
+		}
+		return err
+	}
+	return nil
+}
+
+func bindMountDeviceNode(dest string, node *configs.Device) error {
+	f, err := os.Create(dest)
+	if err != nil && !os.IsExist(err) {
+		return err
+	}
+	if f != nil {
+		f.Close()
+	}
+	return unix.Mount(node.Path, dest, "bind", unix.MS_BIND, "")
+}
+
+func mknodDevice(dest string, node *configs.Device) error {
+	fileMode := node.FileMode
+	switch node.Type {
+	case configs.BlockDevice:
+		fileMode |= unix.S_IFBLK
+	case configs.CharDevice:
+		fileMode |= unix.S_IFCHR
+	case configs.FifoDevice:
+		fileMode |= unix.S_IFIFO
+	default:
+		return fmt.Errorf("%c is not a valid device type for device %s", node.Type, node.Path)
+	}
+	dev := unix.Mkdev(uint32(node.Major), uint32(node.Minor))
+	if err := unix.Mknod(dest, uint32(fileMode), int(dev)); err != nil {
+		return &os.PathError{Op: "mknod", Path: dest, Err: err}
+	}
+	return unix.Chown(dest, int(node.Uid), int(node.Gid))
+}
+
+func setupPtmx(config *configs.Config) error {
+	ptmx := filepath.Join(config.Rootfs, "dev/ptmx")
+	if err := os.Remove(ptmx); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Symlink("pts/ptmx", ptmx)
+}
+
+func setupDevSymlinks(rootfs string) error {
+	var links = [][2]string{
+		{"/proc/self/fd", "/dev/fd"},
+		{"/proc/self/fd/0", "/dev/stdin"},
+		{"/proc/self/fd/1", "/dev/stdout"},
+		{"/proc/self/fd/2", "/dev/stderr"},
+	}
+	// kcore support can be toggled with CONFIG_PROC_KCORE; only create a symlink
+	// in /dev if it exists in /proc.
+	if _, err := os.Stat("/proc/kcore"); err == nil {
+		links = append(links, [2]string{"/proc/kcore", "/dev/core"})
+	}
+	for _, link := range links {
+		var (
+			src = link[0]
+			dst = filepath.Join(rootfs, link[1])
+		)
+		if err := os.Symlink(src, dst); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("symlink %s %s %s", src, dst, err)
+		}
+	}
+	return nil
+}
+
+func msMoveRoot(rootfs string) error {
+	if err := unix.Mount(rootfs, "/", "", unix.MS_MOVE, ""); err != nil {
+		return err
+	}
+	return chroot()
+}
+
+// maskPath masks the top of the specified path inside a container to avoid
+// security issues from processes reading information from non-namespace aware
+// mounts ( proc/kcore ).
+// For files, maskPath bind mounts /dev/null over the top of the specified path.
+// For directories, maskPath mounts read-only tmpfs over the top of the specified path.
+func maskPath(path string) error {
+	if err := unix.Mount("/dev/null", path, "", unix.MS_BIND, ""); err != nil && !os.IsNotExist(err) {
+		if err == unix.ENOTDIR {
+			return unix.Mount("tmpfs", path, "tmpfs", unix.MS_RDONLY, "")
+		}
+		return err
+	}
+	return nil
+}
+
+// unmountRootfs lazily unmounts whatever is still mounted below the rootfs in
+// our mount namespace. Mounts made by init only end up here when the rootfs
+// propagation is shared, the rootfs itself is left to whoever mounted it.
+func unmountRootfs(rootfs string) error {
+	mounts, err := mountPointsUnder(rootfs)
+	if err != nil {
+		return err
+	}
+	// unmount the deepest mounts first, they keep their parents busy.
+	sort.Slice(mounts, func(i, j int) bool {
+		return len(mounts[i]) > len(mounts[j])
+	})
+	for _, m := range mounts {
+		if err := unix.Unmount(m, unix.MNT_DETACH); err != nil && err != unix.EINVAL && err != unix.ENOENT {
+			return fmt.Errorf("unmounting %s: %v", m, err)
+		}
+	}
+	return nil
+}
+
+// mountPointsUnder returns the mount points in /proc/self/mountinfo that are
+// below dir.
+func mountPointsUnder(dir string) ([]string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dir = filepath.Clean(dir)
+	var mounts []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw
+		fields := strings.Fields(s.Text())
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("invalid mountinfo line %q", s.Text())
+		}
+		m := unescapeMountPath(fields[4])
+		if strings.HasPrefix(m, dir+"/") {
+			mounts = append(mounts, m)
+		}
+	}
+	return mounts, s.Err()
+}
+
+// unescapeMountPath decodes the octal escapes the kernel uses for spaces,
+// tabs, newlines and backslashes in mountinfo.
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+4 <= len(path) {
+			if v, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
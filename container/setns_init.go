@@ -5,13 +5,18 @@ package container
 import (
 	"fmt"
 	"os"
+	"os/exec"
 	"runtime"
+
+	"golang.org/x/sys/unix"
 )
 
 // linuxSetnsInit performs the container's initialization for running a new process
 // inside an existing container.
 type linuxSetnsInit struct {
 	pipe          *os.File
+	consoleSocket *os.File
+	config        *initConfig
 }
 
 func (l *linuxSetnsInit) getSessionRingName() string {
@@ -21,6 +26,41 @@ func (l *linuxSetnsInit) getSessionRingName() string {
 func (l *linuxSetnsInit) Init() error {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
+
+	// nsenter already joined the container's namespaces, everything below
+	// runs inside of them.
+	if l.config.CreateConsole {
+		if _, err := unix.Setsid(); err != nil {
+			return fmt.Errorf("setsid: %v", err)
+		}
+		if err := setupConsole(l.consoleSocket); err != nil {
+			return err
+		}
+		if err := setCtty(); err != nil {
+			return fmt.Errorf("setctty: %v", err)
+		}
+	}
+	if l.consoleSocket != nil {
+		l.consoleSocket.Close()
+	}
+	if l.config.NoNewPrivileges {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("set nonewprivileges: %v", err)
+		}
+	}
+	if err := finalizeNamespace(l.config); err != nil {
+		return err
+	}
+	name, err := exec.LookPath(l.config.Args[0])
+	if err != nil {
+		return err
+	}
+	if err := syncParentReady(l.pipe); err != nil {
+		return fmt.Errorf("sync ready: %v", err)
+	}
+	l.pipe.Close()
+	if err := unix.Exec(name, l.config.Args[0:], os.Environ()); err != nil {
+		return fmt.Errorf("exec user process: %v", err)
+	}
 	return nil
-	// return system.Execv(l.config.Args[0], l.config.Args[0:], os.Environ())
 }
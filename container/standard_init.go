@@ -5,7 +5,11 @@ package container
 import (
 	"fmt"
 	"os"
+	"os/exec"
 	"runtime"
+
+	"github.com/lipeining/godocker/configs"
+	"golang.org/x/sys/unix"
 )
 
 type linuxStandardInit struct {
@@ -13,6 +17,7 @@ type linuxStandardInit struct {
 	consoleSocket *os.File
 	parentPid     int
 	fifoFd        int
+	config        *initConfig
 }
 
 func (l *linuxStandardInit) getSessionRingParams() (string, uint32, uint32) {
@@ -32,120 +37,111 @@ func (l *linuxStandardInit) Init() error {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 
-	// if err := setupNetwork(l.config); err != nil {
-	// 	return err
-	// }
-	// if err := setupRoute(l.config.Config); err != nil {
-	// 	return err
-	// }
-
-	// initialises the labeling system
-	// if err := prepareRootfs(l.pipe, l.config); err != nil {
-	// 	return err
-	// }
-
+	// The parent placed us into our cgroups before handing over the
+	// config, unsharing now makes them the root of the cgroup namespace.
+	if l.config.Config.Namespaces.Contains(configs.NEWCGROUP) && l.config.Config.Namespaces.PathOf(configs.NEWCGROUP) == "" {
+		if err := unix.Unshare(unix.CLONE_NEWCGROUP); err != nil {
+			return fmt.Errorf("unshare cgroup namespace: %v", err)
+		}
+	}
+	if err := setupNetwork(l.config.Config); err != nil {
+		return err
+	}
+	if err := prepareRootfs(l.config.Config); err != nil {
+		return err
+	}
+	// Set up the console. This has to be done *before* we finalize the rootfs,
+	// but *after* we've given the user the chance to set up all of the mounts
+	// they wanted.
+	if l.config.CreateConsole {
+		if _, err := unix.Setsid(); err != nil {
+			return fmt.Errorf("setsid: %v", err)
+		}
+		if err := setupConsole(l.consoleSocket); err != nil {
+			return err
+		}
+		if err := setCtty(); err != nil {
+			return fmt.Errorf("setctty: %v", err)
+		}
+	}
+	if l.consoleSocket != nil {
+		l.consoleSocket.Close()
+	}
 	// Finish the rootfs setup.
-	// if l.config.Config.Namespaces.Contains(configs.NEWNS) {
-	// 	if err := finalizeRootfs(l.config.Config); err != nil {
-	// 		return err
-	// 	}
-	// }
-
-	// if hostname := l.config.Config.Hostname; hostname != "" {
-	// 	if err := unix.Sethostname([]byte(hostname)); err != nil {
-	// 		return errors.Wrap(err, "sethostname")
-	// 	}
-	// }
-	// if err := apparmor.ApplyProfile(l.config.AppArmorProfile); err != nil {
-	// 	return errors.Wrap(err, "apply apparmor profile")
-	// }
-
-	// for key, value := range l.config.Config.Sysctl {
-	// 	if err := writeSystemProperty(key, value); err != nil {
-	// 		return errors.Wrapf(err, "write sysctl key %s", key)
-	// 	}
-	// }
-	// for _, path := range l.config.Config.ReadonlyPaths {
-	// 	if err := readonlyPath(path); err != nil {
-	// 		return errors.Wrapf(err, "readonly path %s", path)
-	// 	}
-	// }
-	// for _, path := range l.config.Config.MaskPaths {
-	// 	if err := maskPath(path, l.config.Config.MountLabel); err != nil {
-	// 		return errors.Wrapf(err, "mask path %s", path)
-	// 	}
-	// }
-	// pdeath, err := system.GetParentDeathSignal()
-	// if err != nil {
-	// 	return errors.Wrap(err, "get pdeath signal")
-	// }
-	// if l.config.NoNewPrivileges {
-	// 	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
-	// 		return errors.Wrap(err, "set nonewprivileges")
-	// 	}
-	// }
-	// // Tell our parent that we're ready to Execv. This must be done before the
-	// // Seccomp rules have been applied, because we need to be able to read and
-	// // write to a socket.
-	// if err := syncParentReady(l.pipe); err != nil {
-	// 	return errors.Wrap(err, "sync ready")
-	// }
-
-	// if err := finalizeNamespace(l.config); err != nil {
-	// 	return err
-	// }
-	// // finalizeNamespace can change user/group which clears the parent death
-	// // signal, so we restore it here.
-	// if err := pdeath.Restore(); err != nil {
-	// 	return errors.Wrap(err, "restore pdeath signal")
-	// }
-	// // Compare the parent from the initial start of the init process and make
-	// // sure that it did not change.  if the parent changes that means it died
-	// // and we were reparented to something else so we should just kill ourself
-	// // and not cause problems for someone else.
-	// if unix.Getppid() != l.parentPid {
-	// 	return unix.Kill(unix.Getpid(), unix.SIGKILL)
-	// }
-	// // Check for the arg before waiting to make sure it exists and it is
-	// // returned as a create time error.
-	// name, err := exec.LookPath(l.config.Args[0])
-	// if err != nil {
-	// 	return err
-	// }
-	// // Close the pipe to signal that we have completed our init.
-	// l.pipe.Close()
-	// // Wait for the FIFO to be opened on the other side before exec-ing the
-	// // user process. We open it through /proc/self/fd/$fd, because the fd that
-	// // was given to us was an O_PATH fd to the fifo itself. Linux allows us to
-	// // re-open an O_PATH fd through /proc.
-	// fd, err := unix.Open(fmt.Sprintf("/proc/self/fd/%d", l.fifoFd), unix.O_WRONLY|unix.O_CLOEXEC, 0)
-	// if err != nil {
-	// 	return newSystemErrorWithCause(err, "open exec fifo")
-	// }
-	// if _, err := unix.Write(fd, []byte("0")); err != nil {
-	// 	return newSystemErrorWithCause(err, "write 0 exec fifo")
-	// }
-	// // Close the O_PATH fifofd fd before exec because the kernel resets
-	// // dumpable in the wrong order. This has been fixed in newer kernels, but
-	// // we keep this to ensure CVE-2016-9962 doesn't re-emerge on older kernels.
-	// // N.B. the core issue itself (passing dirfds to the host filesystem) has
-	// // since been resolved.
-	// // https://github.com/torvalds/linux/blob/v4.9/fs/exec.c#L1290-L1318
-	// unix.Close(l.fifoFd)
-	// // Set seccomp as close to execve as possible, so as few syscalls take
-	// // place afterward (reducing the amount of syscalls that users need to
-	// // enable in their seccomp profiles).
-	// if l.config.Config.Seccomp != nil && l.config.NoNewPrivileges {
-	// 	if err := seccomp.InitSeccomp(l.config.Config.Seccomp); err != nil {
-	// 		return newSystemErrorWithCause(err, "init seccomp")
-	// 	}
-	// }
+	if err := finalizeRootfs(l.config.Config); err != nil {
+		return err
+	}
 
-	// s := l.config.SpecState
-	// s.Pid = unix.Getpid()
-	// s.Status = configs.Created
-	// if err := unix.Exec(name, l.config.Args[0:], os.Environ()); err != nil {
-	// 	return newSystemErrorWithCause(err, "exec user process")
-	// }
+	if hostname := l.config.Config.Hostname; hostname != "" {
+		if err := unix.Sethostname([]byte(hostname)); err != nil {
+			return fmt.Errorf("sethostname: %v", err)
+		}
+	}
+	for key, value := range l.config.Config.Sysctl {
+		if err := writeSystemProperty(key, value); err != nil {
+			return fmt.Errorf("write sysctl key %s: %v", key, err)
+		}
+	}
+	for _, path := range l.config.Config.ReadonlyPaths {
+		if err := readonlyPath(path); err != nil {
+			return fmt.Errorf("readonly path %s: %v", path, err)
+		}
+	}
+	for _, path := range l.config.Config.MaskPaths {
+		if err := maskPath(path); err != nil {
+			return fmt.Errorf("mask path %s: %v", path, err)
+		}
+	}
+	if err := setupRlimits(l.config.Config.Rlimits); err != nil {
+		return err
+	}
+	if l.config.NoNewPrivileges {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("set nonewprivileges: %v", err)
+		}
+	}
+	if err := finalizeNamespace(l.config); err != nil {
+		return err
+	}
+	// Compare the parent from the initial start of the init process and make
+	// sure that it did not change.  if the parent changes that means it died
+	// and we were reparented to something else so we should just kill ourself
+	// and not cause problems for someone else.
+	if unix.Getppid() != l.parentPid {
+		return unix.Kill(unix.Getpid(), unix.SIGKILL)
+	}
+	// Check for the arg before waiting to make sure it exists and it is
+	// returned as a create time error.
+	name, err := exec.LookPath(l.config.Args[0])
+	if err != nil {
+		return err
+	}
+	// Tell our parent that we're ready to exec and wait for the go ahead.
+	if err := syncParentReady(l.pipe); err != nil {
+		return fmt.Errorf("sync ready: %v", err)
+	}
+	// Close the pipe to signal that we have completed our init.
+	l.pipe.Close()
+	// Wait for the FIFO to be opened on the other side before exec-ing the
+	// user process. We open it through /proc/self/fd/$fd, because the fd that
+	// was given to us was an O_PATH fd to the fifo itself. Linux allows us to
+	// re-open an O_PATH fd through /proc.
+	fd, err := unix.Open(fmt.Sprintf("/proc/self/fd/%d", l.fifoFd), unix.O_WRONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("open exec fifo: %v", err)
+	}
+	if _, err := unix.Write(fd, []byte("0")); err != nil {
+		return fmt.Errorf("write 0 exec fifo: %v", err)
+	}
+	// Close the O_PATH fifofd fd before exec because the kernel resets
+	// dumpable in the wrong order. This has been fixed in newer kernels, but
+	// we keep this to ensure CVE-2016-9962 doesn't re-emerge on older kernels.
+	// N.B. the core issue itself (passing dirfds to the host filesystem) has
+	// since been resolved.
+	// https://github.com/torvalds/linux/blob/v4.9/fs/exec.c#L1290-L1318
+	unix.Close(l.fifoFd)
+	if err := unix.Exec(name, l.config.Args[0:], os.Environ()); err != nil {
+		return fmt.Errorf("exec user process: %v", err)
+	}
 	return nil
 }
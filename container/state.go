@@ -0,0 +1,337 @@
+package container
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lipeining/godocker/configs"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// State represents a running container's state, it is persisted to
+// state.json in the container's directory so that a container can be
+// loaded again by a separate invocation of godocker.
+type State struct {
+	// ID is the container ID.
+	ID string `json:"id"`
+
+	// InitProcessPid is the init process id in the parent namespace.
+	InitProcessPid int `json:"init_process_pid"`
+
+	// InitProcessStartTime is the init process start time in clock cycles since boot time.
+	InitProcessStartTime uint64 `json:"init_process_start"`
+
+	// Created is the unix timestamp for the creation time of the container in UTC
+	Created time.Time `json:"created"`
+
+	// Config is the container's configuration.
+	Config configs.Config `json:"config"`
+
+	// Path to all the cgroups setup for a container. Key is cgroup subsystem name
+	// with the value as the path.
+	CgroupPaths map[string]string `json:"cgroup_paths"`
+
+	// NamespacePaths are filepaths to the container's namespaces. Key is the namespace type
+	// with the value as the path.
+	NamespacePaths map[configs.NamespaceType]string `json:"namespace_paths"`
+
+	// Bundle is the path on the filesystem to the bundle.
+	Bundle string `json:"bundle"`
+
+	// Annotations is the user defined annotations added to the config.
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// OOMKilled is set once the oom killer killed a process of the container
+	// while NotifyOOM was watching it, e.g. during "godocker events".
+	OOMKilled bool `json:"oom_killed,omitempty"`
+}
+
+func (l *linuxContainer) currentState() (*State, error) {
+	pid := -1
+	if l.initProcess != nil {
+		pid = l.initProcess.pid()
+	}
+	bundle, annotations := annotations(l.config.Labels)
+	state := &State{
+		ID:                   l.id,
+		InitProcessPid:       pid,
+		InitProcessStartTime: l.initProcessStartTime,
+		Created:              l.created,
+		Config:               *l.config,
+		CgroupPaths:          make(map[string]string),
+		NamespacePaths:       make(map[configs.NamespaceType]string),
+		Bundle:               bundle,
+		Annotations:          annotations,
+		OOMKilled:            l.oomKilled,
+	}
+	if l.cgroupManager != nil {
+		for name, path := range l.cgroupManager.Paths() {
+			state.CgroupPaths[string(name)] = path
+		}
+	}
+	if pid > 0 {
+		// Record every namespace of init, not only the configured ones, so
+		// that processes exec'd later end up in exactly the same place.
+		for _, nsType := range configs.NamespaceTypes() {
+			if !configs.IsNamespaceSupported(nsType) {
+				continue
+			}
+			ns := configs.Namespace{Type: nsType}
+			state.NamespacePaths[nsType] = ns.GetPath(pid)
+		}
+	}
+	return state, nil
+}
+
+// updateState records the current state of the container on disk.
+func (l *linuxContainer) updateState() (*State, error) {
+	state, err := l.currentState()
+	if err != nil {
+		return nil, err
+	}
+	if err := l.saveState(state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// saveState writes the state to a temporary file first and renames it over
+// state.json, so that readers never see a partially written state.
+func (l *linuxContainer) saveState(s *State) (err error) {
+	tmpFile, err := ioutil.TempFile(l.root, "state-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmpFile.Close()
+			os.Remove(tmpFile.Name())
+		}
+	}()
+	if err := json.NewEncoder(tmpFile).Encode(s); err != nil {
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	stateFilePath := filepath.Join(l.root, stateFilename)
+	return os.Rename(tmpFile.Name(), stateFilePath)
+}
+
+// setState moves the container to s and records it in state.json right away,
+// so that other invocations of godocker see the transition.
+func (l *linuxContainer) setState(s containerState) error {
+	l.state = s
+	if _, err := l.updateState(); err != nil && !os.IsNotExist(err) {
+		// the container may have been deleted by another process already.
+		return err
+	}
+	return nil
+}
+
+var (
+	ErrNotRunning = errors.New("container not running")
+	ErrNotPaused  = errors.New("container not paused")
+	ErrPaused     = errors.New("container paused")
+	ErrStopped    = errors.New("cannot start a container that has stopped")
+	ErrNotExist   = errors.New("container does not exist")
+)
+
+type stateTransitionError struct {
+	From string
+	To   string
+}
+
+func (s *stateTransitionError) Error() string {
+	return fmt.Sprintf("invalid state transition from %s to %s", s.From, s.To)
+}
+
+func newStateTransitionError(from, to containerState) error {
+	return &stateTransitionError{
+		From: from.status().String(),
+		To:   to.status().String(),
+	}
+}
+
+// containerState represents a container state and the transitions that are
+// valid from it.
+type containerState interface {
+	transition(containerState) error
+	destroy() error
+	status() Status
+}
+
+// destroy releases everything the container holds on the host. Without a
+// pid namespace processes may have outlived init, they are killed first so
+// that the cgroups can be removed.
+func destroy(c *linuxContainer) error {
+	var err error
+	if c.cgroupManager != nil {
+		if !c.config.Namespaces.Contains(configs.NEWPID) {
+			if err := signalAllProcesses(c.cgroupManager, unix.SIGKILL); err != nil {
+				logrus.Warn(err)
+			}
+		}
+		err = c.cgroupManager.Delete()
+	}
+	if uerr := unmountRootfs(c.config.Rootfs); err == nil {
+		err = uerr
+	}
+	if nerr := removeNetworks(c.config.Networks); err == nil {
+		err = nerr
+	}
+	if rerr := os.RemoveAll(c.root); err == nil {
+		err = rerr
+	}
+	c.initProcess = nil
+	if herr := runPoststopHooks(c); err == nil {
+		err = herr
+	}
+	c.state = &stoppedState{c: c}
+	return err
+}
+
+func runPoststopHooks(c *linuxContainer) error {
+	if c.config.Hooks == nil {
+		return nil
+	}
+	bundle, annotations := annotations(c.config.Labels)
+	s := &specs.State{
+		Version:     specs.Version,
+		ID:          c.id,
+		Status:      "stopped",
+		Bundle:      bundle,
+		Annotations: annotations,
+	}
+	for i, hook := range c.config.Hooks.Poststop {
+		if err := hook.Run(s); err != nil {
+			return fmt.Errorf("running poststop hook %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// stoppedState represents a container is a stopped/destroyed state.
+type stoppedState struct {
+	c *linuxContainer
+}
+
+func (b *stoppedState) status() Status {
+	return Stopped
+}
+
+func (b *stoppedState) transition(s containerState) error {
+	switch s.(type) {
+	// a container loaded from disk starts out stopped until refreshState
+	// finds it paused.
+	case *runningState, *createdState, *pausedState:
+		// nothing changed on disk, start records the created state itself.
+		b.c.state = s
+		return nil
+	case *stoppedState:
+		return nil
+	}
+	return newStateTransitionError(b, s)
+}
+
+func (b *stoppedState) destroy() error {
+	return destroy(b.c)
+}
+
+// runningState represents a container that is currently running.
+type runningState struct {
+	c *linuxContainer
+}
+
+func (r *runningState) status() Status {
+	return Running
+}
+
+func (r *runningState) transition(s containerState) error {
+	switch s.(type) {
+	case *stoppedState:
+		if r.c.runType() == Running {
+			return newStateTransitionError(r, s)
+		}
+		return r.c.setState(s)
+	case *pausedState:
+		return r.c.setState(s)
+	case *runningState:
+		return nil
+	}
+	return newStateTransitionError(r, s)
+}
+
+func (r *runningState) destroy() error {
+	if r.c.runType() == Running {
+		return errors.New("container is not destroyed")
+	}
+	return destroy(r.c)
+}
+
+// createdState represents a container whose init is waiting to exec the
+// user process.
+type createdState struct {
+	c *linuxContainer
+}
+
+func (i *createdState) status() Status {
+	return Created
+}
+
+func (i *createdState) transition(s containerState) error {
+	switch s.(type) {
+	case *runningState, *stoppedState:
+		return i.c.setState(s)
+	case *createdState:
+		return nil
+	}
+	return newStateTransitionError(i, s)
+}
+
+func (i *createdState) destroy() error {
+	if i.c.runType() != Stopped {
+		return errors.New("container is not destroyed")
+	}
+	return destroy(i.c)
+}
+
+// pausedState represents a container that is currently paused.  It cannot be destroyed in a
+// paused state and must transition back to running first.
+type pausedState struct {
+	c *linuxContainer
+}
+
+func (p *pausedState) status() Status {
+	return Paused
+}
+
+func (p *pausedState) transition(s containerState) error {
+	switch s.(type) {
+	case *runningState, *stoppedState:
+		return p.c.setState(s)
+	case *pausedState:
+		return nil
+	}
+	return newStateTransitionError(p, s)
+}
+
+func (p *pausedState) destroy() error {
+	if p.c.runType() != Stopped {
+		return ErrPaused
+	}
+	if err := p.c.cgroupManager.Thaw(); err != nil {
+		return err
+	}
+	return destroy(p.c)
+}
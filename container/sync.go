@@ -0,0 +1,136 @@
+package container
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// initSyncVersion is the version of the messages exchanged between the parent
+// and "godocker init" over the init pipe. It has to be bumped whenever the
+// format changes so that a stale binary fails loudly instead of hanging.
+const initSyncVersion = 1
+
+type syncType string
+
+// Constants that are used for synchronisation between the parent and child
+// during container setup. They come in pairs, except for procError which can
+// be sent by the child at any point and carries an *initError.
+//
+//	[  child  ] <-> [   parent   ]
+//
+//	                <-- [bootstrap data for nsenter]
+//	procPid     --> [join cgroups, send config]
+//	procReady   --> [run any parent-side setup]
+//	            <-- procRun
+//	[exec user process, the pipe is closed]
+//
+// procPid is written by nsenter, which is C, so the format of syncT must be
+// kept in sync with nsenter/nsenter.go.
+const (
+	procError syncType = "procError"
+	procPid   syncType = "procPid"
+	procReady syncType = "procReady"
+	procRun   syncType = "procRun"
+)
+
+type syncT struct {
+	Type    syncType   `json:"type"`
+	Version int        `json:"version"`
+	Pid     int        `json:"pid,omitempty"`
+	Error   *initError `json:"error,omitempty"`
+}
+
+// initError is the structured error that the init process sends back to its
+// parent when it fails to set up the container.
+type initError struct {
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (e *initError) Error() string {
+	return "container init failed: " + e.Message
+}
+
+var errInitExited = errors.New("container init exited before it was ready")
+
+// writeSync is used to write to a synchronisation pipe. An error is returned
+// if there was a problem writing the payload.
+func writeSync(pipe io.Writer, sync syncType) error {
+	return json.NewEncoder(pipe).Encode(syncT{Type: sync, Version: initSyncVersion})
+}
+
+// writeSyncError reports err to the other end of the pipe.
+func writeSyncError(pipe io.Writer, err error) error {
+	return json.NewEncoder(pipe).Encode(syncT{
+		Type:    procError,
+		Version: initSyncVersion,
+		Error: &initError{
+			Message:   err.Error(),
+			Timestamp: time.Now().UTC(),
+		},
+	})
+}
+
+// readSync is used to read from a synchronisation pipe. An error is returned
+// if we got an initError, the pipe was closed, or we got an unexpected flag.
+func readSync(pipe io.Reader, expected syncType) error {
+	_, err := readSyncT(pipe, expected)
+	return err
+}
+
+func readSyncT(pipe io.Reader, expected syncType) (*syncT, error) {
+	var procSync syncT
+	if err := json.NewDecoder(pipe).Decode(&procSync); err != nil {
+		if err == io.EOF {
+			return nil, errors.New("other end closed synchronisation channel")
+		}
+		return nil, err
+	}
+	if err := checkSync(&procSync); err != nil {
+		return nil, err
+	}
+	if procSync.Type != expected {
+		return nil, fmt.Errorf("invalid synchronisation flag: %q, expected %q", procSync.Type, expected)
+	}
+	return &procSync, nil
+}
+
+// parseSync runs the given callback function on each syncT received from the
+// child. It will return once io.EOF is returned from the given pipe.
+func parseSync(pipe io.Reader, fn func(*syncT) error) error {
+	dec := json.NewDecoder(pipe)
+	for {
+		var sync syncT
+		if err := dec.Decode(&sync); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if err := checkSync(&sync); err != nil {
+			return err
+		}
+		if err := fn(&sync); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSync validates the version of a received message and turns procError
+// into the error it carries.
+func checkSync(sync *syncT) error {
+	if sync.Version != initSyncVersion {
+		return fmt.Errorf("init sync version mismatch: got %d, want %d", sync.Version, initSyncVersion)
+	}
+	if sync.Type == procError {
+		if sync.Error == nil {
+			return errors.New("procError without an error")
+		}
+		return sync.Error
+	}
+	return nil
+}
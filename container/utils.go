@@ -0,0 +1,107 @@
+package container
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// annotations returns the bundle path and user defined annotations from the
+// config labels, the bundle is stored there by specconv as "bundle=<path>".
+func annotations(labels []string) (bundle string, userAnnotations map[string]string) {
+	userAnnotations = make(map[string]string)
+	for _, l := range labels {
+		parts := strings.SplitN(l, "=", 2)
+		if len(parts) < 2 {
+			continue
+		}
+		if parts[0] == "bundle" {
+			bundle = parts[1]
+		} else {
+			userAnnotations[parts[0]] = parts[1]
+		}
+	}
+	return
+}
+
+// ProcStat holds the fields of /proc/<pid>/stat that are needed to tell
+// whether a recorded process is still alive and to list the processes of a
+// container.
+type ProcStat struct {
+	// Name is the command name of the process, the comm field.
+	Name string
+	// State is the one character state of the process, e.g. 'R', 'S' or 'Z'.
+	State byte
+	// PPid is the pid of the parent process.
+	PPid int
+	// UTime and STime are the user and system time of the process in clock
+	// ticks.
+	UTime uint64
+	STime uint64
+	// StartTime is the time the process started after boot in clock ticks.
+	// Together with the pid it identifies a process even when pids are
+	// recycled.
+	StartTime uint64
+}
+
+// isDead reports whether the process has exited but may not have been reaped.
+func (s *ProcStat) isDead() bool {
+	return s.State == 'Z' || s.State == 'X'
+}
+
+// GetProcStat returns the parsed /proc/<pid>/stat of the process.
+func GetProcStat(pid int) (*ProcStat, error) {
+	data, err := ioutil.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return nil, err
+	}
+	return parseStat(string(data))
+}
+
+// getProcessStartTime returns the start time of the process in clock ticks
+// since boot as found in /proc/<pid>/stat.
+func getProcessStartTime(pid int) (uint64, error) {
+	stat, err := GetProcStat(pid)
+	if err != nil {
+		return 0, err
+	}
+	return stat.StartTime, nil
+}
+
+func parseStat(data string) (*ProcStat, error) {
+	// The comm field is in parentheses and may contain spaces and
+	// parentheses itself, so everything is parsed from the last ')'.
+	i := strings.LastIndex(data, ")")
+	j := strings.Index(data, "(")
+	if i < 0 || j < 0 || j > i {
+		return nil, fmt.Errorf("invalid stat data: %q", data)
+	}
+	// fields[0] is the state (field 3), starttime is field 22.
+	fields := strings.Fields(data[i+1:])
+	if len(fields) < 20 {
+		return nil, fmt.Errorf("invalid stat data: %q", data)
+	}
+	stat := &ProcStat{
+		Name:  data[j+1 : i],
+		State: fields[0][0],
+	}
+	var err error
+	if stat.PPid, err = strconv.Atoi(fields[1]); err != nil {
+		return nil, err
+	}
+	for _, f := range []struct {
+		index int
+		dest  *uint64
+	}{
+		{11, &stat.UTime},
+		{12, &stat.STime},
+		{19, &stat.StartTime},
+	} {
+		if *f.dest, err = strconv.ParseUint(fields[f.index], 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	return stat, nil
+}
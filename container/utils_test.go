@@ -0,0 +1,46 @@
+package container
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseStat(t *testing.T) {
+	data := "1234 (sh (x) y) Z 1 1234 1234 0 -1 4194560 105 0 0 0 0 0 0 0 20 0 1 0 98765 4444 100 18446744073709551615"
+	stat, err := parseStat(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Name != "sh (x) y" || stat.PPid != 1 {
+		t.Errorf("unexpected name %q or parent %d", stat.Name, stat.PPid)
+	}
+	if stat.StartTime != 98765 {
+		t.Errorf("expected start time 98765 but received %d", stat.StartTime)
+	}
+	if !stat.isDead() {
+		t.Errorf("expected process in state %q to be dead", stat.State)
+	}
+	if _, err := parseStat("1234 (sh) S 1"); err == nil {
+		t.Error("expected an error for truncated stat data")
+	}
+}
+
+func TestGetProcessStartTime(t *testing.T) {
+	start, err := getProcessStartTime(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if start == 0 {
+		t.Error("expected a non zero start time for the current process")
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	bundle, a := annotations([]string{"bundle=/tmp/b", "foo=bar", "invalid"})
+	if bundle != "/tmp/b" {
+		t.Errorf("expected bundle /tmp/b but received %q", bundle)
+	}
+	if len(a) != 1 || a["foo"] != "bar" {
+		t.Errorf("unexpected annotations %v", a)
+	}
+}
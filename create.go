@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+
 	"github.com/urfave/cli"
 )
 
@@ -50,23 +52,23 @@ command(s) that get executed on start, edit the args parameter of the spec. See
 		},
 	},
 	Action: func(context *cli.Context) error {
-		// if err := checkArgs(context, 1, exactArgs); err != nil {
-		// 	return err
-		// }
-		// if err := revisePidFile(context); err != nil {
-		// 	return err
-		// }
-		// spec, err := setupSpec(context)
-		// if err != nil {
-		// 	return err
-		// }
-		// status, err := startContainer(context, spec, CT_ACT_CREATE, nil)
-		// if err != nil {
-		// 	return err
-		// }
-		// // exit with the container's exit status so any external supervisor is
-		// // notified of the exit with the correct exit status.
-		// os.Exit(status)
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+		if err := revisePidFile(context); err != nil {
+			return err
+		}
+		spec, err := setupSpec(context)
+		if err != nil {
+			return err
+		}
+		status, err := startContainer(context, spec, CT_ACT_CREATE)
+		if err != nil {
+			return err
+		}
+		// exit with the container's exit status so any external supervisor is
+		// notified of the exit with the correct exit status.
+		os.Exit(status)
 		return nil
 	},
 }
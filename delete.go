@@ -3,20 +3,27 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lipeining/godocker/container"
 	"github.com/urfave/cli"
+	"golang.org/x/sys/unix"
 )
 
-// func killContainer(container libcontainer.Container) error {
-// 	_ = container.Signal(unix.SIGKILL, false)
-// 	for i := 0; i < 100; i++ {
-// 		time.Sleep(100 * time.Millisecond)
-// 		if err := container.Signal(unix.Signal(0), false); err != nil {
-// 			destroy(container)
-// 			return nil
-// 		}
-// 	}
-// 	return errors.New("container init still running")
-// }
+func killContainer(c container.Container) error {
+	_ = c.Signal(unix.SIGKILL, false)
+	for i := 0; i < 100; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := c.Signal(unix.Signal(0), false); err != nil {
+			return c.Destroy()
+		}
+	}
+	return errors.New("container init still running")
+}
 
 var deleteCommand = cli.Command{
 	Name:  "delete",
@@ -38,43 +45,45 @@ status of "ubuntu01" as "stopped" the following will delete resources held for
 		},
 	},
 	Action: func(context *cli.Context) error {
-		// if err := checkArgs(context, 1, exactArgs); err != nil {
-		// 	return err
-		// }
-
-		// id := context.Args().First()
-		// force := context.Bool("force")
-		// container, err := getContainer(context)
-		// if err != nil {
-		// 	if lerr, ok := err.(libcontainer.Error); ok && lerr.Code() == libcontainer.ContainerNotExists {
-		// 		// if there was an aborted start or something of the sort then the container's directory could exist but
-		// 		// libcontainer does not see it because the state.json file inside that directory was never created.
-		// 		path := filepath.Join(context.GlobalString("root"), id)
-		// 		if e := os.RemoveAll(path); e != nil {
-		// 			fmt.Fprintf(os.Stderr, "remove %s: %v\n", path, e)
-		// 		}
-		// 		if force {
-		// 			return nil
-		// 		}
-		// 	}
-		// 	return err
-		// }
-		// s, err := container.Status()
-		// if err != nil {
-		// 	return err
-		// }
-		// switch s {
-		// case libcontainer.Stopped:
-		// 	destroy(container)
-		// case libcontainer.Created:
-		// 	return killContainer(container)
-		// default:
-		// 	if force {
-		// 		return killContainer(container)
-		// 	}
-		// 	return fmt.Errorf("cannot delete container %s that is not stopped: %s\n", id, s)
-		// }
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
 
-		return nil
+		id := context.Args().First()
+		force := context.Bool("force")
+		c, err := getContainer(context)
+		if err != nil {
+			if errors.Is(err, container.ErrNotExist) {
+				// an aborted create leaves the directory behind without
+				// a state.json, there is nothing else left to clean up.
+				root, e := filepath.Abs(context.GlobalString("root"))
+				if e != nil {
+					return e
+				}
+				path := filepath.Join(root, id)
+				if e := os.RemoveAll(path); e != nil {
+					fmt.Fprintf(os.Stderr, "remove %s: %v\n", path, e)
+				}
+				if force {
+					return nil
+				}
+			}
+			return err
+		}
+		s, err := c.Status()
+		if err != nil {
+			return err
+		}
+		switch s {
+		case container.Stopped:
+			return c.Destroy()
+		case container.Created:
+			return killContainer(c)
+		default:
+			if force {
+				return killContainer(c)
+			}
+			return fmt.Errorf("cannot delete container %s that is not stopped: %s", id, s)
+		}
 	},
 }
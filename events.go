@@ -0,0 +1,140 @@
+// +build linux
+
+package main
+
+import (
+	gocontext "context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lipeining/godocker/container"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// statusInterval is how often the status of the container is checked for
+// pauses, resumes and the exit of its init process.
+const statusInterval = 500 * time.Millisecond
+
+// event is one line of the events stream.
+type event struct {
+	Type string      `json:"type"`
+	ID   string      `json:"id"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+var eventsCommand = cli.Command{
+	Name:  "events",
+	Usage: "display container events such as OOM notifications, cpu, memory, and IO usage statistics",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is the name for the instance of the container.`,
+	Description: `The events command displays a stream of JSON events of the container:
+"stats" snapshots every interval, "oom" when the oom killer killed one of
+its processes, "pause" and "resume", and "exit" once its init process is
+gone, which ends the stream.`,
+	Flags: []cli.Flag{
+		cli.DurationFlag{
+			Name:  "interval",
+			Value: 5 * time.Second,
+			Usage: "set the stats collection interval",
+		},
+		cli.BoolFlag{
+			Name:  "stats",
+			Usage: "display the container's stats then exit",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+		c, err := getContainer(context)
+		if err != nil {
+			return err
+		}
+		duration := context.Duration("interval")
+		if duration <= 0 {
+			return fmt.Errorf("duration interval must be greater than 0")
+		}
+		status, err := c.Status()
+		if err != nil {
+			return err
+		}
+		if status == container.Stopped {
+			return fmt.Errorf("container with id %s is not running", c.ID())
+		}
+		enc := json.NewEncoder(os.Stdout)
+		if context.Bool("stats") {
+			s, err := c.Stats()
+			if err != nil {
+				return err
+			}
+			return enc.Encode(event{Type: "stats", ID: c.ID(), Data: s})
+		}
+		ctx, cancel := gocontext.WithCancel(gocontext.Background())
+		defer cancel()
+		oom, err := c.NotifyOOM(ctx)
+		if err != nil {
+			logrus.Warnf("oom notifications are not available: %v", err)
+		}
+		var (
+			stats  = time.NewTicker(duration)
+			checks = time.NewTicker(statusInterval)
+		)
+		defer stats.Stop()
+		defer checks.Stop()
+		for {
+			var e *event
+			select {
+			case _, ok := <-oom:
+				if !ok {
+					// the cgroup is gone, the next check reports the exit.
+					oom = nil
+					continue
+				}
+				e = &event{Type: "oom", ID: c.ID()}
+			case <-stats.C:
+				s, err := c.Stats()
+				if err != nil {
+					logrus.Error(err)
+					continue
+				}
+				e = &event{Type: "stats", ID: c.ID(), Data: s}
+			case <-checks.C:
+				current, err := c.Status()
+				if err != nil {
+					return err
+				}
+				e = statusEvent(c.ID(), status, current)
+				status = current
+			}
+			if e == nil {
+				continue
+			}
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+			if e.Type == "exit" {
+				return nil
+			}
+		}
+	},
+}
+
+// statusEvent returns the event for a change of the container's status, nil
+// when nothing changed that is worth reporting.
+func statusEvent(id string, from, to container.Status) *event {
+	switch {
+	case from == to:
+		return nil
+	case to == container.Stopped:
+		return &event{Type: "exit", ID: id}
+	case to == container.Paused:
+		return &event{Type: "pause", ID: id}
+	case from == container.Paused:
+		return &event{Type: "resume", ID: id}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/lipeining/godocker/container"
+)
+
+func TestStatusEvent(t *testing.T) {
+	for _, tc := range []struct {
+		from, to container.Status
+		expected string
+	}{
+		{container.Created, container.Created, ""},
+		{container.Created, container.Running, ""},
+		{container.Running, container.Paused, "pause"},
+		{container.Paused, container.Running, "resume"},
+		{container.Created, container.Stopped, "exit"},
+		{container.Running, container.Stopped, "exit"},
+		{container.Paused, container.Stopped, "exit"},
+	} {
+		e := statusEvent("test", tc.from, tc.to)
+		var typ string
+		if e != nil {
+			typ = e.Type
+			if e.ID != "test" {
+				t.Errorf("expected the event of %s to %s to be for test but received %q", tc.from, tc.to, e.ID)
+			}
+		}
+		if typ != tc.expected {
+			t.Errorf("expected %q from %s to %s but received %q", tc.expected, tc.from, tc.to, typ)
+		}
+	}
+}
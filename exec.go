@@ -3,6 +3,14 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/lipeining/godocker/container"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/urfave/cli"
 )
 
@@ -86,66 +94,139 @@ following will output a list of processes running in the container:
 		},
 	},
 	Action: func(context *cli.Context) error {
-		// if err := checkArgs(context, 1, minArgs); err != nil {
-		// 	return err
-		// }
-		// if err := revisePidFile(context); err != nil {
-		// 	return err
-		// }
-		// status, err := execProcess(context)
-		// if err == nil {
-		// 	os.Exit(status)
-		// }
-		// return fmt.Errorf("exec failed: %v", err)
-		return nil
+		if err := checkArgs(context, 1, minArgs); err != nil {
+			return err
+		}
+		if err := revisePidFile(context); err != nil {
+			return err
+		}
+		status, err := execProcess(context)
+		if err == nil {
+			os.Exit(status)
+		}
+		return fmt.Errorf("exec failed: %v", err)
 	},
 	SkipArgReorder: true,
 }
 
 func execProcess(context *cli.Context) (int, error) {
-	return 0, nil
-	// container, err := getContainer(context)
-	// if err != nil {
-	// 	return -1, err
-	// }
-	// status, err := container.Status()
-	// if err != nil {
-	// 	return -1, err
-	// }
-	// if status == libcontainer.Stopped {
-	// 	return -1, fmt.Errorf("cannot exec a container that has stopped")
-	// }
-	// path := context.String("process")
-	// if path == "" && len(context.Args()) == 1 {
-	// 	return -1, fmt.Errorf("process args cannot be empty")
-	// }
-	// detach := context.Bool("detach")
-	// state, err := container.State()
-	// if err != nil {
-	// 	return -1, err
-	// }
-	// bundle := utils.SearchLabels(state.Config.Labels, "bundle")
-	// p, err := getProcess(context, bundle)
-	// if err != nil {
-	// 	return -1, err
-	// }
+	c, err := getContainer(context)
+	if err != nil {
+		return -1, err
+	}
+	status, err := c.Status()
+	if err != nil {
+		return -1, err
+	}
+	if status == container.Stopped {
+		return -1, fmt.Errorf("cannot exec a container that has stopped")
+	}
+	path := context.String("process")
+	if path == "" && len(context.Args()) == 1 {
+		return -1, fmt.Errorf("process args cannot be empty")
+	}
+	detach := context.Bool("detach")
+	state, err := c.State()
+	if err != nil {
+		return -1, err
+	}
+	p, err := getProcess(context, state.Bundle)
+	if err != nil {
+		return -1, err
+	}
+
+	r := &runner{
+		enableSubreaper: !context.Bool("no-subreaper"),
+		shouldDestroy:   false,
+		container:       c,
+		consoleSocket:   context.String("console-socket"),
+		detach:          detach,
+		pidFile:         context.String("pid-file"),
+		action:          CT_ACT_RUN,
+		init:            false,
+		preserveFDs:     context.Int("preserve-fds"),
+	}
+	return r.run(p)
+}
 
-	// logLevel := "info"
-	// if context.GlobalBool("debug") {
-	// 	logLevel = "debug"
-	// }
+func getProcess(context *cli.Context, bundle string) (*specs.Process, error) {
+	// there is no selinux or apparmor support to apply them with.
+	for _, name := range []string{"process-label", "apparmor"} {
+		if context.String(name) != "" {
+			return nil, fmt.Errorf("--%s is not supported", name)
+		}
+	}
+	if path := context.String("process"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		var p specs.Process
+		if err := json.NewDecoder(f).Decode(&p); err != nil {
+			return nil, err
+		}
+		return &p, validateProcessSpec(&p)
+	}
+	// process via cli flags
+	if err := os.Chdir(bundle); err != nil {
+		return nil, err
+	}
+	spec, err := loadSpec(specConfig)
+	if err != nil {
+		return nil, err
+	}
+	p := spec.Process
+	p.Args = context.Args()[1:]
+	// override the cwd, if passed
+	if context.String("cwd") != "" {
+		p.Cwd = context.String("cwd")
+	}
+	// append the passed env variables
+	p.Env = append(p.Env, context.StringSlice("env")...)
 
-	// r := &runner{
-	// 	enableSubreaper: false,
-	// 	shouldDestroy:   false,
-	// 	container:       container,
-	// 	consoleSocket:   context.String("console-socket"),
-	// 	detach:          detach,
-	// 	pidFile:         context.String("pid-file"),
-	// 	action:          CT_ACT_RUN,
-	// 	init:            false,
-	// 	preserveFDs:     context.Int("preserve-fds"),
-	// 	logLevel:        logLevel,
-	// }
-	// return r.run(p)
+	// set the tty
+	if context.IsSet("tty") {
+		p.Terminal = context.Bool("tty")
+	}
+	if context.IsSet("no-new-privs") {
+		p.NoNewPrivileges = context.Bool("no-new-privs")
+	}
+	// add the capabilities, the process gets them in every set
+	caps := context.StringSlice("cap")
+	if len(caps) > 0 {
+		if p.Capabilities == nil {
+			p.Capabilities = &specs.LinuxCapabilities{}
+		}
+		for _, c := range caps {
+			p.Capabilities.Bounding = append(p.Capabilities.Bounding, c)
+			p.Capabilities.Inheritable = append(p.Capabilities.Inheritable, c)
+			p.Capabilities.Effective = append(p.Capabilities.Effective, c)
+			p.Capabilities.Permitted = append(p.Capabilities.Permitted, c)
+			p.Capabilities.Ambient = append(p.Capabilities.Ambient, c)
+		}
+	}
+	// override the user, if passed
+	if context.String("user") != "" {
+		u := strings.SplitN(context.String("user"), ":", 2)
+		if len(u) > 1 {
+			gid, err := strconv.Atoi(u[1])
+			if err != nil {
+				return nil, fmt.Errorf("parsing %s as int for gid failed: %v", u[1], err)
+			}
+			p.User.GID = uint32(gid)
+		}
+		uid, err := strconv.Atoi(u[0])
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s as int for uid failed: %v", u[0], err)
+		}
+		p.User.UID = uint32(uid)
+	}
+	for _, gid := range context.Int64Slice("additional-gids") {
+		if gid < 0 {
+			return nil, fmt.Errorf("additional-gids must be a positive number %d", gid)
+		}
+		p.User.AdditionalGids = append(p.User.AdditionalGids, uint32(gid))
+	}
+	return p, validateProcessSpec(p)
 }
@@ -3,7 +3,10 @@ module github.com/lipeining/godocker
 go 1.13
 
 require (
+	github.com/coreos/go-systemd/v22 v22.1.0
 	github.com/cyphar/filepath-securejoin v0.2.2
+	github.com/godbus/dbus/v5 v5.0.3
+	github.com/opencontainers/runtime-spec v1.0.2
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/sirupsen/logrus v1.6.0
 	github.com/urfave/cli v1.22.4
@@ -4,6 +4,8 @@ import (
 	"os"
 	"runtime"
 
+	"github.com/lipeining/godocker/container"
+	_ "github.com/lipeining/godocker/nsenter"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 )
@@ -20,10 +22,12 @@ var initCommand = cli.Command{
 	Name:  "init",
 	Usage: `initialize the namespaces and launch the process (do not call it outside of runc)`,
 	Action: func(context *cli.Context) error {
-		// parent process call /proc/self/exe init
-		// we should use env to pass parent child pipe
-		// or just the pipe3 to pass config from parent to child
-		// now just start the user cmd
-		return nil
+		factory, _ := container.New("")
+		if err := factory.StartInitialization(); err != nil {
+			// as the error is sent back to the parent there is no need to log
+			// or write it to stderr because the parent process will handle this
+			os.Exit(1)
+		}
+		panic("godocker init failed to init")
 	},
 }
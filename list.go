@@ -3,8 +3,19 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
+	"github.com/lipeining/godocker/container"
 	"github.com/urfave/cli"
 )
 
@@ -60,48 +71,116 @@ To list containers created using a non-default value for "--root":
 		},
 	},
 	Action: func(context *cli.Context) error {
-		// if err := checkArgs(context, 0, exactArgs); err != nil {
-		// 	return err
-		// }
-		// s, err := getContainers(context)
-		// if err != nil {
-		// 	return err
-		// }
+		if err := checkArgs(context, 0, exactArgs); err != nil {
+			return err
+		}
+		s, err := getContainers(context)
+		if err != nil {
+			return err
+		}
 
-		// if context.Bool("quiet") {
-		// 	for _, item := range s {
-		// 		fmt.Println(item.ID)
-		// 	}
-		// 	return nil
-		// }
+		if context.Bool("quiet") {
+			for _, item := range s {
+				fmt.Println(item.ID)
+			}
+			return nil
+		}
 
-		// switch context.String("format") {
-		// case "table":
-		// 	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
-		// 	fmt.Fprint(w, "ID\tPID\tSTATUS\tBUNDLE\tCREATED\tOWNER\n")
-		// 	for _, item := range s {
-		// 		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n",
-		// 			item.ID,
-		// 			item.InitProcessPid,
-		// 			item.Status,
-		// 			item.Bundle,
-		// 			item.Created.Format(time.RFC3339Nano),
-		// 			item.Owner)
-		// 	}
-		// 	if err := w.Flush(); err != nil {
-		// 		return err
-		// 	}
-		// case "json":
-		// 	if err := json.NewEncoder(os.Stdout).Encode(s); err != nil {
-		// 		return err
-		// 	}
-		// default:
-		// 	return errors.New("invalid format option")
-		// }
+		switch context.String("format") {
+		case "table":
+			w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+			fmt.Fprint(w, "ID\tPID\tSTATUS\tBUNDLE\tCREATED\tOWNER\n")
+			for _, item := range s {
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n",
+					item.ID,
+					item.InitProcessPid,
+					item.Status,
+					item.Bundle,
+					item.Created.Format(time.RFC3339Nano),
+					item.Owner)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		case "json":
+			if err := json.NewEncoder(os.Stdout).Encode(s); err != nil {
+				return err
+			}
+		default:
+			return errors.New("invalid format option")
+		}
 		return nil
 	},
 }
 
+// getContainers loads every container in the root directory, containers
+// that fail to load are reported and skipped.
 func getContainers(context *cli.Context) ([]containerState, error) {
-	return nil, nil
+	factory, err := loadFactory(context)
+	if err != nil {
+		return nil, err
+	}
+	root, err := filepath.Abs(context.GlobalString("root"))
+	if err != nil {
+		return nil, err
+	}
+	list, err := ioutil.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var s []containerState
+	for _, item := range list {
+		if !item.IsDir() {
+			continue
+		}
+		c, err := factory.Load(item.Name())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "load container %s: %v\n", item.Name(), err)
+			continue
+		}
+		// This cast is safe on Linux.
+		stat := item.Sys().(*syscall.Stat_t)
+		cs, err := newContainerState(c, stat.Uid)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "state of container %s: %v\n", item.Name(), err)
+			continue
+		}
+		s = append(s, *cs)
+	}
+	return s, nil
+}
+
+// newContainerState builds the listing of the container, the pid is left out
+// once init is gone.
+func newContainerState(c container.Container, uid uint32) (*containerState, error) {
+	status, err := c.Status()
+	if err != nil {
+		return nil, err
+	}
+	state, err := c.State()
+	if err != nil {
+		return nil, err
+	}
+	pid := state.InitProcessPid
+	if status == container.Stopped {
+		pid = 0
+	}
+	owner := fmt.Sprintf("#%d", uid)
+	if u, err := user.LookupId(strconv.Itoa(int(uid))); err == nil {
+		owner = u.Username
+	}
+	return &containerState{
+		Version:        state.Config.Version,
+		ID:             state.ID,
+		InitProcessPid: pid,
+		Status:         status.String(),
+		Bundle:         state.Bundle,
+		Rootfs:         state.Config.Rootfs,
+		Created:        state.Created,
+		Annotations:    state.Annotations,
+		Owner:          owner,
+	}, nil
 }
@@ -89,26 +89,27 @@ func main() {
 	}
 	app.Commands = []cli.Command{
 		// checkpointCommand,
-		// createCommand,
-		// deleteCommand,
-		// eventsCommand,
-		// execCommand,
+		createCommand,
+		deleteCommand,
+		eventsCommand,
+		execCommand,
 		initCommand,
-		// killCommand,
-		// listCommand,
-		// pauseCommand,
-		// psCommand,
+		killCommand,
+		listCommand,
+		pauseCommand,
+		psCommand,
 		// restoreCommand,
-		// resumeCommand,
-		// runCommand,
+		resumeCommand,
+		runCommand,
 		// specCommand,
-		// startCommand,
-		// stateCommand,
-		// updateCommand,
+		startCommand,
+		stateCommand,
+		updateCommand,
 	}
 	app.Before = func(context *cli.Context) error {
 		logrus.SetFormatter(&logrus.JSONFormatter{})
-		logrus.SetOutput(os.Stdout)
+		// stdout carries the output of the commands, like the events stream.
+		logrus.SetOutput(os.Stderr)
 		if context.GlobalBool("debug") {
 			logrus.SetLevel(logrus.DebugLevel)
 		}
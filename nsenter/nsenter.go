@@ -4,47 +4,355 @@ package nsenter
 #define _GNU_SOURCE
 #include <unistd.h>
 #include <errno.h>
+#include <fcntl.h>
+#include <limits.h>
 #include <sched.h>
+#include <signal.h>
+#include <stdarg.h>
+#include <stdint.h>
 #include <stdio.h>
 #include <stdlib.h>
 #include <string.h>
-#include <fcntl.h>
+#include <sys/socket.h>
+#include <sys/syscall.h>
+#include <sys/types.h>
+#include <linux/netlink.h>
+
+// Has to match initSyncVersion and syncT in container/sync.go.
+#define SYNC_VERSION 1
+
+// Have to match the types in container/message_linux.go.
+#define INIT_MSG           62000
+#define CLONE_FLAGS_ATTR   27281
+#define NS_PATHS_ATTR      27282
+#define UIDMAP_ATTR        27283
+#define GIDMAP_ATTR        27284
+#define OOM_SCORE_ADJ_ATTR 27286
+
+#define MAX_NAMESPACES 16
+
+// Sent between stage0 and stage1 over their socket pair while the new user
+// namespace is mapped.
+enum sync_t {
+	SYNC_USERMAP_PLS = 0x40,
+	SYNC_USERMAP_ACK = 0x41,
+};
+
+struct nlconfig_t {
+	char *data;
+	uint32_t cloneflags;
+	char *namespaces;
+	char *uidmap;
+	size_t uidmap_len;
+	char *gidmap;
+	size_t gidmap_len;
+	char *oom_score_adj;
+	size_t oom_score_adj_len;
+};
+
+static int initpipe = -1;
+
+// bail sends the error to the parent as a procError and exits. The message
+// ends up in paths and strerror(3) output, so it is escaped for json. Before
+// the init pipe is known the error goes to stderr.
+static void bail(const char *fmt, ...)
+{
+	char msg[1024], buf[4096];
+	size_t n = 0;
+	va_list ap;
+	char *p;
+
+	va_start(ap, fmt);
+	vsnprintf(msg, sizeof(msg), fmt, ap);
+	va_end(ap);
+
+	if (initpipe < 0) {
+		fprintf(stderr, "nsenter: %s\n", msg);
+		exit(1);
+	}
+	n += snprintf(buf, sizeof(buf), "{\"type\":\"procError\",\"version\":%d,\"error\":{\"message\":\"nsenter: ", SYNC_VERSION);
+	for (p = msg; *p && n < sizeof(buf) - 16; p++) {
+		unsigned char c = *p;
+
+		if (c == '"' || c == '\\')
+			n += snprintf(buf + n, sizeof(buf) - n, "\\%c", c);
+		else if (c < 0x20)
+			n += snprintf(buf + n, sizeof(buf) - n, "\\u%04x", c);
+		else
+			buf[n++] = c;
+	}
+	n += snprintf(buf + n, sizeof(buf) - n, "\"}}\n");
+	if (write(initpipe, buf, n) != (ssize_t)n)
+		fprintf(stderr, "nsenter: %s\n", msg);
+	exit(1);
+}
+
+static int nsflag(const char *name)
+{
+	if (!strcmp(name, "user"))
+		return CLONE_NEWUSER;
+	if (!strcmp(name, "ipc"))
+		return CLONE_NEWIPC;
+	if (!strcmp(name, "uts"))
+		return CLONE_NEWUTS;
+	if (!strcmp(name, "net"))
+		return CLONE_NEWNET;
+	if (!strcmp(name, "pid"))
+		return CLONE_NEWPID;
+	if (!strcmp(name, "mnt"))
+		return CLONE_NEWNS;
+	if (!strcmp(name, "cgroup"))
+		return CLONE_NEWCGROUP;
+	return -1;
+}
+
+static void readfull(int fd, void *buf, size_t len)
+{
+	ssize_t n;
+
+	while (len > 0) {
+		n = read(fd, buf, len);
+		if (n < 0 && errno == EINTR)
+			continue;
+		if (n < 0)
+			bail("failed to read bootstrap data: %m");
+		if (n == 0)
+			bail("failed to read bootstrap data: unexpected EOF");
+		buf = (char *)buf + n;
+		len -= n;
+	}
+}
+
+// nl_parse reads the bootstrap message that the parent sends over the init
+// pipe, a struct nlmsghdr followed by netlink attributes.
+static void nl_parse(int fd, struct nlconfig_t *config)
+{
+	struct nlmsghdr hdr;
+	size_t len, off = 0;
+
+	readfull(fd, &hdr, NLMSG_HDRLEN);
+	if (hdr.nlmsg_type != INIT_MSG)
+		bail("unexpected bootstrap message type %d", hdr.nlmsg_type);
+	if (hdr.nlmsg_len < NLMSG_HDRLEN)
+		bail("invalid bootstrap message length %u", hdr.nlmsg_len);
+	len = hdr.nlmsg_len - NLMSG_HDRLEN;
+	config->data = malloc(len);
+	if (!config->data)
+		bail("failed to allocate bootstrap data: %m");
+	readfull(fd, config->data, len);
+
+	while (off + NLA_HDRLEN <= len) {
+		struct nlattr *nla = (struct nlattr *)(config->data + off);
+		char *payload = config->data + off + NLA_HDRLEN;
+		size_t payload_len;
+
+		if (nla->nla_len < NLA_HDRLEN || off + nla->nla_len > len)
+			bail("invalid bootstrap attribute length %d", nla->nla_len);
+		payload_len = nla->nla_len - NLA_HDRLEN;
+		switch (nla->nla_type) {
+		case CLONE_FLAGS_ATTR:
+			config->cloneflags = *(uint32_t *)payload;
+			break;
+		case NS_PATHS_ATTR:
+			config->namespaces = payload;
+			break;
+		case UIDMAP_ATTR:
+			config->uidmap = payload;
+			config->uidmap_len = payload_len;
+			break;
+		case GIDMAP_ATTR:
+			config->gidmap = payload;
+			config->gidmap_len = payload_len;
+			break;
+		case OOM_SCORE_ADJ_ATTR:
+			config->oom_score_adj = payload;
+			config->oom_score_adj_len = payload_len;
+			break;
+		default:
+			bail("unknown bootstrap attribute %d", nla->nla_type);
+		}
+		off += NLA_ALIGN(nla->nla_len);
+	}
+}
+
+static void write_file(const char *data, size_t len, const char *fmt, ...)
+{
+	char path[PATH_MAX];
+	va_list ap;
+	int fd;
+
+	va_start(ap, fmt);
+	vsnprintf(path, sizeof(path), fmt, ap);
+	va_end(ap);
+
+	// the attributes are null-terminated, which the kernel does not want.
+	if (len > 0 && data[len - 1] == '\0')
+		len--;
+	fd = open(path, O_WRONLY | O_CLOEXEC);
+	if (fd < 0)
+		bail("failed to open %s: %m", path);
+	if (write(fd, data, len) != (ssize_t)len)
+		bail("failed to write %s: %m", path);
+	close(fd);
+}
+
+// join_namespaces joins the namespaces listed as "type:path,type:path". Every
+// namespace is opened before any of them is joined, the paths are resolved
+// through our /proc which is gone once we joined the mount namespace.
+static void join_namespaces(char *nslist)
+{
+	char *entry, *saveptr = NULL;
+	int fds[MAX_NAMESPACES], flags[MAX_NAMESPACES];
+	char *names[MAX_NAMESPACES];
+	int i, n = 0;
+
+	for (entry = strtok_r(nslist, ",", &saveptr); entry; entry = strtok_r(NULL, ",", &saveptr)) {
+		char *path = strchr(entry, ':');
+
+		if (!path)
+			bail("invalid namespace path %s", entry);
+		*path++ = '\0';
+		if (n == MAX_NAMESPACES)
+			bail("too many namespaces");
+		names[n] = entry;
+		flags[n] = nsflag(entry);
+		if (flags[n] < 0)
+			bail("unknown namespace %s", entry);
+		fds[n] = open(path, O_RDONLY | O_CLOEXEC);
+		if (fds[n] < 0)
+			bail("failed to open %s namespace %s: %m", entry, path);
+		n++;
+	}
+	for (i = 0; i < n; i++) {
+		if (setns(fds[i], flags[i]) < 0)
+			bail("failed to setns to %s namespace: %m", names[i]);
+		close(fds[i]);
+	}
+}
+
+static void sync_send(int fd, enum sync_t s)
+{
+	if (write(fd, &s, sizeof(s)) != sizeof(s))
+		bail("failed to sync with stage: %m");
+}
+
+static void sync_expect(int fd, enum sync_t want)
+{
+	enum sync_t s;
+
+	if (read(fd, &s, sizeof(s)) != sizeof(s))
+		bail("failed to sync with stage: %m");
+	if (s != want)
+		bail("unexpected sync %#x, expected %#x", s, want);
+}
+
+// clone_parent is fork(2) with CLONE_PARENT, the new process is a sibling of
+// the caller. Both stages are cloned like this, so that the process that
+// carries on into the container is a child of the runtime that started us and
+// it can wait for it without being a subreaper.
+static pid_t clone_parent(void)
+{
+	return syscall(SYS_clone, CLONE_PARENT | SIGCHLD, 0, 0, 0, 0);
+}
+
+// stage1 joins and creates the namespaces. setns(2) and unshare(2) of the pid
+// namespace only apply to children, so it clones the process that carries on
+// into the go runtime and reports its pid to the parent. stage1 itself stays
+// in the pid namespace of the parent, so the pid is the one the parent sees.
+static void stage1(struct nlconfig_t *config, int syncfd)
+{
+	char line[64];
+	pid_t pid;
+	int n;
+
+	if (config->namespaces)
+		join_namespaces(config->namespaces);
+
+	if (config->cloneflags & CLONE_NEWUSER) {
+		if (unshare(CLONE_NEWUSER) < 0)
+			bail("failed to unshare user namespace: %m");
+		// Only a process outside of the namespace may write its mappings.
+		sync_send(syncfd, SYNC_USERMAP_PLS);
+		sync_expect(syncfd, SYNC_USERMAP_ACK);
+		if (setresgid(0, 0, 0) < 0)
+			bail("failed to become root in user namespace: %m");
+		if (setresuid(0, 0, 0) < 0)
+			bail("failed to become root in user namespace: %m");
+	}
+	close(syncfd);
+
+	if (unshare(config->cloneflags & ~CLONE_NEWUSER) < 0)
+		bail("failed to unshare namespaces: %m");
+
+	pid = clone_parent();
+	if (pid < 0)
+		bail("failed to clone stage2: %m");
+	if (pid == 0)
+		return;
+
+	n = snprintf(line, sizeof(line), "{\"type\":\"procPid\",\"version\":%d,\"pid\":%d}\n", SYNC_VERSION, pid);
+	if (write(initpipe, line, n) != n)
+		bail("failed to send pid of stage2: %m");
+	exit(0);
+}
 
 // 一旦这个包被引用，则这个函数就会被自动执行
-__attribute__((constructor)) void enter_namespace(void) {
-	char *docker_pid;
-	docker_pid = getenv("docker_pid");
-	if (docker_pid) {
-		//fprintf(stdout, "got docker_pid=%s\n", docker_pid);
-	} else {
-		//fprintf(stdout, "missing docker_pid env skip nsenter");
+// nsexec runs before the go runtime starts whenever we are re-executed as a
+// container process, setns(2) refuses to change the user and mount namespace
+// of a multithreaded process. It reads the bootstrap message from the init
+// pipe and goes through three stages:
+//
+//   stage0 writes oom_score_adj, clones stage1 and writes the uid and gid
+//          mappings of the new user namespace on its behalf.
+//   stage1 joins and creates the namespaces and clones stage2.
+//   stage2 returns into the go runtime inside of the container's namespaces.
+//
+// Errors are sent to the parent over the init pipe as a procError.
+__attribute__((constructor)) void nsexec(void)
+{
+	struct nlconfig_t config = { 0 };
+	char *env;
+	int sync[2];
+	pid_t pid;
+
+	env = getenv("_LIBCONTAINER_INITPIPE");
+	if (!env)
 		return;
-	}
-	char *docker_cmd;
-	docker_cmd = getenv("docker_cmd");
-	if (docker_cmd) {
-		//fprintf(stdout, "got docker_cmd=%s\n", docker_cmd);
-	} else {
-		//fprintf(stdout, "missing docker_cmd env skip nsenter");
+	initpipe = atoi(env);
+
+	nl_parse(initpipe, &config);
+
+	if (config.oom_score_adj)
+		write_file(config.oom_score_adj, config.oom_score_adj_len, "/proc/self/oom_score_adj");
+
+	if (socketpair(AF_LOCAL, SOCK_STREAM | SOCK_CLOEXEC, 0, sync) < 0)
+		bail("failed to create sync socket pair: %m");
+
+	pid = clone_parent();
+	if (pid < 0)
+		bail("failed to clone stage1: %m");
+	if (pid == 0) {
+		close(sync[0]);
+		stage1(&config, sync[1]);
+		// stage2
+		free(config.data);
 		return;
 	}
-	int i;
-	char nspath[1024];
-	char *namespaces[] = { "ipc", "uts", "net", "pid", "mnt" };
-	for (i=0; i<5; i++) {
-		sprintf(nspath, "/proc/%s/ns/%s", docker_pid, namespaces[i]);
-		int fd = open(nspath, O_RDONLY);
-		// 调用setns系统调用，进入对应的 namespace
-		if (setns(fd, 0) == -1) {
-			//fprintf(stderr, "setns on %s namespace failed: %s\n", namespaces[i], strerror(errno));
-		} else {
-			//fprintf(stdout, "setns on %s namespace succeeded\n", namespaces[i]);
-		}
-		close(fd);
+	close(sync[1]);
+
+	if (config.cloneflags & CLONE_NEWUSER) {
+		enum sync_t s;
+
+		// stage1 has already reported why it did not get this far.
+		if (read(sync[0], &s, sizeof(s)) != sizeof(s))
+			exit(1);
+		if (s != SYNC_USERMAP_PLS)
+			bail("unexpected sync %#x, expected %#x", s, SYNC_USERMAP_PLS);
+		write_file(config.uidmap, config.uidmap_len, "/proc/%d/uid_map", pid);
+		write_file(config.gidmap, config.gidmap_len, "/proc/%d/gid_map", pid);
+		sync_send(sync[0], SYNC_USERMAP_ACK);
 	}
-	int res = system(docker_cmd);
 	exit(0);
-	return;
 }
 */
 import "C"
@@ -3,16 +3,32 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/tabwriter"
+	"unsafe"
 
+	"github.com/lipeining/godocker/container"
 	"github.com/urfave/cli"
 )
 
 var psCommand = cli.Command{
-	Name:      "ps",
-	Usage:     "ps displays the processes running inside a container",
-	ArgsUsage: `<container-id> [ps options]`,
+	Name:  "ps",
+	Usage: "ps displays the processes running inside a container",
+	ArgsUsage: `<container-id> [ps options]
+
+Without ps options the processes are read from /proc directly, with them
+the output of ps(1) is filtered to the processes of the container.`,
 	Flags: []cli.Flag{
 		cli.StringFlag{
 			Name:  "format, f",
@@ -21,74 +37,66 @@ var psCommand = cli.Command{
 		},
 	},
 	Action: func(context *cli.Context) error {
-		// if err := checkArgs(context, 1, minArgs); err != nil {
-		// 	return err
-		// }
-		// rootlessCg, err := shouldUseRootlessCgroupManager(context)
-		// if err != nil {
-		// 	return err
-		// }
-		// if rootlessCg {
-		// 	logrus.Warn("runc ps may fail if you don't have the full access to cgroups")
-		// }
-
-		// container, err := getContainer(context)
-		// if err != nil {
-		// 	return err
-		// }
-
-		// pids, err := container.Processes()
-		// if err != nil {
-		// 	return err
-		// }
-
-		// switch context.String("format") {
-		// case "table":
-		// case "json":
-		// 	return json.NewEncoder(os.Stdout).Encode(pids)
-		// default:
-		// 	return errors.New("invalid format option")
-		// }
-
-		// // [1:] is to remove command name, ex:
-		// // context.Args(): [container_id ps_arg1 ps_arg2 ...]
-		// // psArgs:         [ps_arg1 ps_arg2 ...]
-		// //
-		// psArgs := context.Args()[1:]
-		// if len(psArgs) == 0 {
-		// 	psArgs = []string{"-ef"}
-		// }
-
-		// cmd := exec.Command("ps", psArgs...)
-		// output, err := cmd.CombinedOutput()
-		// if err != nil {
-		// 	return fmt.Errorf("%s: %s", err, output)
-		// }
-
-		// lines := strings.Split(string(output), "\n")
-		// pidIndex, err := getPidIndex(lines[0])
-		// if err != nil {
-		// 	return err
-		// }
-
-		// fmt.Println(lines[0])
-		// for _, line := range lines[1:] {
-		// 	if len(line) == 0 {
-		// 		continue
-		// 	}
-		// 	fields := strings.Fields(line)
-		// 	p, err := strconv.Atoi(fields[pidIndex])
-		// 	if err != nil {
-		// 		return fmt.Errorf("unexpected pid '%s': %s", fields[pidIndex], err)
-		// 	}
-
-		// 	for _, pid := range pids {
-		// 		if pid == p {
-		// 			fmt.Println(line)
-		// 			break
-		// 		}
-		// 	}
-		// }
+		if err := checkArgs(context, 1, minArgs); err != nil {
+			return err
+		}
+		container, err := getContainer(context)
+		if err != nil {
+			return err
+		}
+
+		pids, err := container.Processes()
+		if err != nil {
+			return err
+		}
+
+		switch context.String("format") {
+		case "table":
+		case "json":
+			return json.NewEncoder(os.Stdout).Encode(pids)
+		default:
+			return errors.New("invalid format option")
+		}
+
+		// [1:] is to remove command name, ex:
+		// context.Args(): [container_id ps_arg1 ps_arg2 ...]
+		// psArgs:         [ps_arg1 ps_arg2 ...]
+		//
+		psArgs := context.Args()[1:]
+		if len(psArgs) == 0 {
+			return printProcTable(os.Stdout, pids)
+		}
+
+		cmd := exec.Command("ps", psArgs...)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s: %s", err, output)
+		}
+
+		lines := strings.Split(string(output), "\n")
+		pidIndex, err := getPidIndex(lines[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(lines[0])
+		for _, line := range lines[1:] {
+			if len(line) == 0 {
+				continue
+			}
+			fields := strings.Fields(line)
+			p, err := strconv.Atoi(fields[pidIndex])
+			if err != nil {
+				return fmt.Errorf("unexpected pid '%s': %s", fields[pidIndex], err)
+			}
+
+			for _, pid := range pids {
+				if pid == p {
+					fmt.Println(line)
+					break
+				}
+			}
+		}
 		return nil
 	},
 	SkipArgReorder: true,
@@ -106,3 +114,89 @@ func getPidIndex(title string) (int, error) {
 
 	return pidIndex, errors.New("couldn't find PID field in ps output")
 }
+
+// printProcTable prints the processes like "ps -f" does, but from /proc, so
+// that ps works on hosts without procps. Processes that exit while we read
+// them are left out.
+func printProcTable(out io.Writer, pids []int) error {
+	ticks, err := clockTicks()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 5, 1, 2, ' ', 0)
+	fmt.Fprint(w, "UID\tPID\tPPID\tSTAT\tTIME\tCMD\n")
+	for _, pid := range pids {
+		p, err := readProc(pid, ticks)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%c\t%s\t%s\n", p.user, pid, p.ppid, p.state, p.time, p.cmd)
+	}
+	return w.Flush()
+}
+
+type procInfo struct {
+	user  string
+	ppid  int
+	state byte
+	time  string
+	cmd   string
+}
+
+func readProc(pid int, ticks uint64) (*procInfo, error) {
+	dir := filepath.Join("/proc", strconv.Itoa(pid))
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := container.GetProcStat(pid)
+	if err != nil {
+		return nil, err
+	}
+	cmdline, err := ioutil.ReadFile(filepath.Join(dir, "cmdline"))
+	if err != nil {
+		return nil, err
+	}
+	cmd := strings.TrimRight(strings.Replace(string(cmdline), "\x00", " ", -1), " ")
+	if cmd == "" {
+		// kernel threads and zombies have no command line.
+		cmd = "[" + stat.Name + "]"
+	}
+	uid := fi.Sys().(*syscall.Stat_t).Uid
+	name := strconv.Itoa(int(uid))
+	if u, err := user.LookupId(name); err == nil {
+		name = u.Username
+	}
+	secs := (stat.UTime + stat.STime) / ticks
+	return &procInfo{
+		user:  name,
+		ppid:  stat.PPid,
+		state: stat.State,
+		time:  fmt.Sprintf("%02d:%02d:%02d", secs/3600, secs/60%60, secs%60),
+		cmd:   cmd,
+	}, nil
+}
+
+// clockTicks returns sysconf(_SC_CLK_TCK), which the C library takes from
+// the AT_CLKTCK entry the kernel puts in the auxiliary vector.
+func clockTicks() (uint64, error) {
+	const atClkTck = 17
+	data, err := ioutil.ReadFile("/proc/self/auxv")
+	if err != nil {
+		return 0, err
+	}
+	// the vector is a list of native word sized key value pairs.
+	size := int(unsafe.Sizeof(uintptr(0)))
+	for i := 0; i+2*size <= len(data); i += 2 * size {
+		key := *(*uintptr)(unsafe.Pointer(&data[i]))
+		if key == atClkTck {
+			if ticks := *(*uintptr)(unsafe.Pointer(&data[i+size])); ticks != 0 {
+				return uint64(ticks), nil
+			}
+		}
+	}
+	return 0, errors.New("no clock ticks in the auxiliary vector")
+}
@@ -0,0 +1,704 @@
+// +build linux
+
+// Package specconv implements conversion of specifications to godocker
+// configurations
+package specconv
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lipeining/godocker/configs"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+var namespaceMapping = map[specs.LinuxNamespaceType]configs.NamespaceType{
+	specs.PIDNamespace:     configs.NEWPID,
+	specs.NetworkNamespace: configs.NEWNET,
+	specs.MountNamespace:   configs.NEWNS,
+	specs.UserNamespace:    configs.NEWUSER,
+	specs.IPCNamespace:     configs.NEWIPC,
+	specs.UTSNamespace:     configs.NEWUTS,
+	specs.CgroupNamespace:  configs.NEWCGROUP,
+}
+
+var mountPropagationMapping = map[string]int{
+	"rprivate":    unix.MS_PRIVATE | unix.MS_REC,
+	"private":     unix.MS_PRIVATE,
+	"rslave":      unix.MS_SLAVE | unix.MS_REC,
+	"slave":       unix.MS_SLAVE,
+	"rshared":     unix.MS_SHARED | unix.MS_REC,
+	"shared":      unix.MS_SHARED,
+	"runbindable": unix.MS_UNBINDABLE | unix.MS_REC,
+	"unbindable":  unix.MS_UNBINDABLE,
+	"":            0,
+}
+
+// AllowedDevices are the devices every container gets regardless of the
+// devices listed in the spec.
+var AllowedDevices = []*configs.Device{
+	{
+		Path:     "/dev/null",
+		FileMode: 0666,
+		DeviceRule: configs.DeviceRule{
+			Type:        configs.CharDevice,
+			Major:       1,
+			Minor:       3,
+			Permissions: "rwm",
+			Allow:       true,
+		},
+	},
+	{
+		Path:     "/dev/random",
+		FileMode: 0666,
+		DeviceRule: configs.DeviceRule{
+			Type:        configs.CharDevice,
+			Major:       1,
+			Minor:       8,
+			Permissions: "rwm",
+			Allow:       true,
+		},
+	},
+	{
+		Path:     "/dev/full",
+		FileMode: 0666,
+		DeviceRule: configs.DeviceRule{
+			Type:        configs.CharDevice,
+			Major:       1,
+			Minor:       7,
+			Permissions: "rwm",
+			Allow:       true,
+		},
+	},
+	{
+		Path:     "/dev/tty",
+		FileMode: 0666,
+		DeviceRule: configs.DeviceRule{
+			Type:        configs.CharDevice,
+			Major:       5,
+			Minor:       0,
+			Permissions: "rwm",
+			Allow:       true,
+		},
+	},
+	{
+		Path:     "/dev/zero",
+		FileMode: 0666,
+		DeviceRule: configs.DeviceRule{
+			Type:        configs.CharDevice,
+			Major:       1,
+			Minor:       5,
+			Permissions: "rwm",
+			Allow:       true,
+		},
+	},
+	{
+		Path:     "/dev/urandom",
+		FileMode: 0666,
+		DeviceRule: configs.DeviceRule{
+			Type:        configs.CharDevice,
+			Major:       1,
+			Minor:       9,
+			Permissions: "rwm",
+			Allow:       true,
+		},
+	},
+}
+
+// CreateOpts holds the options used to build a configs.Config out of a spec.
+type CreateOpts struct {
+	CgroupName      string
+	NoPivotRoot     bool
+	NoNewKeyring    bool
+	Spec            *specs.Spec
+	RootlessEUID    bool
+	RootlessCgroups bool
+	// UseSystemdCgroup creates the cgroup as a transient scope of systemd.
+	UseSystemdCgroup bool
+}
+
+// CreateLibcontainerConfig creates a new container configuration from a
+// given specification and a cgroup name
+func CreateLibcontainerConfig(opts *CreateOpts) (*configs.Config, error) {
+	// godocker's cwd will always be the bundle path
+	rcwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	cwd, err := filepath.Abs(rcwd)
+	if err != nil {
+		return nil, err
+	}
+	spec := opts.Spec
+	if spec.Root == nil {
+		return nil, fmt.Errorf("Root must be specified")
+	}
+	rootfsPath := spec.Root.Path
+	if !filepath.IsAbs(rootfsPath) {
+		rootfsPath = filepath.Join(cwd, rootfsPath)
+	}
+	labels := []string{}
+	for k, v := range spec.Annotations {
+		labels = append(labels, fmt.Sprintf("%s=%s", k, v))
+	}
+	config := &configs.Config{
+		Rootfs:          rootfsPath,
+		NoPivotRoot:     opts.NoPivotRoot,
+		Readonlyfs:      spec.Root.Readonly,
+		Hostname:        spec.Hostname,
+		Labels:          append(labels, fmt.Sprintf("bundle=%s", cwd)),
+		NoNewKeyring:    opts.NoNewKeyring,
+		RootlessEUID:    opts.RootlessEUID,
+		RootlessCgroups: opts.RootlessCgroups,
+		Version:         spec.Version,
+	}
+
+	for _, m := range spec.Mounts {
+		config.Mounts = append(config.Mounts, createLibcontainerMount(cwd, m))
+	}
+
+	c, err := createCgroupConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	config.Cgroups = c
+
+	config.Devices = append(config.Devices, AllowedDevices...)
+	if spec.Linux != nil {
+		var exists bool
+		if config.RootPropagation, exists = mountPropagationMapping[spec.Linux.RootfsPropagation]; !exists {
+			return nil, fmt.Errorf("rootfsPropagation=%v is not supported", spec.Linux.RootfsPropagation)
+		}
+		for _, ns := range spec.Linux.Namespaces {
+			t, exists := namespaceMapping[ns.Type]
+			if !exists {
+				return nil, fmt.Errorf("namespace %q does not exist", ns)
+			}
+			if config.Namespaces.Contains(t) {
+				return nil, fmt.Errorf("malformed spec file: duplicated ns %q", ns)
+			}
+			config.Namespaces.Add(t, ns.Path)
+		}
+		if config.Namespaces.Contains(configs.NEWNET) && config.Namespaces.PathOf(configs.NEWNET) == "" {
+			config.Networks = []*configs.Network{
+				{
+					Type: "loopback",
+				},
+			}
+		}
+		if config.Namespaces.Contains(configs.NEWUSER) {
+			if err := setupUserNamespace(spec, config); err != nil {
+				return nil, err
+			}
+		}
+		devices, err := createDevices(spec)
+		if err != nil {
+			return nil, err
+		}
+		config.Devices = append(config.Devices, devices...)
+		config.MaskPaths = spec.Linux.MaskedPaths
+		config.ReadonlyPaths = spec.Linux.ReadonlyPaths
+		config.MountLabel = spec.Linux.MountLabel
+		config.Sysctl = spec.Linux.Sysctl
+	}
+	if spec.Process != nil {
+		config.NoNewPrivileges = spec.Process.NoNewPrivileges
+		config.OomScoreAdj = spec.Process.OOMScoreAdj
+		if spec.Process.Capabilities != nil {
+			config.Capabilities = &configs.Capabilities{
+				Bounding:    spec.Process.Capabilities.Bounding,
+				Effective:   spec.Process.Capabilities.Effective,
+				Permitted:   spec.Process.Capabilities.Permitted,
+				Inheritable: spec.Process.Capabilities.Inheritable,
+				Ambient:     spec.Process.Capabilities.Ambient,
+			}
+		}
+		for _, rlimit := range spec.Process.Rlimits {
+			rl, err := createLibContainerRlimit(rlimit)
+			if err != nil {
+				return nil, err
+			}
+			config.Rlimits = append(config.Rlimits, rl)
+		}
+	}
+	createHooks(spec, config)
+	return config, nil
+}
+
+func createHooks(rspec *specs.Spec, config *configs.Config) {
+	if rspec.Hooks == nil {
+		return
+	}
+	config.Hooks = &configs.Hooks{}
+	for _, h := range rspec.Hooks.Poststop {
+		config.Hooks.Poststop = append(config.Hooks.Poststop, createCommandHook(h))
+	}
+}
+
+func createCommandHook(h specs.Hook) configs.Command {
+	cmd := configs.Command{
+		Path: h.Path,
+		Args: h.Args,
+		Env:  h.Env,
+	}
+	if h.Timeout != nil {
+		d := time.Duration(*h.Timeout) * time.Second
+		cmd.Timeout = &d
+	}
+	return cmd
+}
+
+func createLibcontainerMount(cwd string, m specs.Mount) *configs.Mount {
+	flags, pgflags, data, ext := parseMountOptions(m.Options)
+	source := m.Source
+	device := m.Type
+	if flags&unix.MS_BIND != 0 {
+		// Any "type" the user specified is meaningless (and ignored) for
+		// bind-mounts -- so we set it to "bind" because rootfs setup
+		// relies on that.
+		device = "bind"
+		if !filepath.IsAbs(source) {
+			source = filepath.Join(cwd, m.Source)
+		}
+	}
+	return &configs.Mount{
+		Device:           device,
+		Source:           source,
+		Destination:      m.Destination,
+		Data:             data,
+		Flags:            flags,
+		PropagationFlags: pgflags,
+		Extensions:       ext,
+	}
+}
+
+func createCgroupConfig(opts *CreateOpts) (*configs.Cgroup, error) {
+	var (
+		myCgroupPath string
+
+		spec = opts.Spec
+		name = opts.CgroupName
+	)
+
+	c := &configs.Cgroup{
+		Resources: &configs.Resources{},
+	}
+
+	if spec.Linux != nil && spec.Linux.CgroupsPath != "" {
+		myCgroupPath = spec.Linux.CgroupsPath
+	}
+
+	if opts.UseSystemdCgroup {
+		// the path of a systemd cgroup is "slice:prefix:name".
+		if myCgroupPath == "" {
+			myCgroupPath = ":godocker:" + name
+		}
+		parts := strings.Split(myCgroupPath, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("expected cgroupsPath to be of format \"slice:prefix:name\" for systemd cgroups, got %q instead", myCgroupPath)
+		}
+		c.Systemd = true
+		c.Parent = parts[0]
+		c.ScopePrefix = parts[1]
+		c.Name = parts[2]
+	} else {
+		if myCgroupPath == "" {
+			c.Name = name
+		}
+		c.Path = myCgroupPath
+		if c.Path == "" {
+			c.Path = filepath.Join("/", name)
+		}
+	}
+
+	if spec.Linux == nil || spec.Linux.Resources == nil {
+		c.Resources.Devices = defaultDeviceRules()
+		return c, nil
+	}
+	r := spec.Linux.Resources
+	for _, d := range r.Devices {
+		var (
+			t     = "a"
+			major = int64(-1)
+			minor = int64(-1)
+		)
+		if d.Type != "" {
+			t = d.Type
+		}
+		if d.Major != nil {
+			major = *d.Major
+		}
+		if d.Minor != nil {
+			minor = *d.Minor
+		}
+		if d.Access == "" {
+			return nil, fmt.Errorf("device access at %d field cannot be empty", len(c.Resources.Devices))
+		}
+		dt, err := stringToCgroupDeviceRune(t)
+		if err != nil {
+			return nil, err
+		}
+		c.Resources.Devices = append(c.Resources.Devices, &configs.DeviceRule{
+			Type:        dt,
+			Major:       major,
+			Minor:       minor,
+			Permissions: configs.DevicePermissions(d.Access),
+			Allow:       d.Allow,
+		})
+	}
+	if r.Memory != nil {
+		if r.Memory.Limit != nil {
+			c.Resources.Memory = *r.Memory.Limit
+		}
+		if r.Memory.Reservation != nil {
+			c.Resources.MemoryReservation = *r.Memory.Reservation
+		}
+		if r.Memory.Swap != nil {
+			c.Resources.MemorySwap = *r.Memory.Swap
+		}
+		if r.Memory.Kernel != nil {
+			c.Resources.KernelMemory = *r.Memory.Kernel
+		}
+		if r.Memory.KernelTCP != nil {
+			c.Resources.KernelMemoryTCP = *r.Memory.KernelTCP
+		}
+		if r.Memory.Swappiness != nil {
+			c.Resources.MemorySwappiness = r.Memory.Swappiness
+		}
+		if r.Memory.DisableOOMKiller != nil {
+			c.Resources.OomKillDisable = *r.Memory.DisableOOMKiller
+		}
+	}
+	if r.CPU != nil {
+		if r.CPU.Shares != nil {
+			c.Resources.CpuShares = *r.CPU.Shares
+		}
+		if r.CPU.Quota != nil {
+			c.Resources.CpuQuota = *r.CPU.Quota
+		}
+		if r.CPU.Period != nil {
+			c.Resources.CpuPeriod = *r.CPU.Period
+		}
+		if r.CPU.RealtimeRuntime != nil {
+			c.Resources.CpuRtRuntime = *r.CPU.RealtimeRuntime
+		}
+		if r.CPU.RealtimePeriod != nil {
+			c.Resources.CpuRtPeriod = *r.CPU.RealtimePeriod
+		}
+		c.Resources.CpusetCpus = r.CPU.Cpus
+		c.Resources.CpusetMems = r.CPU.Mems
+	}
+	if r.Pids != nil {
+		c.Resources.PidsLimit = r.Pids.Limit
+	}
+	if r.BlockIO != nil {
+		if r.BlockIO.Weight != nil {
+			c.Resources.BlkioWeight = *r.BlockIO.Weight
+		}
+		if r.BlockIO.LeafWeight != nil {
+			c.Resources.BlkioLeafWeight = *r.BlockIO.LeafWeight
+		}
+		for _, wd := range r.BlockIO.WeightDevice {
+			var weight, leafWeight uint16
+			if wd.Weight != nil {
+				weight = *wd.Weight
+			}
+			if wd.LeafWeight != nil {
+				leafWeight = *wd.LeafWeight
+			}
+			c.Resources.BlkioWeightDevice = append(c.Resources.BlkioWeightDevice, configs.NewWeightDevice(wd.Major, wd.Minor, weight, leafWeight))
+		}
+		for _, td := range r.BlockIO.ThrottleReadBpsDevice {
+			c.Resources.BlkioThrottleReadBpsDevice = append(c.Resources.BlkioThrottleReadBpsDevice, configs.NewThrottleDevice(td.Major, td.Minor, td.Rate))
+		}
+		for _, td := range r.BlockIO.ThrottleWriteBpsDevice {
+			c.Resources.BlkioThrottleWriteBpsDevice = append(c.Resources.BlkioThrottleWriteBpsDevice, configs.NewThrottleDevice(td.Major, td.Minor, td.Rate))
+		}
+		for _, td := range r.BlockIO.ThrottleReadIOPSDevice {
+			c.Resources.BlkioThrottleReadIOPSDevice = append(c.Resources.BlkioThrottleReadIOPSDevice, configs.NewThrottleDevice(td.Major, td.Minor, td.Rate))
+		}
+		for _, td := range r.BlockIO.ThrottleWriteIOPSDevice {
+			c.Resources.BlkioThrottleWriteIOPSDevice = append(c.Resources.BlkioThrottleWriteIOPSDevice, configs.NewThrottleDevice(td.Major, td.Minor, td.Rate))
+		}
+	}
+	for _, l := range r.HugepageLimits {
+		c.Resources.HugetlbLimit = append(c.Resources.HugetlbLimit, &configs.HugepageLimit{
+			Pagesize: l.Pagesize,
+			Limit:    l.Limit,
+		})
+	}
+	for device, l := range r.Rdma {
+		if c.Resources.Rdma == nil {
+			c.Resources.Rdma = make(map[string]configs.LinuxRdma)
+		}
+		c.Resources.Rdma[device] = configs.LinuxRdma{
+			HcaHandles: l.HcaHandles,
+			HcaObjects: l.HcaObjects,
+		}
+	}
+	if r.Network != nil {
+		if r.Network.ClassID != nil {
+			c.Resources.NetClsClassid = *r.Network.ClassID
+		}
+	}
+	// the default devices go last so that the spec cannot deny them.
+	c.Resources.Devices = append(c.Resources.Devices, defaultDeviceRules()...)
+	return c, nil
+}
+
+// defaultDeviceRules returns the device cgroup rules for AllowedDevices and
+// for the devices a container may create or gets through devpts.
+func defaultDeviceRules() []*configs.DeviceRule {
+	rules := []*configs.DeviceRule{
+		{
+			Type:        configs.CharDevice,
+			Major:       configs.Wildcard,
+			Minor:       configs.Wildcard,
+			Permissions: "m",
+			Allow:       true,
+		},
+		{
+			Type:        configs.BlockDevice,
+			Major:       configs.Wildcard,
+			Minor:       configs.Wildcard,
+			Permissions: "m",
+			Allow:       true,
+		},
+		// /dev/console
+		{
+			Type:        configs.CharDevice,
+			Major:       5,
+			Minor:       1,
+			Permissions: "rwm",
+			Allow:       true,
+		},
+		// /dev/pts/*
+		{
+			Type:        configs.CharDevice,
+			Major:       136,
+			Minor:       configs.Wildcard,
+			Permissions: "rwm",
+			Allow:       true,
+		},
+		// /dev/ptmx
+		{
+			Type:        configs.CharDevice,
+			Major:       5,
+			Minor:       2,
+			Permissions: "rwm",
+			Allow:       true,
+		},
+	}
+	for _, d := range AllowedDevices {
+		rule := d.DeviceRule
+		rules = append(rules, &rule)
+	}
+	return rules
+}
+
+func stringToCgroupDeviceRune(s string) (configs.DeviceType, error) {
+	switch s {
+	case "a":
+		return configs.WildcardDevice, nil
+	case "b":
+		return configs.BlockDevice, nil
+	case "c":
+		return configs.CharDevice, nil
+	default:
+		return 0, fmt.Errorf("invalid cgroup device type %q", s)
+	}
+}
+
+func stringToDeviceRune(s string) (configs.DeviceType, error) {
+	switch s {
+	case "p":
+		return configs.FifoDevice, nil
+	case "u", "c":
+		return configs.CharDevice, nil
+	case "b":
+		return configs.BlockDevice, nil
+	default:
+		return 0, fmt.Errorf("invalid device type %q", s)
+	}
+}
+
+func createDevices(spec *specs.Spec) ([]*configs.Device, error) {
+	var devs []*configs.Device
+	for _, d := range spec.Linux.Devices {
+		var uid, gid uint32
+		var filemode os.FileMode = 0666
+		if d.UID != nil {
+			uid = *d.UID
+		}
+		if d.GID != nil {
+			gid = *d.GID
+		}
+		dt, err := stringToDeviceRune(d.Type)
+		if err != nil {
+			return nil, err
+		}
+		if d.FileMode != nil {
+			filemode = *d.FileMode
+		}
+		devs = append(devs, &configs.Device{
+			DeviceRule: configs.DeviceRule{
+				Type:  dt,
+				Major: d.Major,
+				Minor: d.Minor,
+			},
+			Path:     d.Path,
+			FileMode: filemode,
+			Uid:      uid,
+			Gid:      gid,
+		})
+	}
+	return devs, nil
+}
+
+func setupUserNamespace(spec *specs.Spec, config *configs.Config) error {
+	create := func(m specs.LinuxIDMapping) configs.IDMap {
+		return configs.IDMap{
+			HostID:      int(m.HostID),
+			ContainerID: int(m.ContainerID),
+			Size:        int(m.Size),
+		}
+	}
+	for _, m := range spec.Linux.UIDMappings {
+		config.UidMappings = append(config.UidMappings, create(m))
+	}
+	for _, m := range spec.Linux.GIDMappings {
+		config.GidMappings = append(config.GidMappings, create(m))
+	}
+	return nil
+}
+
+func createLibContainerRlimit(rlimit specs.POSIXRlimit) (configs.Rlimit, error) {
+	rl, err := strToRlimit(rlimit.Type)
+	if err != nil {
+		return configs.Rlimit{}, err
+	}
+	return configs.Rlimit{
+		Type: rl,
+		Hard: rlimit.Hard,
+		Soft: rlimit.Soft,
+	}, nil
+}
+
+var rlimitMap = map[string]int{
+	"RLIMIT_CPU":        unix.RLIMIT_CPU,
+	"RLIMIT_FSIZE":      unix.RLIMIT_FSIZE,
+	"RLIMIT_DATA":       unix.RLIMIT_DATA,
+	"RLIMIT_STACK":      unix.RLIMIT_STACK,
+	"RLIMIT_CORE":       unix.RLIMIT_CORE,
+	"RLIMIT_RSS":        unix.RLIMIT_RSS,
+	"RLIMIT_NPROC":      unix.RLIMIT_NPROC,
+	"RLIMIT_NOFILE":     unix.RLIMIT_NOFILE,
+	"RLIMIT_MEMLOCK":    unix.RLIMIT_MEMLOCK,
+	"RLIMIT_AS":         unix.RLIMIT_AS,
+	"RLIMIT_LOCKS":      unix.RLIMIT_LOCKS,
+	"RLIMIT_SIGPENDING": unix.RLIMIT_SIGPENDING,
+	"RLIMIT_MSGQUEUE":   unix.RLIMIT_MSGQUEUE,
+	"RLIMIT_NICE":       unix.RLIMIT_NICE,
+	"RLIMIT_RTPRIO":     unix.RLIMIT_RTPRIO,
+	"RLIMIT_RTTIME":     unix.RLIMIT_RTTIME,
+}
+
+func strToRlimit(key string) (int, error) {
+	rl, ok := rlimitMap[key]
+	if !ok {
+		return 0, fmt.Errorf("wrong rlimit value: %s", key)
+	}
+	return rl, nil
+}
+
+// parseMountOptions parses the string and returns the flags, propagation
+// flags, any mount data and the extension flags that it contains.
+func parseMountOptions(options []string) (int, []int, string, int) {
+	var (
+		flag     int
+		pgflag   []int
+		data     []string
+		extFlags int
+	)
+	flags := map[string]struct {
+		clear bool
+		flag  int
+	}{
+		"acl":           {false, unix.MS_POSIXACL},
+		"async":         {true, unix.MS_SYNCHRONOUS},
+		"atime":         {true, unix.MS_NOATIME},
+		"bind":          {false, unix.MS_BIND},
+		"defaults":      {false, 0},
+		"dev":           {true, unix.MS_NODEV},
+		"diratime":      {true, unix.MS_NODIRATIME},
+		"dirsync":       {false, unix.MS_DIRSYNC},
+		"exec":          {true, unix.MS_NOEXEC},
+		"iversion":      {false, unix.MS_I_VERSION},
+		"lazytime":      {false, unix.MS_LAZYTIME},
+		"loud":          {true, unix.MS_SILENT},
+		"mand":          {false, unix.MS_MANDLOCK},
+		"noacl":         {true, unix.MS_POSIXACL},
+		"noatime":       {false, unix.MS_NOATIME},
+		"nodev":         {false, unix.MS_NODEV},
+		"nodiratime":    {false, unix.MS_NODIRATIME},
+		"noexec":        {false, unix.MS_NOEXEC},
+		"noiversion":    {true, unix.MS_I_VERSION},
+		"nolazytime":    {true, unix.MS_LAZYTIME},
+		"nomand":        {true, unix.MS_MANDLOCK},
+		"norelatime":    {true, unix.MS_RELATIME},
+		"nostrictatime": {true, unix.MS_STRICTATIME},
+		"nosuid":        {false, unix.MS_NOSUID},
+		"rbind":         {false, unix.MS_BIND | unix.MS_REC},
+		"relatime":      {false, unix.MS_RELATIME},
+		"remount":       {false, unix.MS_REMOUNT},
+		"ro":            {false, unix.MS_RDONLY},
+		"rw":            {true, unix.MS_RDONLY},
+		"silent":        {false, unix.MS_SILENT},
+		"strictatime":   {false, unix.MS_STRICTATIME},
+		"suid":          {true, unix.MS_NOSUID},
+		"sync":          {false, unix.MS_SYNCHRONOUS},
+	}
+	propagationFlags := map[string]int{
+		"private":     unix.MS_PRIVATE,
+		"shared":      unix.MS_SHARED,
+		"slave":       unix.MS_SLAVE,
+		"unbindable":  unix.MS_UNBINDABLE,
+		"rprivate":    unix.MS_PRIVATE | unix.MS_REC,
+		"rshared":     unix.MS_SHARED | unix.MS_REC,
+		"rslave":      unix.MS_SLAVE | unix.MS_REC,
+		"runbindable": unix.MS_UNBINDABLE | unix.MS_REC,
+	}
+	extensionFlags := map[string]struct {
+		clear bool
+		flag  int
+	}{
+		"tmpcopyup": {false, configs.EXT_COPYUP},
+	}
+	for _, o := range options {
+		// If the option does not exist in the flags table or the flag
+		// is not supported on the platform,
+		// then it is a data value for a specific fs type
+		if f, exists := flags[o]; exists && f.flag != 0 {
+			if f.clear {
+				flag &= ^f.flag
+			} else {
+				flag |= f.flag
+			}
+		} else if f, exists := propagationFlags[o]; exists && f != 0 {
+			pgflag = append(pgflag, f)
+		} else if f, exists := extensionFlags[o]; exists && f.flag != 0 {
+			if f.clear {
+				extFlags &= ^f.flag
+			} else {
+				extFlags |= f.flag
+			}
+		} else {
+			data = append(data, o)
+		}
+	}
+	return flag, pgflag, strings.Join(data, ","), extFlags
+}
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+
+	"github.com/lipeining/godocker/container"
 	"github.com/urfave/cli"
 )
 
@@ -14,37 +18,26 @@ are starting. The name you provide for the container instance must be unique on
 your host.`,
 	Description: `The start command executes the user defined process in a created container.`,
 	Action: func(context *cli.Context) error {
-		return nil
-		// if err := checkArgs(context, 1, exactArgs); err != nil {
-		// 	return err
-		// }
-		// container, err := getContainer(context)
-		// if err != nil {
-		// 	return err
-		// }
-		// status, err := container.Status()
-		// if err != nil {
-		// 	return err
-		// }
-		// switch status {
-		// case libcontainer.Created:
-		// 	notifySocket, err := notifySocketStart(context, os.Getenv("NOTIFY_SOCKET"), container.ID())
-		// 	if err != nil {
-		// 		return err
-		// 	}
-		// 	if err := container.Exec(); err != nil {
-		// 		return err
-		// 	}
-		// 	if notifySocket != nil {
-		// 		return notifySocket.waitForContainer(container)
-		// 	}
-		// 	return nil
-		// case libcontainer.Stopped:
-		// 	return errors.New("cannot start a container that has stopped")
-		// case libcontainer.Running:
-		// 	return errors.New("cannot start an already running container")
-		// default:
-		// 	return fmt.Errorf("cannot start a container in the %s state\n", status)
-		// }
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+		c, err := getContainer(context)
+		if err != nil {
+			return err
+		}
+		status, err := c.Status()
+		if err != nil {
+			return err
+		}
+		switch status {
+		case container.Created:
+			return c.Exec()
+		case container.Stopped:
+			return errors.New("cannot start a container that has stopped")
+		case container.Running:
+			return errors.New("cannot start an already running container")
+		default:
+			return fmt.Errorf("cannot start a container in the %s state", status)
+		}
 	},
 }
@@ -0,0 +1,40 @@
+// +build linux
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/urfave/cli"
+)
+
+var stateCommand = cli.Command{
+	Name:  "state",
+	Usage: "output the state of a container",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is your name for the instance of the container.`,
+	Description: `The state command outputs current state information for the
+instance of a container.`,
+	Action: func(context *cli.Context) error {
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+		c, err := getContainer(context)
+		if err != nil {
+			return err
+		}
+		state, err := c.OCIState()
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(state, "", "  ")
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(data)
+		os.Stdout.Write([]byte("\n"))
+		return nil
+	},
+}
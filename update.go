@@ -0,0 +1,264 @@
+// +build linux
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/urfave/cli"
+)
+
+var updateCommand = cli.Command{
+	Name:      "update",
+	Usage:     "update container resource constraints",
+	ArgsUsage: `<container-id>`,
+	Description: `The update command changes the resources of a running container,
+either from the flags or from a file with the resources of a config.json.
+Memory sizes accept a b, k, m or g suffix.
+
+The accepted format of the resources file is as follows:
+
+   {
+     "memory": {
+       "limit": 0,
+       "reservation": 0,
+       "swap": 0
+     },
+     "cpu": {
+       "shares": 0,
+       "quota": 0,
+       "period": 0,
+       "cpus": "",
+       "mems": ""
+     },
+     "blockIO": {
+       "weight": 0
+     },
+     "pids": {
+       "limit": 0
+     }
+   }
+
+Note: if data is to be read from a file or the standard input, all
+other options are ignored.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "resources, r",
+			Usage: `path to the file containing the resources to update or '-' to read from the standard input`,
+		},
+		cli.StringFlag{
+			Name:  "memory",
+			Usage: "memory limit (in bytes)",
+		},
+		cli.StringFlag{
+			Name:  "memory-reservation",
+			Usage: "memory reservation or soft limit (in bytes)",
+		},
+		cli.StringFlag{
+			Name:  "memory-swap",
+			Usage: "total memory usage (memory + swap); set '-1' to enable unlimited swap",
+		},
+		cli.StringFlag{
+			Name:  "cpu-shares",
+			Usage: "CPU shares (relative weight vs. other containers)",
+		},
+		cli.StringFlag{
+			Name:  "cpu-quota",
+			Usage: "CPU CFS hardcap limit (in usecs). Allowed cpu time in a given period",
+		},
+		cli.StringFlag{
+			Name:  "cpu-period",
+			Usage: "CPU CFS period to be used for hardcapping (in usecs). 0 to use system default",
+		},
+		cli.StringFlag{
+			Name:  "cpuset-cpus",
+			Usage: "CPU(s) to use",
+		},
+		cli.StringFlag{
+			Name:  "cpuset-mems",
+			Usage: "Memory node(s) to use",
+		},
+		cli.IntFlag{
+			Name:  "pids-limit",
+			Usage: "Maximum number of pids allowed in the container",
+		},
+		cli.IntFlag{
+			Name:  "blkio-weight",
+			Usage: "Specifies per cgroup weight, range is from 10 to 1000",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+		container, err := getContainer(context)
+		if err != nil {
+			return err
+		}
+		r := specs.LinuxResources{
+			Memory:  &specs.LinuxMemory{},
+			CPU:     &specs.LinuxCPU{},
+			BlockIO: &specs.LinuxBlockIO{},
+			Pids:    &specs.LinuxPids{},
+		}
+		if in := context.String("resources"); in != "" {
+			var f io.Reader = os.Stdin
+			if in != "-" {
+				file, err := os.Open(in)
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				f = file
+			}
+			if err := json.NewDecoder(f).Decode(&r); err != nil {
+				return fmt.Errorf("decoding resources: %v", err)
+			}
+		} else if err := updateFromFlags(context, &r); err != nil {
+			return err
+		}
+
+		config := container.Config()
+		if config.Cgroups == nil || config.Cgroups.Resources == nil {
+			return fmt.Errorf("container %s has no cgroup to update", container.ID())
+		}
+		// copy the resources so that the container keeps the current ones
+		// to roll back to.
+		resources := *config.Cgroups.Resources
+		cgroup := *config.Cgroups
+		cgroup.Resources = &resources
+		config.Cgroups = &cgroup
+
+		if r.Memory != nil {
+			for _, v := range []struct {
+				value *int64
+				dest  *int64
+			}{
+				{r.Memory.Limit, &resources.Memory},
+				{r.Memory.Reservation, &resources.MemoryReservation},
+				{r.Memory.Swap, &resources.MemorySwap},
+			} {
+				if v.value != nil {
+					*v.dest = *v.value
+				}
+			}
+		}
+		if r.CPU != nil {
+			if r.CPU.Shares != nil {
+				resources.CpuShares = *r.CPU.Shares
+			}
+			if r.CPU.Quota != nil {
+				resources.CpuQuota = *r.CPU.Quota
+			}
+			if r.CPU.Period != nil {
+				resources.CpuPeriod = *r.CPU.Period
+			}
+			if r.CPU.Cpus != "" {
+				resources.CpusetCpus = r.CPU.Cpus
+			}
+			if r.CPU.Mems != "" {
+				resources.CpusetMems = r.CPU.Mems
+			}
+		}
+		if r.BlockIO != nil && r.BlockIO.Weight != nil {
+			resources.BlkioWeight = *r.BlockIO.Weight
+		}
+		if r.Pids != nil && r.Pids.Limit != 0 {
+			resources.PidsLimit = r.Pids.Limit
+		}
+		return container.Set(config)
+	},
+	// keep "-r -" from being taken for the container id.
+	SkipArgReorder: true,
+}
+
+// updateFromFlags fills the resources with the flags that are set.
+func updateFromFlags(context *cli.Context, r *specs.LinuxResources) error {
+	for _, pair := range []struct {
+		opt  string
+		dest **uint64
+	}{
+		{"cpu-period", &r.CPU.Period},
+		{"cpu-shares", &r.CPU.Shares},
+	} {
+		if val := context.String(pair.opt); val != "" {
+			v, err := strconv.ParseUint(val, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid value for %s: %v", pair.opt, err)
+			}
+			*pair.dest = &v
+		}
+	}
+	if val := context.String("cpu-quota"); val != "" {
+		v, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid value for cpu-quota: %v", err)
+		}
+		r.CPU.Quota = &v
+	}
+	for _, pair := range []struct {
+		opt  string
+		dest **int64
+	}{
+		{"memory", &r.Memory.Limit},
+		{"memory-reservation", &r.Memory.Reservation},
+		{"memory-swap", &r.Memory.Swap},
+	} {
+		if val := context.String(pair.opt); val != "" {
+			v, err := parseMemory(val)
+			if err != nil {
+				return fmt.Errorf("invalid value for %s: %v", pair.opt, err)
+			}
+			*pair.dest = &v
+		}
+	}
+	r.CPU.Cpus = context.String("cpuset-cpus")
+	r.CPU.Mems = context.String("cpuset-mems")
+	r.Pids.Limit = int64(context.Int("pids-limit"))
+	if context.IsSet("blkio-weight") {
+		v := context.Int("blkio-weight")
+		if v < 10 || v > 1000 {
+			return fmt.Errorf("invalid value for blkio-weight: %d is not within 10 and 1000", v)
+		}
+		weight := uint16(v)
+		r.BlockIO.Weight = &weight
+	}
+	return nil
+}
+
+// parseMemory parses a size in bytes with an optional b, k, m or g suffix,
+// -1 stands for unlimited.
+func parseMemory(s string) (int64, error) {
+	if s == "-1" {
+		return -1, nil
+	}
+	lower := strings.TrimSuffix(strings.ToLower(s), "b")
+	shift := uint(0)
+	if n := len(lower); n > 0 {
+		switch lower[n-1] {
+		case 'k':
+			shift = 10
+		case 'm':
+			shift = 20
+		case 'g':
+			shift = 30
+		}
+		if shift != 0 {
+			lower = lower[:n-1]
+		}
+	}
+	v, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	if v > (1<<63-1)>>shift {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return v << shift, nil
+}
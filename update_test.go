@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestParseMemory(t *testing.T) {
+	for _, tc := range []struct {
+		in       string
+		expected int64
+		invalid  bool
+	}{
+		{in: "1024", expected: 1024},
+		{in: "512b", expected: 512},
+		{in: "4k", expected: 4 << 10},
+		{in: "4KB", expected: 4 << 10},
+		{in: "64m", expected: 64 << 20},
+		{in: "2g", expected: 2 << 30},
+		{in: "-1", expected: -1},
+		{in: "-2", invalid: true},
+		{in: "", invalid: true},
+		{in: "g", invalid: true},
+		{in: "1t", invalid: true},
+		{in: "8589934592g", invalid: true},
+	} {
+		v, err := parseMemory(tc.in)
+		if tc.invalid {
+			if err == nil {
+				t.Errorf("expected an error for %q but received %d", tc.in, v)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsing %q: %v", tc.in, err)
+			continue
+		}
+		if v != tc.expected {
+			t.Errorf("expected %q to be %d but received %d", tc.in, tc.expected, v)
+		}
+	}
+}
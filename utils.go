@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -8,9 +9,13 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/lipeining/godocker/configs"
 	"github.com/lipeining/godocker/container"
+	"github.com/lipeining/godocker/specconv"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
+	"golang.org/x/sys/unix"
 )
 
 const (
@@ -76,54 +81,286 @@ func parseBoolOrAuto(s string) (*bool, error) {
 
 var errEmptyID = errors.New("container id is empty")
 
-func createContainer(context *cli.Context, id string) (container.Container, error) {
+// CtAct is the action the runner performs once the container is created.
+type CtAct uint8
+
+const (
+	CT_ACT_CREATE CtAct = iota + 1
+	CT_ACT_RUN
+)
+
+// setupSpec performs initial setup based on the cli.Context for the container
+func setupSpec(context *cli.Context) (*specs.Spec, error) {
+	bundle := context.String("bundle")
+	if bundle != "" {
+		if err := os.Chdir(bundle); err != nil {
+			return nil, err
+		}
+	}
+	spec, err := loadSpec(specConfig)
+	if err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// loadSpec loads the specification from the provided path.
+func loadSpec(cPath string) (spec *specs.Spec, err error) {
+	cf, err := os.Open(cPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("JSON specification file %s not found", cPath)
+		}
+		return nil, err
+	}
+	defer cf.Close()
+
+	if err = json.NewDecoder(cf).Decode(&spec); err != nil {
+		return nil, err
+	}
+	return spec, validateProcessSpec(spec.Process)
+}
+
+func validateProcessSpec(spec *specs.Process) error {
+	if spec == nil {
+		return errors.New("process property must not be empty")
+	}
+	if spec.Cwd == "" {
+		return errors.New("Cwd property must not be empty")
+	}
+	if !filepath.IsAbs(spec.Cwd) {
+		return errors.New("Cwd must be an absolute path")
+	}
+	if len(spec.Args) == 0 {
+		return errors.New("args must not be empty")
+	}
+	return nil
+}
+
+// loadFactory returns the configured factory instance for execing containers.
+func loadFactory(context *cli.Context) (container.Factory, error) {
 	root := context.GlobalString("root")
 	abs, err := filepath.Abs(root)
 	if err != nil {
 		return nil, err
 	}
-	factory, err := container.New(abs)
+	return container.New(abs)
+}
+
+// getContainer returns the specified container instance by loading it from state
+// with the default factory.
+func getContainer(context *cli.Context) (container.Container, error) {
+	id := context.Args().First()
+	if id == "" {
+		return nil, errEmptyID
+	}
+	factory, err := loadFactory(context)
 	if err != nil {
 		return nil, err
 	}
-	return factory.Create(id)
+	return factory.Load(id)
+}
+
+func createContainer(context *cli.Context, id string, spec *specs.Spec) (container.Container, error) {
+	config, err := specconv.CreateLibcontainerConfig(&specconv.CreateOpts{
+		CgroupName:       id,
+		NoPivotRoot:      context.Bool("no-pivot"),
+		NoNewKeyring:     context.Bool("no-new-keyring"),
+		Spec:             spec,
+		UseSystemdCgroup: context.GlobalBool("systemd-cgroup"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	factory, err := loadFactory(context)
+	if err != nil {
+		return nil, err
+	}
+	return factory.Create(id, config)
+}
+
+// newProcess returns a new container.Process with the arguments from the
+// spec and stdio from the current process.
+func newProcess(p specs.Process, init bool) *container.Process {
+	lp := &container.Process{
+		Args: p.Args,
+		Env:  p.Env,
+		User: fmt.Sprintf("%d:%d", p.User.UID, p.User.GID),
+		Cwd:  p.Cwd,
+		Init: init,
+	}
+	for _, gid := range p.User.AdditionalGids {
+		lp.AdditionalGroups = append(lp.AdditionalGroups, strconv.FormatUint(uint64(gid), 10))
+	}
+	if p.Capabilities != nil {
+		lp.Capabilities = &configs.Capabilities{
+			Bounding:    p.Capabilities.Bounding,
+			Effective:   p.Capabilities.Effective,
+			Inheritable: p.Capabilities.Inheritable,
+			Permitted:   p.Capabilities.Permitted,
+			Ambient:     p.Capabilities.Ambient,
+		}
+	}
+	lp.NoNewPrivileges = &p.NoNewPrivileges
+	return lp
+}
+
+// createPidFile creates a file with the processes pid inside it atomically
+// it creates a temp file with the paths filename + '.' infront of it
+// then renames the file
+func createPidFile(path string, process *container.Process) error {
+	pid, err := process.Pid()
+	if err != nil {
+		return err
+	}
+	var (
+		tmpDir  = filepath.Dir(path)
+		tmpName = filepath.Join(tmpDir, fmt.Sprintf(".%s", filepath.Base(path)))
+	)
+	f, err := os.OpenFile(tmpName, os.O_RDWR|os.O_CREATE|os.O_EXCL|os.O_SYNC, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f, "%d", pid)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
+
+// exitStatus returns the correct exit status for a process based on if it
+// was signaled or exited cleanly
+func exitStatus(status unix.WaitStatus) int {
+	if status.Signaled() {
+		return exitSignalOffset + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
+
+type runner struct {
+	init            bool
+	enableSubreaper bool
+	shouldDestroy   bool
+	detach          bool
+	preserveFDs     int
+	pidFile         string
+	consoleSocket   string
+	container       container.Container
+	action          CtAct
+}
+
+func (r *runner) run(config *specs.Process) (int, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			r.destroy()
+		}
+	}()
+	// a created container is always detached, it is started by another
+	// invocation of godocker.
+	detach := r.detach || (r.action == CT_ACT_CREATE)
+	if err = r.checkTerminal(config, detach); err != nil {
+		return -1, err
+	}
+	process := newProcess(*config, r.init)
+	baseFd := 3 + len(process.ExtraFiles)
+	for i := baseFd; i < baseFd+r.preserveFDs; i++ {
+		process.ExtraFiles = append(process.ExtraFiles, os.NewFile(uintptr(i), "PreserveFD:"+strconv.Itoa(i)))
+	}
+	// Setting up IO is a two stage process. We need to modify process to deal
+	// with detaching containers, and then we get a tty after the container has
+	// started.
+	handler := newSignalHandler(r.enableSubreaper)
+	tty, err := setupIO(process, config.Terminal, detach, r.consoleSocket)
+	if err != nil {
+		return -1, err
+	}
+	defer tty.Close()
+
+	switch r.action {
+	case CT_ACT_CREATE:
+		err = r.container.Start(process)
+	case CT_ACT_RUN:
+		err = r.container.Run(process)
+	default:
+		panic("Unknown action")
+	}
+	if err != nil {
+		return -1, err
+	}
+	if err = tty.waitConsole(); err != nil {
+		r.terminate(process)
+		return -1, err
+	}
+	if err = tty.ClosePostStart(); err != nil {
+		r.terminate(process)
+		return -1, err
+	}
+	if r.pidFile != "" {
+		if err = createPidFile(r.pidFile, process); err != nil {
+			r.terminate(process)
+			return -1, err
+		}
+	}
+	if detach {
+		return 0, nil
+	}
+	status, err := handler.forward(process, tty)
+	if err != nil {
+		r.terminate(process)
+	}
+	r.destroy()
+	return status, err
 }
 
-func startContainer(context *cli.Context) (int, error) {
+func (r *runner) destroy() {
+	if r.shouldDestroy {
+		destroy(r.container)
+	}
+}
+
+func destroy(container container.Container) {
+	if err := container.Destroy(); err != nil {
+		logrus.Error(err)
+	}
+}
+
+func (r *runner) terminate(p *container.Process) {
+	_ = p.Signal(unix.SIGKILL)
+	_, _ = p.Wait()
+}
+
+func (r *runner) checkTerminal(config *specs.Process, detach bool) error {
+	if detach && config.Terminal && r.consoleSocket == "" {
+		return errors.New("cannot allocate tty if godocker will detach without setting console socket")
+	}
+	if (!detach || !config.Terminal) && r.consoleSocket != "" {
+		return errors.New("cannot use console socket if godocker will not detach or allocate tty")
+	}
+	return nil
+}
+
+func startContainer(context *cli.Context, spec *specs.Spec, action CtAct) (int, error) {
 	id := context.Args().First()
 	if id == "" {
 		return -1, errEmptyID
 	}
 
-	c, err := createContainer(context, id)
+	c, err := createContainer(context, id, spec)
 	if err != nil {
 		return -1, err
 	}
-	cmdArray := make([]string, 0)
-	for _, arg := range context.Args().Tail() {
-		cmdArray = append(cmdArray, arg)
-	}
-	envs := context.StringSlice("e")
-	// todo 传入 cwd
-	// cwd := context.StringSlice("cwd")
-	process := &container.Process{
-		Cwd:  "/",
-		Args: cmdArray,
-		Env:  envs,
-	}
-	c.Run(process)
-	// process := &container.Process{
-	// 	Cwd:  "/",
-	// 	Args: cmdArray,
-	// 	Env:  envs,
-	// }
-	// initProcess := container.NewInitProcess(process)
-	// containerName := context.String("name")
-	// volume := context.String("v")
-	// net := context.String("net")
-
-	// ports := context.StringSlice("p")
-	// return nil, ni
-	// c.Run(initProcess)
-	return 0, nil
+	r := &runner{
+		enableSubreaper: !context.Bool("no-subreaper"),
+		shouldDestroy:   true,
+		container:       c,
+		consoleSocket:   context.String("console-socket"),
+		detach:          context.Bool("detach"),
+		pidFile:         context.String("pid-file"),
+		preserveFDs:     context.Int("preserve-fds"),
+		action:          action,
+		init:            true,
+	}
+	return r.run(spec.Process)
 }